@@ -0,0 +1,257 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/30 10 15
+//
+
+// operator 条件运算符
+type operator string
+
+const (
+	opEq      operator = "eq"
+	opNe      operator = "ne"
+	opGt      operator = "gt"
+	opLt      operator = "lt"
+	opIn      operator = "in"
+	opLike    operator = "like"
+	opBetween operator = "between"
+	opIsNull  operator = "is_null"
+	opAnd     operator = "and"
+	opOr      operator = "or"
+)
+
+// Condition 类型化的查询条件，字段使用模型的结构体字段名或列名，
+// 在构建查询时根据gorm解析的模型结构校验并转换为列名
+type Condition struct {
+	op       operator
+	field    string
+	values   []any
+	children []*Condition
+}
+
+// Eq 字段等于value，value为nil时等价于IsNull
+func Eq(field string, value any) *Condition {
+	return &Condition{op: opEq, field: field, values: []any{value}}
+}
+
+// Ne 字段不等于value，value为nil时表示IS NOT NULL
+func Ne(field string, value any) *Condition {
+	return &Condition{op: opNe, field: field, values: []any{value}}
+}
+
+// Gt 字段大于value
+func Gt(field string, value any) *Condition {
+	return &Condition{op: opGt, field: field, values: []any{value}}
+}
+
+// Lt 字段小于value
+func Lt(field string, value any) *Condition {
+	return &Condition{op: opLt, field: field, values: []any{value}}
+}
+
+// In 字段取值在values中，values为空时不匹配任何记录；
+// 只传入一个切片或数组时按其元素展开，In("ID", ids) 等价于 In("ID", ids...)，[]byte视为单个值
+func In(field string, values ...any) *Condition {
+	if len(values) == 1 {
+		values = flatten(values[0], values)
+	}
+	return &Condition{op: opIn, field: field, values: values}
+}
+
+// flatten 将切片或数组展开为元素列表，其他类型返回fallback
+func flatten(value any, fallback []any) []any {
+	if _, ok := value.([]byte); ok {
+		return fallback
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fallback
+	}
+	values := make([]any, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values
+}
+
+// Like 字段匹配pattern，通配符由调用方指定
+func Like(field string, pattern string) *Condition {
+	return &Condition{op: opLike, field: field, values: []any{pattern}}
+}
+
+// Between 字段在闭区间[low, high]内
+func Between(field string, low, high any) *Condition {
+	return &Condition{op: opBetween, field: field, values: []any{low, high}}
+}
+
+// IsNull 字段为NULL
+func IsNull(field string) *Condition {
+	return &Condition{op: opIsNull, field: field}
+}
+
+// And 所有条件同时成立，nil条件会被忽略
+func And(conditions ...*Condition) *Condition {
+	return &Condition{op: opAnd, children: conditions}
+}
+
+// Or 任一条件成立，nil条件会被忽略
+func Or(conditions ...*Condition) *Condition {
+	return &Condition{op: opOr, children: conditions}
+}
+
+// Build 校验字段并转换为gorm表达式，空的And/Or分组返回nil表示不限制
+func (c *Condition) Build(s *schema.Schema) (clause.Expression, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.op == opAnd || c.op == opOr {
+		return c.buildGroup(s)
+	}
+
+	column, err := lookupColumn(s, c.field)
+	if err != nil {
+		return nil, err
+	}
+	switch c.op {
+	case opEq:
+		return clause.Eq{Column: column, Value: c.values[0]}, nil
+	case opNe:
+		return clause.Neq{Column: column, Value: c.values[0]}, nil
+	case opGt:
+		return clause.Gt{Column: column, Value: c.values[0]}, nil
+	case opLt:
+		return clause.Lt{Column: column, Value: c.values[0]}, nil
+	case opIn:
+		return clause.IN{Column: column, Values: c.values}, nil
+	case opLike:
+		return clause.Like{Column: column, Value: c.values[0]}, nil
+	case opBetween:
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []any{column, c.values[0], c.values[1]}}, nil
+	case opIsNull:
+		return clause.Eq{Column: column, Value: nil}, nil
+	default:
+		return nil, fmt.Errorf("unsupported operator %q", c.op)
+	}
+}
+
+// buildGroup 构建And/Or分组
+func (c *Condition) buildGroup(s *schema.Schema) (clause.Expression, error) {
+	exprs := make([]clause.Expression, 0, len(c.children))
+	for _, child := range c.children {
+		expr, err := child.Build(s)
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil {
+			exprs = append(exprs, expr)
+		}
+	}
+	switch {
+	case len(exprs) == 0:
+		return nil, nil
+	case len(exprs) == 1:
+		return exprs[0], nil
+	case c.op == opOr:
+		return clause.Or(exprs...), nil
+	default:
+		return clause.And(exprs...), nil
+	}
+}
+
+// lookupColumn 根据字段名或列名查找数据库列
+func lookupColumn(s *schema.Schema, name string) (clause.Column, error) {
+	if s == nil {
+		return clause.Column{}, errors.New("schema can not be nil")
+	}
+	field := s.LookUpField(name)
+	if field == nil || field.DBName == "" {
+		return clause.Column{}, fmt.Errorf("unknown field %q for model %s", name, s.Name)
+	}
+	return clause.Column{Table: clause.CurrentTable, Name: field.DBName}, nil
+}
+
+// Schema 解析模型结构，结果由gorm缓存
+func (m *Mapper[T]) Schema() (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: m.db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// BuildCondition 将多个条件按And组合并构建为gorm表达式
+func (m *Mapper[T]) BuildCondition(conditions ...*Condition) (clause.Expression, error) {
+	s, err := m.Schema()
+	if err != nil {
+		return nil, err
+	}
+	return And(conditions...).Build(s)
+}
+
+// Match 添加类型化的查询条件，多个条件按And组合，
+// 字段校验失败时错误在终结方法中返回
+func (m *Mapper[T]) Match(conditions ...*Condition) *Mapper[T] {
+	expr, err := m.BuildCondition(conditions...)
+	if err != nil {
+		return &Mapper[T]{db: m.db.Scopes(func(tx *gorm.DB) *gorm.DB {
+			tx.AddError(err)
+			return tx
+		})}
+	}
+	if expr == nil {
+		return m
+	}
+	return &Mapper[T]{db: m.db.Where(expr)}
+}
+
+// FindOneBy 根据类型化条件查找单条记录
+func (m *Mapper[T]) FindOneBy(conditions ...*Condition) *Result[*T] {
+	return m.Match(conditions...).First()
+}
+
+// FindAllBy 根据类型化条件查找所有记录
+func (m *Mapper[T]) FindAllBy(conditions ...*Condition) *Result[[]*T] {
+	return m.Match(conditions...).Find()
+}
+
+// CountBy 根据类型化条件统计记录数
+func (m *Mapper[T]) CountBy(conditions ...*Condition) *Result[int64] {
+	return m.Match(conditions...).Count()
+}
+
+// UpdateBy 根据类型化条件更新字段，updates的键同样按字段名或列名校验
+func (m *Mapper[T]) UpdateBy(condition *Condition, updates map[string]interface{}) *Result[int64] {
+	s, err := m.Schema()
+	if err != nil {
+		return Fail[int64](err)
+	}
+	columns := make(map[string]interface{}, len(updates))
+	for name, value := range updates {
+		column, err := lookupColumn(s, name)
+		if err != nil {
+			return Fail[int64](err)
+		}
+		columns[column.Name] = value
+	}
+	result := m.Match(condition).db.Model(new(T)).Updates(columns)
+	if result.Error != nil {
+		return Fail[int64](result.Error)
+	}
+	return Ok(result.RowsAffected, result.RowsAffected)
+}
+
+// DeleteBy 根据类型化条件删除记录，条件为空时gorm拒绝执行全表删除
+func (m *Mapper[T]) DeleteBy(conditions ...*Condition) *Result[int64] {
+	return m.Match(conditions...).Delete()
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/30 14 40
+//
+
+type user struct {
+	ID       uint64 `gorm:"primaryKey;autoIncrement"`
+	UserName string `gorm:"size:64"`
+	Age      int
+	Email    *string
+	Ignored  string `gorm:"-"`
+}
+
+func (user) TableName() string {
+	return "users"
+}
+
+func newUserMapper(t *testing.T) *Mapper[user] {
+	database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "condition.db")), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AutoMigrate(&user{}); err != nil {
+		t.Fatal(err)
+	}
+	email := "carol@example.com"
+	mapper := NewMapper[user](database)
+	result := mapper.CreateBatch([]*user{
+		{UserName: "alice", Age: 20},
+		{UserName: "bob", Age: 30},
+		{UserName: "carol", Age: 40, Email: &email},
+		{UserName: "dave", Age: 50},
+	})
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	return mapper
+}
+
+func names(t *testing.T, result *Result[[]*user]) []string {
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	var list []string
+	for _, u := range result.Data {
+		list = append(list, u.UserName)
+	}
+	return list
+}
+
+func TestCondition_Operators(t *testing.T) {
+	mapper := newUserMapper(t)
+	cases := []struct {
+		name       string
+		conditions []*Condition
+		expected   int
+	}{
+		{"eq by field", []*Condition{Eq("UserName", "alice")}, 1},
+		{"eq by column", []*Condition{Eq("user_name", "alice")}, 1},
+		{"ne", []*Condition{Ne("UserName", "alice")}, 3},
+		{"gt", []*Condition{Gt("Age", 30)}, 2},
+		{"lt", []*Condition{Lt("Age", 30)}, 1},
+		{"in", []*Condition{In("UserName", "alice", "dave", "eve")}, 2},
+		{"in empty", []*Condition{In("UserName")}, 0},
+		{"in slice", []*Condition{In("Age", []int{20, 30, 60})}, 2},
+		{"in array", []*Condition{In("UserName", [2]string{"bob", "carol"})}, 2},
+		{"in empty slice", []*Condition{In("Age", []int{})}, 0},
+		{"like", []*Condition{Like("UserName", "%a%")}, 3},
+		{"between", []*Condition{Between("Age", 30, 40)}, 2},
+		{"is null", []*Condition{IsNull("Email")}, 3},
+		{"not null", []*Condition{Ne("Email", nil)}, 1},
+		{"implicit and", []*Condition{Gt("Age", 20), Lt("Age", 50)}, 2},
+		{"empty group", []*Condition{And(), nil}, 4},
+		{"nested", []*Condition{
+			Or(
+				Eq("UserName", "alice"),
+				And(Gt("Age", 30), IsNull("Email")),
+			),
+		}, 2},
+	}
+	for _, c := range cases {
+		got := names(t, mapper.FindAllBy(c.conditions...))
+		if len(got) != c.expected {
+			t.Errorf("%s: expected %d records, got %v", c.name, c.expected, got)
+		}
+	}
+
+	count := mapper.CountBy(Or(Eq("UserName", "alice"), Eq("UserName", "bob")))
+	if count.Err != nil || count.Data != 2 {
+		t.Fatalf("unexpected count %d, %v", count.Data, count.Err)
+	}
+	one := mapper.FindOneBy(Eq("Age", 40))
+	if one.Err != nil || one.Data.UserName != "carol" {
+		t.Fatalf("unexpected record %+v, %v", one.Data, one.Err)
+	}
+}
+
+func TestCondition_UnknownField(t *testing.T) {
+	mapper := newUserMapper(t)
+	for _, field := range []string{"Nmae", "Ignored"} {
+		if _, err := mapper.BuildCondition(Eq(field, "x")); err == nil {
+			t.Errorf("expected field %q to be rejected", field)
+		}
+		if result := mapper.FindAllBy(Or(Eq("Age", 20), Eq(field, "x"))); result.Err == nil {
+			t.Errorf("expected query on %q to fail", field)
+		}
+	}
+	// 校验失败的条件不会影响原Mapper
+	if got := names(t, mapper.Where("age > ?", 30).Find()); len(got) != 2 {
+		t.Fatalf("unexpected records %v", got)
+	}
+	if result := mapper.UpdateBy(Eq("UserName", "bob"), map[string]interface{}{"Agee": 1}); result.Err == nil {
+		t.Fatal("expected unknown update column to be rejected")
+	}
+}
+
+func TestCondition_UpdateDelete(t *testing.T) {
+	mapper := newUserMapper(t)
+
+	updated := mapper.UpdateBy(Lt("Age", 35), map[string]interface{}{"Age": 99, "user_name": "renamed"})
+	if updated.Err != nil || updated.Data != 2 {
+		t.Fatalf("unexpected update result %d, %v", updated.Data, updated.Err)
+	}
+	if got := names(t, mapper.FindAllBy(Eq("Age", 99))); len(got) != 2 || got[0] != "renamed" {
+		t.Fatalf("unexpected records %v", got)
+	}
+
+	// 空条件不允许全表删除
+	if result := mapper.DeleteBy(); !errors.Is(result.Err, gorm.ErrMissingWhereClause) {
+		t.Fatalf("expected missing where clause, got %v", result.Err)
+	}
+	deleted := mapper.DeleteBy(Eq("Age", 99))
+	if deleted.Err != nil || deleted.Data != 2 {
+		t.Fatalf("unexpected delete result %d, %v", deleted.Data, deleted.Err)
+	}
+	if got := names(t, mapper.Find()); len(got) != 2 {
+		t.Fatalf("unexpected remaining records %v", got)
+	}
+}
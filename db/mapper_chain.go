@@ -122,7 +122,7 @@ func (m *Mapper[T]) Find() *Result[[]*T] {
 // Count 统计记录数
 func (m *Mapper[T]) Count() *Result[int64] {
 	var count int64
-	result := m.db.Count(&count)
+	result := m.db.Model(new(T)).Count(&count)
 	if result.Error != nil {
 		return Fail[int64](result.Error)
 	}
@@ -132,7 +132,7 @@ func (m *Mapper[T]) Count() *Result[int64] {
 // Pluck 查询单列值
 func (m *Mapper[T]) Pluck(column string) *Result[[]interface{}] {
 	var values []interface{}
-	result := m.db.Pluck(column, &values)
+	result := m.db.Model(new(T)).Pluck(column, &values)
 	if result.Error != nil {
 		return Fail[[]interface{}](result.Error)
 	}
@@ -0,0 +1,85 @@
+package log_utils
+
+import (
+	"context"
+	"log"
+	"log/slog"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/24 10 20
+//
+
+// options 组件日志配置
+type options struct {
+	handler slog.Handler
+	level   slog.Leveler
+}
+
+// Option 组件构造函数共用的日志选项
+type Option func(*options)
+
+// WithHandler 使用指定的slog处理器输出日志，为nil时使用slog.Default()的处理器
+func WithHandler(handler slog.Handler) Option {
+	return func(o *options) {
+		o.handler = handler
+	}
+}
+
+// WithStdLogger 以文本格式将日志写入标准库日志器的输出，兼容使用*log.Logger的调用方，
+// logger的前缀和标志不再生效
+func WithStdLogger(logger *log.Logger) Option {
+	return WithHandler(slog.NewTextHandler(logger.Writer(), nil))
+}
+
+// WithLevel 丢弃低于level的日志，只能在处理器自身级别的基础上进一步过滤
+func WithLevel(level slog.Leveler) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// Silent 丢弃所有日志
+func Silent() Option {
+	return WithHandler(slog.DiscardHandler)
+}
+
+// NewHandler 根据选项创建处理器，后面的选项覆盖前面的选项
+func NewHandler(opts ...Option) slog.Handler {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	handler := o.handler
+	if handler == nil {
+		handler = slog.Default().Handler()
+	}
+	if o.level != nil {
+		handler = &levelHandler{Handler: handler, level: o.level}
+	}
+	return handler
+}
+
+// NewLogger 根据选项创建组件日志器，component作为每条日志的属性
+func NewLogger(component string, opts ...Option) *slog.Logger {
+	return slog.New(NewHandler(opts...)).With("component", component)
+}
+
+// levelHandler 按级别过滤日志的处理器
+type levelHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.Handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
@@ -0,0 +1,45 @@
+package log_utils
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/24 14 00
+//
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+
+	logger := NewLogger("demo", WithHandler(handler), WithLevel(slog.LevelInfo))
+	logger.Debug("per message")
+	logger.Info("lifecycle")
+	out := buf.String()
+	if strings.Contains(out, "per message") {
+		t.Fatalf("expected debug record to be filtered, got %q", out)
+	}
+	if !strings.Contains(out, "lifecycle") || !strings.Contains(out, "component=demo") {
+		t.Fatalf("expected info record with component attribute, got %q", out)
+	}
+
+	buf.Reset()
+	NewLogger("demo", WithHandler(handler), Silent()).Error("dropped")
+	if buf.Len() != 0 {
+		t.Fatalf("expected silent logger to discard records, got %q", buf.String())
+	}
+}
+
+func TestWithStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	NewLogger("demo", WithStdLogger(log.New(&buf, "", 0))).Info("connected", "addr", "127.0.0.1")
+	out := buf.String()
+	if !strings.Contains(out, "msg=connected") || !strings.Contains(out, "component=demo") || !strings.Contains(out, "addr=127.0.0.1") {
+		t.Fatalf("expected text record written to std logger, got %q", out)
+	}
+}
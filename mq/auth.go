@@ -0,0 +1,221 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/22 10 00
+//
+
+// ErrUnauthorized 授权检查未通过
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Action 需要授权的操作
+type Action string
+
+const (
+	ActionPublish   Action = "publish"   // 发布，主体为消息的SenderID
+	ActionSubscribe Action = "subscribe" // 订阅，主体为订阅者ID
+)
+
+// Authorizer 授权检查，返回nil表示允许
+type Authorizer interface {
+	Authorize(principal string, action Action, topic Topic) error
+}
+
+// AuthorizerFunc 函数形式的授权检查
+type AuthorizerFunc func(principal string, action Action, topic Topic) error
+
+func (f AuthorizerFunc) Authorize(principal string, action Action, topic Topic) error {
+	return f(principal, action, topic)
+}
+
+// Effect 规则的效果
+type Effect int
+
+const (
+	Allow Effect = iota
+	Deny
+)
+
+// PrincipalPlaceholder 规则主题中的该层级会被替换为当前主体，如 "p2p/{principal}"
+const PrincipalPlaceholder = "{principal}"
+
+// AccessRule 访问规则
+type AccessRule struct {
+	Effect     Effect
+	Principals []string // 主体ID，"*"或为空时匹配所有主体
+	Actions    []Action // 操作，为空时匹配所有操作
+	Topics     []Topic  // 主题模式，可以包含通配符和PrincipalPlaceholder
+}
+
+// RuleAuthorizer 基于规则的授权：任一匹配的Deny规则拒绝，否则任一匹配的Allow规则允许，都不匹配时使用默认效果。
+// Allow规则必须完全覆盖订阅模式才生效，Deny规则与订阅模式有交集即生效，
+// 因此允许 "sensor/#" 时可以订阅 "sensor/+/temp"，拒绝 "secret/#" 时不能订阅 "#"
+type RuleAuthorizer struct {
+	mu       sync.RWMutex
+	rules    []AccessRule
+	fallback Effect
+}
+
+// NewRuleAuthorizer 创建基于规则的授权，fallback为没有规则匹配时的效果
+func NewRuleAuthorizer(fallback Effect, rules ...AccessRule) *RuleAuthorizer {
+	return &RuleAuthorizer{rules: rules, fallback: fallback}
+}
+
+// AddRule 追加访问规则
+func (a *RuleAuthorizer) AddRule(rules ...AccessRule) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules = append(a.rules, rules...)
+}
+
+func (a *RuleAuthorizer) Authorize(principal string, action Action, topic Topic) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	allowed := a.fallback == Allow
+	for _, rule := range a.rules {
+		if !rule.matchesPrincipal(principal) || !rule.matchesAction(action) {
+			continue
+		}
+		for _, pattern := range rule.Topics {
+			pattern, ok := pattern.withPrincipal(principal)
+			if !ok {
+				// 主体ID含有通配符或分隔符时不能代入规则，拒绝规则按拒绝处理，允许规则不生效
+				if rule.Effect == Deny {
+					return fmt.Errorf("%w: invalid principal %q", ErrUnauthorized, principal)
+				}
+				continue
+			}
+			switch {
+			case rule.Effect == Deny && pattern.Overlaps(topic):
+				return fmt.Errorf("%w: %s %s denied for %q", ErrUnauthorized, action, topic, principal)
+			case rule.Effect == Allow && pattern.Covers(topic):
+				allowed = true
+			}
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s %s not allowed for %q", ErrUnauthorized, action, topic, principal)
+	}
+	return nil
+}
+
+func (r *AccessRule) matchesPrincipal(principal string) bool {
+	if len(r.Principals) == 0 {
+		return true
+	}
+	for _, p := range r.Principals {
+		if p == "*" || p == principal {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *AccessRule) matchesAction(action Action) bool {
+	if len(r.Actions) == 0 {
+		return true
+	}
+	for _, a := range r.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// withPrincipal 将主题中的PrincipalPlaceholder层级替换为主体，主体不是合法ID时返回false
+func (t Topic) withPrincipal(principal string) (Topic, bool) {
+	if !strings.Contains(string(t), PrincipalPlaceholder) {
+		return t, true
+	}
+	if ValidateID(principal) != nil {
+		return t, false
+	}
+	return Topic(strings.ReplaceAll(string(t), PrincipalPlaceholder, principal)), true
+}
+
+// SetAuthorizer 设置授权检查，为nil时不做检查
+func (b *MessageBroker) SetAuthorizer(authorizer Authorizer) {
+	b.authorizerMu.Lock()
+	defer b.authorizerMu.Unlock()
+	b.authorizer = authorizer
+}
+
+// authorize 执行授权检查，拒绝时计入统计
+func (b *MessageBroker) authorize(principal string, action Action, topic Topic) error {
+	b.authorizerMu.RLock()
+	authorizer := b.authorizer
+	b.authorizerMu.RUnlock()
+	if authorizer == nil {
+		return nil
+	}
+	if err := authorizer.Authorize(principal, action, topic); err != nil {
+		b.recordDenied()
+		b.logger.Warn("Access denied", "principal", principal, "action", action, "topic", topic, "error", err)
+		if !errors.Is(err, ErrUnauthorized) {
+			err = fmt.Errorf("%w: %v", ErrUnauthorized, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// recordDenied 记录一次被拒绝的访问
+func (b *MessageBroker) recordDenied() {
+	atomic.AddUint64(&b.metrics.denied, 1)
+}
+
+// Authenticator 远程客户端的身份认证，token通过连接请求携带
+type Authenticator interface {
+	Authenticate(clientID, token string) error
+}
+
+// TokenAuthenticator 基于静态令牌的认证，每个令牌绑定一个客户端ID
+type TokenAuthenticator struct {
+	mu     sync.RWMutex
+	tokens map[string]string // token -> clientID
+}
+
+// NewTokenAuthenticator 创建令牌认证，tokens为 token -> clientID
+func NewTokenAuthenticator(tokens map[string]string) *TokenAuthenticator {
+	copied := make(map[string]string, len(tokens))
+	for token, clientID := range tokens {
+		copied[token] = clientID
+	}
+	return &TokenAuthenticator{tokens: copied}
+}
+
+// SetToken 添加或替换令牌
+func (a *TokenAuthenticator) SetToken(token, clientID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tokens[token] = clientID
+}
+
+// RevokeToken 撤销令牌，已建立的连接不受影响
+func (a *TokenAuthenticator) RevokeToken(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.tokens, token)
+}
+
+func (a *TokenAuthenticator) Authenticate(clientID, token string) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if token == "" {
+		return fmt.Errorf("%w: token required", ErrUnauthorized)
+	}
+	if bound, ok := a.tokens[token]; !ok || bound != clientID {
+		return fmt.Errorf("%w: invalid token for client %s", ErrUnauthorized, clientID)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/22 15 40
+//
+
+func TestTopic_CoversOverlaps(t *testing.T) {
+	cases := []struct {
+		pattern, other   Topic
+		covers, overlaps bool
+	}{
+		{"sensor/#", "sensor/+/temp", true, true},
+		{"sensor/+", "sensor/#", false, true},
+		{"secret/#", "#", false, true},
+		{"a/b", "a/b", true, true},
+		{"a/+", "b/+", false, false},
+		{"a/#", "a", true, true},
+		{"a/b/c", "a/b", false, false},
+	}
+	for _, c := range cases {
+		if got := c.pattern.Covers(c.other); got != c.covers {
+			t.Errorf("%s.Covers(%s) = %v, expected %v", c.pattern, c.other, got, c.covers)
+		}
+		if got := c.pattern.Overlaps(c.other); got != c.overlaps {
+			t.Errorf("%s.Overlaps(%s) = %v, expected %v", c.pattern, c.other, got, c.overlaps)
+		}
+	}
+}
+
+func TestRuleAuthorizer(t *testing.T) {
+	authorizer := NewRuleAuthorizer(Deny,
+		AccessRule{Effect: Allow, Actions: []Action{ActionSubscribe}, Topics: []Topic{"sensor/#", "p2p/" + PrincipalPlaceholder}},
+		AccessRule{Effect: Allow, Principals: []string{"device-1"}, Actions: []Action{ActionPublish}, Topics: []Topic{"sensor/device-1/#"}},
+		AccessRule{Effect: Deny, Principals: []string{"*"}, Topics: []Topic{"sensor/secret/#"}},
+	)
+
+	cases := []struct {
+		principal string
+		action    Action
+		topic     Topic
+		allowed   bool
+	}{
+		{"app", ActionSubscribe, "sensor/device-1/+", true},
+		{"app", ActionSubscribe, "sensor/+/temp", false}, // 可能匹配 sensor/secret/temp
+		{"app", ActionSubscribe, "sensor/#", false},
+		{"app", ActionSubscribe, "p2p/app", true},
+		{"app", ActionSubscribe, "p2p/other", false},
+		{"device-1", ActionPublish, "sensor/device-1/temp", true},
+		{"device-1", ActionPublish, "sensor/device-2/temp", false},
+		{"device-2", ActionPublish, "sensor/device-2/temp", false},
+		{"", ActionPublish, "p2p/app", false},
+		{"#", ActionSubscribe, "p2p/#", false}, // 主体含通配符时不能代入规则
+		{"+", ActionSubscribe, "p2p/+", false},
+		{"a/b", ActionSubscribe, "p2p/a/b", false},
+	}
+	for _, c := range cases {
+		err := authorizer.Authorize(c.principal, c.action, c.topic)
+		if (err == nil) != c.allowed {
+			t.Errorf("Authorize(%q, %s, %s) = %v, expected allowed=%v", c.principal, c.action, c.topic, err, c.allowed)
+		}
+		if err != nil && !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("expected ErrUnauthorized, got %v", err)
+		}
+	}
+}
+
+func TestMQ_Authorizer(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+	b.SetAuthorizer(NewRuleAuthorizer(Deny,
+		AccessRule{Effect: Allow, Principals: []string{"app"}, Actions: []Action{ActionSubscribe}, Topics: []Topic{"orders/#"}},
+		AccessRule{Effect: Allow, Principals: []string{"shop"}, Actions: []Action{ActionPublish}, Topics: []Topic{"orders/#"}},
+	))
+
+	b.RegisterSubscriber(NewSubscriber("app"))
+	received := make(chan *Message, 1)
+	handler := func(ctx context.Context, msg *Message) error {
+		received <- msg
+		return nil
+	}
+	if err := b.Subscribe("app", map[Topic]MessageHandler{"orders/#": handler}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Subscribe("app", map[Topic]MessageHandler{"payments/#": handler}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected subscribe to be denied, got %v", err)
+	}
+
+	denied := NewMessage("orders/1", []byte("forged"))
+	denied.SenderID = "intruder"
+	if err := b.Publish(denied); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected publish to be denied, got %v", err)
+	}
+
+	msg := NewMessage("orders/1", []byte("ok"))
+	msg.SenderID = "shop"
+	if err := b.Publish(msg); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if string(got.Payload) != "ok" {
+			t.Fatalf("unexpected payload %s", got.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("authorized message not delivered")
+	}
+
+	if stats := b.GetStats(); stats.Denied != 2 {
+		t.Fatalf("expected 2 denied attempts, got %d", stats.Denied)
+	}
+}
+
+func TestRemote_TokenAuthentication(t *testing.T) {
+	b, server, addr := startRemoteBroker(t)
+	server.SetAuthenticator(NewTokenAuthenticator(map[string]string{"secret-token": "remote1"}))
+	b.SetAuthorizer(NewRuleAuthorizer(Allow,
+		AccessRule{Effect: Deny, Principals: []string{"remote1"}, Actions: []Action{ActionPublish}, Topics: []Topic{"admin/#"}},
+	))
+
+	if _, err := DialTCPWithToken(addr, "remote1", "wrong", time.Second); err == nil {
+		t.Fatal("expected connect with invalid token to fail")
+	}
+	if _, err := DialTCP(addr, "remote1", time.Second); err == nil {
+		t.Fatal("expected connect without token to fail")
+	}
+
+	client, err := DialTCPWithToken(addr, "remote1", "secret-token", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// 伪造的SenderID会被替换为认证过的客户端ID
+	forged := NewMessage("admin/reset", nil)
+	forged.SenderID = "root"
+	if err := client.Publish(forged); err == nil {
+		t.Fatal("expected publish with forged sender to be denied")
+	}
+	if err := client.Publish(NewMessage("events/ok", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if stats := b.GetStats(); stats.Denied != 3 {
+		t.Fatalf("expected 3 denied attempts, got %d", stats.Denied)
+	}
+}
@@ -0,0 +1,430 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yui100901/MyGo/log_utils"
+	"github.com/Yui100901/MyGo/mq"
+	"github.com/Yui100901/MyGo/network/mqtt_utils"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/12 10 10
+//
+
+// 桥接相关的消息头
+const (
+	HeaderOrigin  = "x-bridge-origin" // 首次将消息发往MQTT的桥接ID
+	HeaderVia     = "x-bridge-via"    // 将消息从MQTT引入本地代理的桥接ID
+	HeaderMQTTQoS = "x-mqtt-qos"      // 出站时覆盖规则的QoS，入站时记录收到的QoS
+)
+
+// Direction 桥接方向
+type Direction int
+
+const (
+	Outbound Direction = iota // 本地代理 -> MQTT
+	Inbound                   // MQTT -> 本地代理
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Outbound:
+		return "outbound"
+	case Inbound:
+		return "inbound"
+	default:
+		return "unknown"
+	}
+}
+
+// Rule 桥接规则，Local和Remote可以包含通配符，但两者的通配符必须一一对应，
+// 如 Local "telemetry/+/#" 对应 Remote "edge/+/data/#"
+type Rule struct {
+	Direction Direction
+	Local     mq.Topic // 本地主题模式
+	Remote    string   // MQTT主题模式
+	QoS       byte     // 出站发布或入站订阅使用的QoS
+}
+
+// MQTTClient 桥接所需的MQTT客户端操作，*mqtt_utils.MQTTClient实现了该接口
+type MQTTClient interface {
+	Subscribe(topic string, qos byte, callback mqtt.MessageHandler)
+	Unsubscribe(topics ...string)
+	Publish(topic string, qos byte, retained bool, payload interface{}) error
+	IsConnected() bool
+}
+
+var _ MQTTClient = (*mqtt_utils.MQTTClient)(nil)
+
+// Config 桥接配置
+type Config struct {
+	ID            string        // 桥接ID，同时作为本地订阅者ID的后缀和防环标识
+	Rules         []Rule        // 桥接规则
+	BufferSize    int           // MQTT断开时缓存的出站消息数量，超出时丢弃最旧的消息
+	Envelope      bool          // 是否将消息头一并封装发送，关闭时只发送原始载荷，无法跨MQTT防环
+	RetryInterval time.Duration // 断开或发布失败后的重试间隔
+	FlushTimeout  time.Duration // 停止时等待出站缓冲发完的最长时间，超时仍未发出的消息计入Dropped
+}
+
+// DefaultConfig 返回默认的桥接配置
+func DefaultConfig(id string) *Config {
+	return &Config{
+		ID:            id,
+		BufferSize:    1000,
+		Envelope:      true,
+		RetryInterval: time.Second,
+		FlushTimeout:  5 * time.Second,
+	}
+}
+
+// envelope MQTT上传输的消息封装
+type envelope struct {
+	ID      string            `json:"id"`
+	Key     string            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Payload []byte            `json:"payload"`
+}
+
+// outbound 等待发往MQTT的消息
+type outbound struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
+// Bridge 本地消息代理与外部MQTT代理之间的双向桥接
+type Bridge struct {
+	broker       *mq.MessageBroker
+	client       MQTTClient
+	config       *Config
+	subscriberID string
+
+	buffer  chan *outbound // 出站缓冲
+	dropped int64          // 缓冲溢出或停止时未能发出的出站消息数量（原子操作）
+
+	stopping chan struct{} // 关闭后发送协程发完缓冲即退出
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+
+	logOpts []log_utils.Option // 日志选项，出站订阅者共用
+	logger  *slog.Logger
+}
+
+// New 创建桥接，规则中的通配符不匹配时返回错误，opts配置日志输出
+func New(broker *mq.MessageBroker, client MQTTClient, config *Config, opts ...log_utils.Option) (*Bridge, error) {
+	if broker == nil || client == nil {
+		return nil, errors.New("bridge requires a broker and a mqtt client")
+	}
+	if config == nil {
+		return nil, errors.New("bridge requires a config")
+	}
+	if config.ID == "" {
+		return nil, errors.New("bridge requires an id")
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = time.Second
+	}
+	if config.FlushTimeout <= 0 {
+		config.FlushTimeout = DefaultConfig(config.ID).FlushTimeout
+	}
+	for _, rule := range config.Rules {
+		if rule.QoS > 2 {
+			return nil, fmt.Errorf("invalid qos %d for rule %s", rule.QoS, rule.Local)
+		}
+		switch rule.Direction {
+		case Outbound:
+			if err := validateMapping(string(rule.Local), rule.Remote); err != nil {
+				return nil, err
+			}
+		case Inbound:
+			if err := validateMapping(rule.Remote, string(rule.Local)); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown bridge direction %d", rule.Direction)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Bridge{
+		broker:       broker,
+		client:       client,
+		config:       config,
+		subscriberID: "bridge_" + config.ID,
+		buffer:       make(chan *outbound, config.BufferSize),
+		stopping:     make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+		logOpts:      opts,
+		logger:       log_utils.NewLogger("mq-bridge", opts...).With("bridge", config.ID),
+	}, nil
+}
+
+// SetLogger 设置日志记录器，日志以文本格式写入logger的输出
+func (b *Bridge) SetLogger(logger *log.Logger) {
+	b.SetSlogLogger(log_utils.NewLogger("mq-bridge", log_utils.WithStdLogger(logger)).With("bridge", b.config.ID))
+}
+
+// SetSlogLogger 设置slog日志记录器
+func (b *Bridge) SetSlogLogger(logger *slog.Logger) {
+	b.logger = logger
+}
+
+// Start 订阅本地和远程主题，开始桥接
+func (b *Bridge) Start() error {
+	var err error
+	b.startOnce.Do(func() {
+		err = b.start()
+	})
+	return err
+}
+
+func (b *Bridge) start() error {
+	outboundTopics := make(map[mq.Topic]mq.MessageHandler)
+	for _, rule := range b.config.Rules {
+		switch rule.Direction {
+		case Outbound:
+			outboundTopics[rule.Local] = b.outboundHandler(rule)
+		case Inbound:
+			b.client.Subscribe(rule.Remote, rule.QoS, b.inboundHandler(rule))
+		}
+	}
+
+	if len(outboundTopics) > 0 {
+		// 单个工作协程保证出站消息按本地投递顺序进入缓冲
+		subscriber := mq.NewSubscriberWithConfig(b.subscriberID, &mq.SubscriberConfig{
+			InboxSize:      b.config.BufferSize,
+			Workers:        1,
+			OverflowPolicy: mq.OverflowBlock,
+		}, b.logOpts...)
+		if err := b.broker.RegisterSubscriber(subscriber); err != nil {
+			return err
+		}
+		if err := b.broker.Subscribe(b.subscriberID, outboundTopics); err != nil {
+			b.broker.UnregisterSubscriber(b.subscriberID)
+			return err
+		}
+	}
+
+	b.wg.Add(1)
+	go b.sender()
+	b.logger.Info("Bridge started", "rules", len(b.config.Rules))
+	return nil
+}
+
+// Stop 停止桥接，在FlushTimeout内尽量发出缓冲中的消息，超时后剩余的消息被丢弃并计入Dropped
+func (b *Bridge) Stop() {
+	b.stopOnce.Do(func() {
+		remotes := make([]string, 0)
+		for _, rule := range b.config.Rules {
+			if rule.Direction == Inbound {
+				remotes = append(remotes, rule.Remote)
+			}
+		}
+		b.client.Unsubscribe(remotes...)
+		b.broker.UnregisterSubscriber(b.subscriberID)
+
+		close(b.stopping)
+		flushed := make(chan struct{})
+		go func() {
+			b.wg.Wait()
+			close(flushed)
+		}()
+		timer := time.NewTimer(b.config.FlushTimeout)
+		defer timer.Stop()
+		select {
+		case <-flushed:
+		case <-timer.C:
+			b.logger.Warn("Flush outbound buffer timeout", "pending", len(b.buffer))
+		}
+		b.cancel()
+		<-flushed
+
+		discarded := 0
+		for len(b.buffer) > 0 {
+			<-b.buffer
+			discarded++
+		}
+		atomic.AddInt64(&b.dropped, int64(discarded))
+		b.logger.Info("Bridge stopped", "discarded", discarded, "dropped", b.Dropped())
+	})
+}
+
+// SubscriberID 返回桥接在本地代理中使用的主体ID（"bridge_<ID>"），
+// 出站规则以该ID订阅，入站消息以该ID作为SenderID发布
+func (b *Bridge) SubscriberID() string {
+	return b.subscriberID
+}
+
+// Pending 返回缓冲中等待发往MQTT的消息数量
+func (b *Bridge) Pending() int {
+	return len(b.buffer)
+}
+
+// Dropped 返回因缓冲溢出或停止时未能发出而丢弃的出站消息数量
+func (b *Bridge) Dropped() int64 {
+	return atomic.LoadInt64(&b.dropped)
+}
+
+// outboundHandler 将本地消息映射到远程主题后放入出站缓冲
+func (b *Bridge) outboundHandler(rule Rule) mq.MessageHandler {
+	return func(ctx context.Context, msg *mq.Message) error {
+		// 由本桥接从MQTT引入的消息不再发回
+		if msg.GetHeader(HeaderVia) == b.config.ID {
+			return nil
+		}
+		topic, ok := mapTopic(string(msg.Topic), string(rule.Local), rule.Remote)
+		if !ok {
+			return nil
+		}
+
+		qos := rule.QoS
+		if value := msg.GetHeader(HeaderMQTTQoS); value != "" {
+			if parsed, err := strconv.ParseUint(value, 10, 8); err == nil && parsed <= 2 {
+				qos = byte(parsed)
+			}
+		}
+		payload, err := b.encode(msg)
+		if err != nil {
+			return mq.Permanent(err)
+		}
+		b.enqueue(&outbound{topic: topic, qos: qos, retained: msg.Retained, payload: payload})
+		return nil
+	}
+}
+
+// encode 按配置将消息编码为MQTT载荷
+func (b *Bridge) encode(msg *mq.Message) ([]byte, error) {
+	// 空载荷的保留消息在MQTT中表示清除，不能封装
+	if !b.config.Envelope || (msg.Retained && len(msg.Payload) == 0) {
+		return msg.Payload, nil
+	}
+	headers := make(map[string]string, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	delete(headers, HeaderVia)
+	if headers[HeaderOrigin] == "" {
+		headers[HeaderOrigin] = b.config.ID
+	}
+	return json.Marshal(&envelope{ID: msg.ID, Key: msg.Key, Headers: headers, Payload: msg.Payload})
+}
+
+// decode 解析桥接封装的MQTT载荷，只有带消息ID和来源桥接的JSON才视为封装，
+// 其他载荷（包括普通的JSON对象）按原始载荷处理
+func (b *Bridge) decode(data []byte) (*envelope, bool) {
+	if !b.config.Envelope {
+		return nil, false
+	}
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, false
+	}
+	if env.ID == "" || env.Headers[HeaderOrigin] == "" {
+		return nil, false
+	}
+	return &env, true
+}
+
+// enqueue 放入出站缓冲，缓冲已满时丢弃最旧的消息
+func (b *Bridge) enqueue(out *outbound) {
+	for {
+		select {
+		case b.buffer <- out:
+			return
+		default:
+		}
+		select {
+		case <-b.buffer:
+			atomic.AddInt64(&b.dropped, 1)
+		default:
+		}
+	}
+}
+
+// sender 按顺序发送出站缓冲中的消息，MQTT断开或发布失败时等待重连后重试，
+// 桥接停止时发完缓冲后退出
+func (b *Bridge) sender() {
+	defer b.wg.Done()
+	for {
+		var out *outbound
+		select {
+		case out = <-b.buffer:
+		case <-b.stopping:
+			if len(b.buffer) == 0 {
+				return
+			}
+			continue
+		case <-b.ctx.Done():
+			return
+		}
+		for {
+			if b.client.IsConnected() {
+				err := b.client.Publish(out.topic, out.qos, out.retained, out.payload)
+				if err == nil {
+					break
+				}
+				b.logger.Error("Publish failed", "topic", out.topic, "error", err)
+			}
+			select {
+			case <-time.After(b.config.RetryInterval):
+			case <-b.ctx.Done():
+				atomic.AddInt64(&b.dropped, 1)
+				return
+			}
+		}
+	}
+}
+
+// inboundHandler 将MQTT消息映射到本地主题后发布到本地代理
+func (b *Bridge) inboundHandler(rule Rule) mqtt.MessageHandler {
+	return func(client mqtt.Client, message mqtt.Message) {
+		topic, ok := mapTopic(message.Topic(), rule.Remote, string(rule.Local))
+		if !ok {
+			return
+		}
+
+		msg := mq.NewMessage(mq.Topic(topic), message.Payload())
+		if env, ok := b.decode(message.Payload()); ok {
+			// 本桥接自己发出的消息，忽略回显
+			if env.Headers[HeaderOrigin] == b.config.ID {
+				return
+			}
+			for k, v := range env.Headers {
+				msg.SetHeader(k, v)
+			}
+			msg.Key = env.Key
+			msg.Payload = env.Payload
+		}
+		msg.SetHeader(HeaderVia, b.config.ID)
+		msg.SetHeader(HeaderMQTTQoS, strconv.Itoa(int(message.Qos())))
+		msg.SetRetained(message.Retained())
+		// 以桥接的订阅者ID作为发布主体，授权规则可以据此放行入站消息
+		msg.SenderID = b.subscriberID
+
+		if err := b.broker.Publish(msg); err != nil {
+			b.logger.Error("Publish inbound message failed", "topic", topic, "mqtt_topic", message.Topic(), "error", err)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Yui100901/MyGo/mq"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/12 15 00
+//
+
+// fakeMessage 实现mqtt.Message
+type fakeMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
+func (m *fakeMessage) Duplicate() bool   { return false }
+func (m *fakeMessage) Qos() byte         { return m.qos }
+func (m *fakeMessage) Retained() bool    { return m.retained }
+func (m *fakeMessage) Topic() string     { return m.topic }
+func (m *fakeMessage) MessageID() uint16 { return 0 }
+func (m *fakeMessage) Payload() []byte   { return m.payload }
+func (m *fakeMessage) Ack()              {}
+
+// fakeClient 内存中的MQTT代理，发布的消息会回送给匹配的订阅
+type fakeClient struct {
+	mu            sync.Mutex
+	connected     int32
+	subscriptions map[string]mqtt.MessageHandler
+	published     []*fakeMessage
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{connected: 1, subscriptions: make(map[string]mqtt.MessageHandler)}
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscriptions[topic] = callback
+}
+
+func (c *fakeClient) Unsubscribe(topics ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		delete(c.subscriptions, topic)
+	}
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	if !c.IsConnected() {
+		return errors.New("not connected")
+	}
+	msg := &fakeMessage{topic: topic, qos: qos, retained: retained, payload: payload.([]byte)}
+	c.mu.Lock()
+	c.published = append(c.published, msg)
+	handlers := make([]mqtt.MessageHandler, 0)
+	for pattern, handler := range c.subscriptions {
+		if mq.Topic(pattern).Matches(mq.Topic(topic)) {
+			handlers = append(handlers, handler)
+		}
+	}
+	c.mu.Unlock()
+	for _, handler := range handlers {
+		handler(nil, msg)
+	}
+	return nil
+}
+
+func (c *fakeClient) IsConnected() bool {
+	return atomic.LoadInt32(&c.connected) == 1
+}
+
+func (c *fakeClient) setConnected(connected bool) {
+	value := int32(0)
+	if connected {
+		value = 1
+	}
+	atomic.StoreInt32(&c.connected, value)
+}
+
+func (c *fakeClient) publishedTopics() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	topics := make([]string, 0, len(c.published))
+	for _, msg := range c.published {
+		topics = append(topics, msg.topic)
+	}
+	return topics
+}
+
+func (c *fakeClient) lastPublished() *fakeMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.published) == 0 {
+		return nil
+	}
+	return c.published[len(c.published)-1]
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func startBridge(t *testing.T, client MQTTClient, rules ...Rule) (*mq.MessageBroker, *Bridge) {
+	t.Helper()
+	broker := mq.NewMessageBroker(nil)
+	broker.Start()
+	t.Cleanup(func() { broker.Stop() })
+
+	config := DefaultConfig("edge")
+	config.Rules = rules
+	config.RetryInterval = 20 * time.Millisecond
+	b, err := New(broker, client, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(b.Stop)
+	return broker, b
+}
+
+func TestMapTopic(t *testing.T) {
+	cases := []struct {
+		topic, from, to, expected string
+		ok                        bool
+	}{
+		{"sensor/1/temp", "sensor/+/temp", "edge/+/temperature", "edge/1/temperature", true},
+		{"sensor/1/a/b", "sensor/+/#", "edge/+/data/#", "edge/1/data/a/b", true},
+		{"sensor", "sensor/#", "edge/#", "edge", true},
+		{"other/1", "sensor/#", "edge/#", "", false},
+		{"exact", "exact", "remote/exact", "remote/exact", true},
+	}
+	for _, c := range cases {
+		mapped, ok := mapTopic(c.topic, c.from, c.to)
+		if ok != c.ok || mapped != c.expected {
+			t.Errorf("mapTopic(%s, %s, %s) = %s, %v; expected %s, %v",
+				c.topic, c.from, c.to, mapped, ok, c.expected, c.ok)
+		}
+	}
+
+	if err := validateMapping("a/+/#", "b/#"); err == nil {
+		t.Error("expected mismatched wildcards to be rejected")
+	}
+}
+
+func TestBridge_Outbound(t *testing.T) {
+	client := newFakeClient()
+	broker, _ := startBridge(t, client, Rule{Direction: Outbound, Local: "sensor/+/temp", Remote: "edge/+/temperature", QoS: 1})
+
+	msg := mq.NewMessage("sensor/7/temp", []byte("21.5"))
+	msg.SetRetained(true)
+	broker.Publish(msg)
+
+	override := mq.NewMessage("sensor/8/temp", []byte("19.0"))
+	override.SetHeader(HeaderMQTTQoS, "2")
+	broker.Publish(override)
+
+	waitFor(t, 2*time.Second, func() bool { return len(client.publishedTopics()) == 2 })
+	client.mu.Lock()
+	first, second := client.published[0], client.published[1]
+	client.mu.Unlock()
+	if first.topic != "edge/7/temperature" || first.qos != 1 || !first.retained {
+		t.Fatalf("unexpected outbound message: %+v", first)
+	}
+	if second.qos != 2 {
+		t.Fatalf("expected qos override 2, got %d", second.qos)
+	}
+}
+
+func TestBridge_Inbound(t *testing.T) {
+	client := newFakeClient()
+	broker, _ := startBridge(t, client, Rule{Direction: Inbound, Local: "cmd/#", Remote: "cloud/cmd/#", QoS: 1})
+
+	received := make(chan *mq.Message, 1)
+	broker.RegisterSubscriber(mq.NewSubscriber("device"))
+	broker.Subscribe("device", map[mq.Topic]mq.MessageHandler{
+		"cmd/#": func(ctx context.Context, msg *mq.Message) error {
+			received <- msg
+			return nil
+		},
+	})
+
+	// 非桥接方发布的原始载荷
+	client.Publish("cloud/cmd/reboot/now", 1, false, []byte("go"))
+
+	select {
+	case msg := <-received:
+		if msg.Topic != "cmd/reboot/now" || string(msg.Payload) != "go" {
+			t.Fatalf("unexpected inbound message: %s %s", msg.Topic, msg.Payload)
+		}
+		if msg.GetHeader(HeaderMQTTQoS) != "1" || msg.GetHeader(HeaderVia) != "edge" {
+			t.Fatalf("unexpected inbound headers: %v", msg.Headers)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("inbound message not received")
+	}
+
+	// 普通的JSON对象不是桥接封装，按原始载荷处理
+	for _, payload := range []string{`{"temp":21.5}`, `{"id":"1","payload":"AA=="}`} {
+		client.Publish("cloud/cmd/report", 0, false, []byte(payload))
+		select {
+		case msg := <-received:
+			if string(msg.Payload) != payload {
+				t.Fatalf("expected raw payload %s, got %q", payload, msg.Payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("inbound json message not received")
+		}
+	}
+}
+
+func TestBridge_InboundAuthorized(t *testing.T) {
+	client := newFakeClient()
+	broker, b := startBridge(t, client, Rule{Direction: Inbound, Local: "cmd/#", Remote: "cloud/cmd/#"})
+	broker.SetAuthorizer(mq.NewRuleAuthorizer(mq.Deny,
+		mq.AccessRule{Effect: mq.Allow, Principals: []string{b.SubscriberID()}, Actions: []mq.Action{mq.ActionPublish}, Topics: []mq.Topic{"cmd/#"}},
+		mq.AccessRule{Effect: mq.Allow, Principals: []string{"device"}, Actions: []mq.Action{mq.ActionSubscribe}, Topics: []mq.Topic{"cmd/#"}},
+	))
+
+	received := make(chan *mq.Message, 1)
+	broker.RegisterSubscriber(mq.NewSubscriber("device"))
+	if err := broker.Subscribe("device", map[mq.Topic]mq.MessageHandler{
+		"cmd/#": func(ctx context.Context, msg *mq.Message) error {
+			received <- msg
+			return nil
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	client.Publish("cloud/cmd/reboot", 0, false, []byte("go"))
+	select {
+	case msg := <-received:
+		if msg.SenderID != "bridge_edge" {
+			t.Fatalf("unexpected sender %q", msg.SenderID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("inbound message rejected by authorizer")
+	}
+	if denied := broker.GetStats().Denied; denied != 0 {
+		t.Fatalf("expected no denied access, got %d", denied)
+	}
+}
+
+func TestBridge_LoopPrevention(t *testing.T) {
+	client := newFakeClient()
+	broker, _ := startBridge(t, client,
+		Rule{Direction: Outbound, Local: "sync/#", Remote: "shared/#"},
+		Rule{Direction: Inbound, Local: "sync/#", Remote: "shared/#"},
+	)
+
+	var local int32
+	broker.RegisterSubscriber(mq.NewSubscriber("observer"))
+	broker.Subscribe("observer", map[mq.Topic]mq.MessageHandler{
+		"sync/#": func(ctx context.Context, msg *mq.Message) error {
+			atomic.AddInt32(&local, 1)
+			return nil
+		},
+	})
+
+	// 本地发布的消息回显时被忽略
+	broker.Publish(mq.NewMessage("sync/a", []byte("local")))
+	waitFor(t, 2*time.Second, func() bool { return len(client.publishedTopics()) == 1 })
+
+	// 其他桥接发出的消息进入本地，但不会被发回MQTT
+	foreign, _ := (&Bridge{config: &Config{ID: "cloud", Envelope: true}}).encode(mq.NewMessage("sync/b", []byte("remote")))
+	client.Publish("shared/b", 0, false, foreign)
+
+	waitFor(t, 2*time.Second, func() bool { return atomic.LoadInt32(&local) == 2 })
+	time.Sleep(100 * time.Millisecond)
+	if topics := client.publishedTopics(); len(topics) != 2 {
+		t.Fatalf("expected 2 mqtt publishes without loop, got %v", topics)
+	}
+	if got := atomic.LoadInt32(&local); got != 2 {
+		t.Fatalf("expected 2 local deliveries, got %d", got)
+	}
+}
+
+func TestBridge_BufferWhileDisconnected(t *testing.T) {
+	client := newFakeClient()
+	client.setConnected(false)
+	broker, b := startBridge(t, client, Rule{Direction: Outbound, Local: "log/#", Remote: "logs/#"})
+
+	for _, name := range []string{"1", "2", "3"} {
+		broker.Publish(mq.NewMessage(mq.Topic("log/"+name), []byte(name)))
+	}
+	waitFor(t, 2*time.Second, func() bool { return b.Pending() >= 2 })
+	if len(client.publishedTopics()) != 0 {
+		t.Fatal("expected no publish while disconnected")
+	}
+
+	client.setConnected(true)
+	waitFor(t, 2*time.Second, func() bool { return len(client.publishedTopics()) == 3 })
+	topics := client.publishedTopics()
+	for i, expected := range []string{"logs/1", "logs/2", "logs/3"} {
+		if topics[i] != expected {
+			t.Fatalf("expected %s at %d, got %v", expected, i, topics)
+		}
+	}
+	if b.Dropped() != 0 {
+		t.Fatalf("expected no dropped messages, got %d", b.Dropped())
+	}
+}
+
+func TestBridge_FlushOnStop(t *testing.T) {
+	client := newFakeClient()
+	client.setConnected(false)
+	broker, b := startBridge(t, client, Rule{Direction: Outbound, Local: "log/#", Remote: "logs/#"})
+	b.config.FlushTimeout = 2 * time.Second
+
+	for _, name := range []string{"1", "2"} {
+		broker.Publish(mq.NewMessage(mq.Topic("log/"+name), []byte(name)))
+	}
+	waitFor(t, 2*time.Second, func() bool { return b.Pending() >= 1 })
+	// 等待发送协程取走第一条，其余消息进入缓冲
+	time.Sleep(50 * time.Millisecond)
+
+	// 停止时MQTT重新连接，缓冲中的消息在超时前发出
+	time.AfterFunc(50*time.Millisecond, func() { client.setConnected(true) })
+	b.Stop()
+	if topics := client.publishedTopics(); len(topics) != 2 {
+		t.Fatalf("expected buffered messages flushed on stop, got %v", topics)
+	}
+	if b.Dropped() != 0 {
+		t.Fatalf("expected no dropped messages, got %d", b.Dropped())
+	}
+}
+
+func TestBridge_StopDropped(t *testing.T) {
+	client := newFakeClient()
+	client.setConnected(false)
+	broker, b := startBridge(t, client, Rule{Direction: Outbound, Local: "log/#", Remote: "logs/#"})
+	b.config.FlushTimeout = 50 * time.Millisecond
+
+	for _, name := range []string{"1", "2", "3"} {
+		broker.Publish(mq.NewMessage(mq.Topic("log/"+name), []byte(name)))
+	}
+	waitFor(t, 2*time.Second, func() bool { return b.Pending() >= 2 })
+	// 等待发送协程取走第一条，其余消息进入缓冲
+	time.Sleep(50 * time.Millisecond)
+
+	// 超时仍未发出的消息计入丢弃数量，包括发送协程正在重试的一条
+	b.Stop()
+	if len(client.publishedTopics()) != 0 {
+		t.Fatal("expected no publish while disconnected")
+	}
+	if b.Dropped() != 3 || b.Pending() != 0 {
+		t.Fatalf("expected 3 dropped messages, got %d, pending %d", b.Dropped(), b.Pending())
+	}
+}
@@ -0,0 +1,77 @@
+package bridge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Yui100901/MyGo/mq"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/12 10 10
+//
+
+// validateMapping 校验两个主题模式的通配符能一一对应
+func validateMapping(from, to string) error {
+	if err := mq.Topic(from).Validate(); err != nil {
+		return fmt.Errorf("invalid topic pattern %s: %w", from, err)
+	}
+	if err := mq.Topic(to).Validate(); err != nil {
+		return fmt.Errorf("invalid topic pattern %s: %w", to, err)
+	}
+	if wildcards(from) != wildcards(to) {
+		return fmt.Errorf("wildcards of %s and %s do not match", from, to)
+	}
+	return nil
+}
+
+// wildcards 返回模式中通配符的顺序
+func wildcards(pattern string) string {
+	var sb strings.Builder
+	for _, level := range strings.Split(pattern, mq.TopicSeparator) {
+		if level == mq.TopicWildcardSingle || level == mq.TopicWildcardMultiLevel {
+			sb.WriteString(level)
+		}
+	}
+	return sb.String()
+}
+
+// mapTopic 用from模式匹配topic，并将通配符捕获的层级按顺序填入to模式
+func mapTopic(topic, from, to string) (string, bool) {
+	if !mq.Topic(from).Matches(mq.Topic(topic)) {
+		return "", false
+	}
+
+	levels := strings.Split(topic, mq.TopicSeparator)
+	captures := make([]string, 0)
+	rest := ""
+	for i, level := range strings.Split(from, mq.TopicSeparator) {
+		if level == mq.TopicWildcardMultiLevel {
+			if i < len(levels) {
+				rest = strings.Join(levels[i:], mq.TopicSeparator)
+			}
+			break
+		}
+		if level == mq.TopicWildcardSingle {
+			captures = append(captures, levels[i])
+		}
+	}
+
+	mapped := make([]string, 0)
+	for _, level := range strings.Split(to, mq.TopicSeparator) {
+		switch level {
+		case mq.TopicWildcardSingle:
+			mapped = append(mapped, captures[0])
+			captures = captures[1:]
+		case mq.TopicWildcardMultiLevel:
+			// a/# 匹配 a 时没有剩余层级
+			if rest != "" {
+				mapped = append(mapped, rest)
+			}
+		default:
+			mapped = append(mapped, level)
+		}
+	}
+	return strings.Join(mapped, mq.TopicSeparator), true
+}
@@ -5,8 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Yui100901/MyGo/concurrency"
-	"log"
-	"os"
+	"github.com/Yui100901/MyGo/log_utils"
+	"log/slog"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -19,9 +20,21 @@ import (
 
 // BrokerConfig 消息代理配置
 type BrokerConfig struct {
-	MaxConcurrency  int           // 最大并发处理消息数量
-	CleanupInterval time.Duration // 清理过期消息的间隔时间
-	QueueSize       int           // 消息队列缓冲区大小
+	MaxConcurrency     int              // 最大并发处理消息数量
+	CleanupInterval    time.Duration    // 清理过期消息的间隔时间
+	QueueSize          int              // 消息队列缓冲区大小
+	PriorityQueueSizes map[Priority]int // 各优先级队列的缓冲区大小，未配置的优先级使用QueueSize
+	PriorityWeights    map[Priority]int // 各优先级每轮的分发份额，未配置的优先级使用DefaultPriorityWeights
+	KeyPartitions      int              // 有序消息的分区数量，每个分区由一个分发协程顺序处理
+	WAL                *WALConfig       // 预写日志配置，为nil时消息仅保存在内存中
+	History            *HistoryConfig   // 主题历史配置，为nil时不保存历史
+	Dedup              *DedupConfig     // 消息去重配置，为nil时不去重
+	RetryPolicy        *RetryPolicy     // 订阅者默认的重试策略
+	GroupStrategy      GroupStrategy    // 消费者组默认的负载均衡策略
+	LatencyBuckets     []float64        // 处理耗时直方图的桶上界（秒），为空时使用DefaultLatencyBuckets
+	ScheduleFile       string           // 周期性发布计划的保存文件，为空时计划仅保存在内存中
+	DelayedFile        string           // Drain时保存未到期延迟消息的文件，启动时恢复；启用预写日志时无需配置
+	TimerTick          time.Duration    // 时间轮的tick，即延迟消息和周期计划的触发精度
 }
 
 // DefaultBrokerConfig 返回默认的代理配置
@@ -30,49 +43,98 @@ func DefaultBrokerConfig() *BrokerConfig {
 		MaxConcurrency:  100,
 		CleanupInterval: 1 * time.Minute,
 		QueueSize:       1000,
+		KeyPartitions:   16,
+		TimerTick:       10 * time.Millisecond,
+		RetryPolicy:     DefaultRetryPolicy(),
+		GroupStrategy:   GroupStrategyRoundRobin,
 	}
 }
 
 // MessageBroker 消息代理，负责消息的路由、分发和管理
 type MessageBroker struct {
-	config              *BrokerConfig                             // 代理配置
-	subscriptionManager *SubscriptionManager                      // 订阅关系管理
-	subscribers         *concurrency.SafeMap[string, *Subscriber] // 订阅者注册表: subscriberID -> subscriberInterface
-	messages            *concurrency.SafeMap[string, *Message]    // 消息存储: messageID -> Message
-	pendingMessages     chan *Message                             // 待处理消息队列
-	deliveryTimers      *concurrency.SafeMap[string, *time.Timer] // 消息投递超时定时器
-
-	ctx    context.Context    // 上下文，用于控制组件生命周期
-	cancel context.CancelFunc // 取消函数
-	wg     sync.WaitGroup     // 等待组，用于优雅关闭
-
-	msgCounter int64 // 消息计数器，用于生成唯一ID
-	running    int32 // 运行状态标志（原子操作）
-	logger     *log.Logger
+	config              *BrokerConfig                                // 代理配置
+	subscriptionManager *SubscriptionManager                         // 订阅关系管理
+	subscribers         *concurrency.SafeMap[string, *Subscriber]    // 订阅者注册表: subscriberID -> subscriberInterface
+	groups              *concurrency.SafeMap[string, *ConsumerGroup] // 消费者组: groupName -> group
+	messages            *concurrency.SafeMap[string, *Message]       // 消息存储: messageID -> Message
+	retained            *concurrency.SafeMap[Topic, *Message]        // 保留消息: topic -> 最后一条保留消息
+	pendingMessages     *priorityQueue                               // 待处理消息的多级优先级队列
+	keyedMessages       []chan *Message                              // 有序消息分区队列，按排序键哈希选择
+	deliveryTimers      *concurrency.SafeMap[string, *WheelTimer]    // 延迟消息的投递定时器
+	timingWheel         *TimingWheel                                 // 延迟消息和周期计划共用的时间轮
+	wal                 *WAL                                         // 预写日志，未启用时为nil
+	history             *topicHistory                                // 主题历史，未启用时为nil
+	dedup               *dedupStore                                  // 去重键存储，未启用时为nil
+	inbox               *rpcInbox                                    // 请求/响应收件箱
+	metrics             *brokerMetrics                               // 运行指标
+	interceptors        []PublishInterceptor                         // 发布拦截器链
+	interceptorsMu      sync.RWMutex
+	authorizer          Authorizer // 发布和订阅的授权检查，为nil时不检查
+	authorizerMu        sync.RWMutex
+	schedules           *concurrency.SafeMap[string, *scheduleEntry] // 周期性发布计划: scheduleID -> entry
+	scheduleFileMu      sync.Mutex
+
+	queueMu     sync.RWMutex // 保护分发队列的关闭，入队时持有读锁
+	queueClosed bool         // 分发队列是否已关闭
+
+	ctx          context.Context    // 上下文，用于控制组件生命周期
+	cancel       context.CancelFunc // 取消函数
+	wg           sync.WaitGroup     // 等待组，用于优雅关闭
+	distributors sync.WaitGroup     // 分发协程的等待组，Drain时等待队列分发完成
+
+	msgCounter int64        // 接收的消息总数（含被去重丢弃的消息，原子操作）
+	running    int32        // 运行状态标志（原子操作）
+	draining   int32        // 优雅关闭中标志（原子操作）
+	direct     int32        // 优雅关闭期间绕过队列、尚未分发完成的消息数量（原子操作）
+	logHandler slog.Handler // 日志处理器，内部创建的订阅者等组件共用
+	logger     *slog.Logger
 }
 
-// NewMessageBroker 创建新的消息代理实例
-func NewMessageBroker(config *BrokerConfig) *MessageBroker {
+// NewMessageBroker 创建新的消息代理实例，opts配置日志输出
+func NewMessageBroker(config *BrokerConfig, opts ...log_utils.Option) *MessageBroker {
 	if config == nil {
 		config = DefaultBrokerConfig()
 	}
 
+	if config.KeyPartitions <= 0 {
+		config.KeyPartitions = 1
+	}
+	keyedMessages := make([]chan *Message, config.KeyPartitions)
+	for i := range keyedMessages {
+		keyedMessages[i] = make(chan *Message, config.QueueSize)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
+	logHandler := log_utils.NewHandler(opts...)
 
 	broker := &MessageBroker{
 		config:              config,
 		subscriptionManager: NewSubscriptionManager(),
 		subscribers:         concurrency.NewSafeMap[string, *Subscriber](32),
+		groups:              concurrency.NewSafeMap[string, *ConsumerGroup](32),
 		messages:            concurrency.NewSafeMap[string, *Message](32),
-		pendingMessages:     make(chan *Message, config.QueueSize),
-		deliveryTimers:      concurrency.NewSafeMap[string, *time.Timer](32),
+		retained:            concurrency.NewSafeMap[Topic, *Message](32),
+		pendingMessages:     newPriorityQueue(config.QueueSize, config.PriorityQueueSizes, config.PriorityWeights),
+		keyedMessages:       keyedMessages,
+		deliveryTimers:      concurrency.NewSafeMap[string, *WheelTimer](32),
+		timingWheel:         NewTimingWheel(config.TimerTick),
+		inbox:               newRPCInbox(),
+		metrics:             newBrokerMetrics(config.LatencyBuckets),
+		schedules:           concurrency.NewSafeMap[string, *scheduleEntry](32),
 		ctx:                 ctx,
 		cancel:              cancel,
-		logger:              log.New(os.Stdout, "[MQ-Broker] ", log.LstdFlags),
+		logHandler:          logHandler,
+		logger:              slog.New(logHandler).With("component", "mq-broker"),
+	}
+	if config.History != nil {
+		broker.history = newTopicHistory(config.History)
+	}
+	if config.Dedup != nil {
+		broker.dedup = newDedupStore(config.Dedup)
 	}
 
-	log.Printf("Message broker created with config: MaxConcurrency=%d, QueueSize=%d",
-		config.MaxConcurrency, config.QueueSize)
+	broker.logger.Info("Message broker created",
+		"max_concurrency", config.MaxConcurrency, "queue_size", config.QueueSize)
 	return broker
 }
 
@@ -82,24 +144,58 @@ func (b *MessageBroker) Start() error {
 		return errors.New("broker is already running")
 	}
 
+	// 打开预写日志
+	if b.config.WAL != nil && b.wal == nil {
+		wal, err := OpenWAL(b.config.WAL)
+		if err != nil {
+			atomic.StoreInt32(&b.running, 0)
+			return fmt.Errorf("open wal failed: %w", err)
+		}
+		b.wal = wal
+		b.logger.Info("Opened wal", "dir", b.config.WAL.Dir)
+	}
+
+	// 启动时间轮
+	b.timingWheel.Start()
+
 	// 启动消息分发协程池
 	for i := 0; i < b.config.MaxConcurrency; i++ {
-		b.wg.Add(1)
-		go b.messageDistributor()
+		b.distributors.Add(1)
+		go b.priorityDistributor()
+	}
+	b.logger.Info("Started message distributor", "workers", b.config.MaxConcurrency)
+
+	// 每个有序分区只有一个分发协程，保证同一排序键的消息按顺序分发
+	for _, queue := range b.keyedMessages {
+		b.distributors.Add(1)
+		go b.messageDistributor(queue)
 	}
-	b.logger.Printf("Started message distributor total %d workers", b.config.MaxConcurrency)
+	b.logger.Info("Started keyed message distributor", "partitions", len(b.keyedMessages))
 
 	// 启动清理协程
 	b.wg.Add(1)
 	go b.cleaner()
-	b.logger.Printf("Started cleaner worker")
+	b.logger.Info("Started cleaner worker")
 
 	// 启动监控协程
 	b.wg.Add(1)
 	go b.monitor()
-	b.logger.Printf("Started monitor worker")
+	b.logger.Info("Started monitor worker")
+
+	// 重放未投递完成的消息
+	if b.wal != nil {
+		b.replayWAL()
+	}
 
-	b.logger.Printf("Message broker started successfully")
+	// 恢复上次Drain时保存的延迟消息
+	if err := b.loadDelayed(); err != nil {
+		b.logger.Error("Load delayed messages failed", "error", err)
+	}
+
+	// 恢复周期性发布计划
+	b.startSchedules()
+
+	b.logger.Info("Message broker started successfully")
 	return nil
 }
 
@@ -109,91 +205,305 @@ func (b *MessageBroker) Stop() error {
 		return errors.New("broker is not running")
 	}
 
-	b.logger.Printf("Stopping message broker")
+	b.logger.Info("Stopping message broker")
+
+	// 停止周期性发布计划
+	b.stopSchedules()
 
 	// 发送停止信号
 	b.cancel()
 
 	// 关闭消息队列
-	close(b.pendingMessages)
-	b.logger.Printf("Closed pending messages queue")
+	b.closeQueues()
 
 	// 停止所有定时器
 	timerCount := b.deliveryTimers.Length()
-	b.deliveryTimers.ForEachAsync(func(msgID string, timer *time.Timer) {
-		b.logger.Printf("Stopped delivery timer for message %s", msgID)
+	b.deliveryTimers.ForEachAsync(func(msgID string, timer *WheelTimer) {
+		b.logger.Debug("Stopped delivery timer", "message", msgID)
 		timer.Stop()
 	})
-	b.deliveryTimers = concurrency.NewSafeMap[string, *time.Timer](32)
-	b.logger.Printf("Stopped %d delivery timers", timerCount)
+	b.deliveryTimers = concurrency.NewSafeMap[string, *WheelTimer](32)
+	b.timingWheel.Stop()
+	b.logger.Info("Stopped delivery timers", "count", timerCount)
 
 	// 等待所有协程结束
-	b.logger.Printf("Waiting for all workers to stop")
+	b.logger.Info("Waiting for all workers to stop")
 	b.wg.Wait()
+	b.distributors.Wait()
 
-	b.logger.Printf("Message broker stopped successfully")
+	// 停止订阅者的工作协程
+	b.subscribers.ForEach(func(id string, subscriber *Subscriber) bool {
+		subscriber.stop()
+		return true
+	})
+
+	// 关闭预写日志，未投递完成的消息将在下次启动时重放
+	if b.wal != nil {
+		if err := b.wal.Close(); err != nil {
+			b.logger.Error("Close wal failed", "error", err)
+		}
+	}
+
+	if b.history != nil {
+		if err := b.history.close(); err != nil {
+			b.logger.Error("Close history spill file failed", "error", err)
+		}
+	}
+
+	b.logger.Info("Message broker stopped successfully")
 	return nil
 }
 
 // RegisterSubscriber 注册订阅者
 func (b *MessageBroker) RegisterSubscriber(subscriber *Subscriber) error {
 	subscriberID := subscriber.ID()
+	if err := ValidateID(subscriberID); err != nil {
+		return err
+	}
 	if _, exists := b.subscribers.Get(subscriberID); exists {
-		b.logger.Printf("Subscriber %s already exists, rejecting registration", subscriberID)
+		b.logger.Warn("Subscriber already exists, rejecting registration", "subscriber", subscriberID)
 		return fmt.Errorf("subscriber %s already exists", subscriberID)
 	}
+	subscriber.attach(b.ctx, b.config.RetryPolicy, b.publishDeadLetter, b.metrics)
 	b.subscribers.Set(subscriberID, subscriber)
-	b.logger.Printf("Subscriber %s registered", subscriberID)
+	b.logger.Info("Subscriber registered", "subscriber", subscriberID)
 	return nil
 }
 
 // UnregisterSubscriber 注销订阅者
 func (b *MessageBroker) UnregisterSubscriber(subscriberID string) {
-	_, exists := b.subscribers.Get(subscriberID)
+	subscriber, exists := b.subscribers.Get(subscriberID)
 	if !exists {
-		b.logger.Printf("Subscriber %s not found for unregistration", subscriberID)
+		b.logger.Warn("Subscriber not found for unregistration", "subscriber", subscriberID)
 		return
 	}
 	b.subscriptionManager.RemoveSubscriber(subscriberID)
 	b.subscribers.Delete(subscriberID)
-	return
+	b.metrics.removeSubscriber(subscriberID)
+	subscriber.stop()
 }
 
+// Use 注册发布拦截器，所有发布（包括死信和响应消息）都会经过拦截器链
+func (b *MessageBroker) Use(interceptors ...PublishInterceptor) {
+	b.interceptorsMu.Lock()
+	defer b.interceptorsMu.Unlock()
+	b.interceptors = append(b.interceptors, interceptors...)
+}
+
+// Publish 发布消息
 func (b *MessageBroker) Publish(msg *Message) error {
+	return b.PublishContext(context.Background(), msg)
+}
+
+// PublishContext 携带上下文发布消息，上下文会传递给发布拦截器
+// 设置了授权检查时以消息的SenderID为主体检查发布权限
+func (b *MessageBroker) PublishContext(ctx context.Context, msg *Message) error {
 	if atomic.LoadInt32(&b.running) == 0 {
 		return errors.New("broker is not running")
 	}
+	if b.IsDraining() {
+		return ErrBrokerDraining
+	}
+	if err := b.authorize(msg.SenderID, ActionPublish, msg.Topic); err != nil {
+		return err
+	}
+	return b.publishTrusted(ctx, msg)
+}
 
-	b.logger.Printf("Publishing message from sender %s to topic %s (payload size: %d bytes)",
-		msg.SenderID, msg.Topic, len(msg.Payload))
+// publishTrusted 发布代理内部产生的消息（死信、周期计划），不做授权检查，
+// 优雅关闭期间同样接受，保证处理中的消息转入死信时不会丢失
+func (b *MessageBroker) publishTrusted(ctx context.Context, msg *Message) error {
+	if atomic.LoadInt32(&b.running) == 0 {
+		return errors.New("broker is not running")
+	}
+
+	b.interceptorsMu.RLock()
+	interceptors := b.interceptors
+	b.interceptorsMu.RUnlock()
+	if len(interceptors) == 0 {
+		return b.publish(ctx, msg)
+	}
+	return chainPublish(interceptors, b.publish)(ctx, msg)
+}
+
+// publish 发布拦截器链的末端，校验并写入消息
+func (b *MessageBroker) publish(ctx context.Context, msg *Message) error {
+	if err := msg.Topic.Validate(); err != nil {
+		return err
+	}
+	if msg.Topic.IsWildcard() {
+		return fmt.Errorf("can not publish to wildcard topic %s", msg.Topic)
+	}
+	if msg.ID == "" {
+		msg.ID = NewID()
+	}
+	atomic.AddInt64(&b.msgCounter, 1)
+
+	// 去重窗口内的重复消息直接丢弃，对发布方视为成功
+	dedupAt := time.Now()
+	if b.dedup != nil && b.dedup.seen(msg, dedupAt) {
+		atomic.AddUint64(&b.metrics.deduplicated, 1)
+		b.logger.Debug("Duplicate message dropped", "message", msg.ID, "topic", msg.Topic)
+		return nil
+	}
+
+	b.logger.Debug("Publishing message",
+		"message", msg.ID, "sender", msg.SenderID, "topic", msg.Topic, "size", len(msg.Payload))
+
+	// 先写入预写日志再入队
+	if b.wal != nil {
+		if err := b.wal.Append(msg); err != nil {
+			b.logger.Error("Write message to wal failed", "message", msg.ID, "error", err)
+			b.forgetDedup(msg, dedupAt)
+			return fmt.Errorf("write wal failed: %w", err)
+		}
+	}
 
 	// 存储消息
 	b.messages.Set(msg.ID, msg)
+	if b.history != nil {
+		if err := b.history.record(msg); err != nil {
+			b.logger.Error("Record history failed", "message", msg.ID, "error", err)
+		}
+	}
+
+	if err := b.enqueue(msg); err != nil {
+		if !errors.Is(err, ErrQueueClosed) || !b.IsDraining() {
+			b.forgetDedup(msg, dedupAt)
+			return err
+		}
+		// 优雅关闭期间分发队列已关闭，内部消息直接分发
+		b.distributeDirect(msg)
+	}
+	// 入队成功后才更新保留消息，发布失败的消息不会被之后的订阅者收到
+	b.retain(msg)
+	atomic.AddUint64(&b.metrics.published, 1)
+	return nil
+}
+
+// forgetDedup 发布失败时撤销消息的去重记录，发布方在窗口内重试时不会被当作重复丢弃
+func (b *MessageBroker) forgetDedup(msg *Message, seenAt time.Time) {
+	if b.dedup != nil {
+		b.dedup.forget(msg, seenAt)
+	}
+}
 
-	// 发送消息到分发队列
+// enqueue 发送消息到分发队列，带排序键的消息进入其所属的分区队列，其余消息进入所属优先级的队列
+func (b *MessageBroker) enqueue(msg *Message) error {
+	b.queueMu.RLock()
+	defer b.queueMu.RUnlock()
+	if b.queueClosed {
+		return ErrQueueClosed
+	}
+
+	queue := b.pendingMessages.queue(msg)
+	keyed := false
+	if key := msg.OrderingKey(); key != "" {
+		queue = b.keyedMessages[partitionIndex(key, len(b.keyedMessages))]
+		keyed = true
+	}
 	select {
-	case b.pendingMessages <- msg:
+	case queue <- msg:
 		// 消息发送成功
-		b.logger.Printf("Message %s queued for distribution", msg.ID)
+		if !keyed {
+			b.pendingMessages.signal()
+		}
+		b.logger.Debug("Message queued for distribution", "message", msg.ID)
 		return nil
 	case <-b.ctx.Done():
-		b.logger.Printf("Broker shutting down, cannot publish message %s", msg.ID)
+		b.logger.Warn("Broker shutting down, cannot publish message", "message", msg.ID)
 		return errors.New("broker is shutting down")
 	}
 }
 
+// replayWAL 重放预写日志中未投递完成的消息，延迟消息会重新设置定时器
+func (b *MessageBroker) replayWAL() {
+	pending := b.wal.Pending()
+	if len(pending) == 0 {
+		return
+	}
+	b.logger.Info("Replaying messages from wal", "count", len(pending))
+	for _, msg := range pending {
+		b.messages.Set(msg.ID, msg)
+		if err := b.enqueue(msg); err != nil {
+			return
+		}
+		b.retain(msg)
+	}
+}
+
+// markDone 标记消息已投递完成，从预写日志中移除
+func (b *MessageBroker) markDone(msgID string) {
+	if b.wal == nil {
+		return
+	}
+	if err := b.wal.MarkDone(msgID); err != nil {
+		b.logger.Error("Mark message done in wal failed", "message", msgID, "error", err)
+	}
+}
+
 func (b *MessageBroker) Subscribe(subscriberID string, topicMap map[Topic]MessageHandler) error {
+	return b.SubscribeGroup(subscriberID, "", topicMap)
+}
+
+// SubscribeGroup 以消费者组成员身份订阅，组内每条消息只投递给一个成员
+// group为空时等同于普通的广播订阅；设置了授权检查时任一主题被拒绝则整个订阅失败
+func (b *MessageBroker) SubscribeGroup(subscriberID string, group string, topicMap map[Topic]MessageHandler) error {
 	// 检查订阅者是否存在
 	subscriber, exists := b.subscribers.Get(subscriberID)
 	if !exists {
-		b.logger.Printf("Subscriber %s not found for subscription to topic %v", subscriberID, topicMap)
+		b.logger.Warn("Subscriber not found for subscription", "subscriber", subscriberID)
 		return fmt.Errorf("subscriber %s not found", subscriberID)
 	}
 	for topic := range topicMap {
-		b.subscriptionManager.AddSubscription(subscriberID, topic)
+		if err := b.authorize(subscriberID, ActionSubscribe, topic); err != nil {
+			return err
+		}
+	}
+	return b.subscribeTrusted(subscriber, group, topicMap)
+}
+
+// subscribeTrusted 跳过授权检查的订阅，用于代理内部组件
+func (b *MessageBroker) subscribeTrusted(subscriber *Subscriber, group string, topicMap map[Topic]MessageHandler) error {
+	subscriberID := subscriber.ID()
+	if err := subscriber.SubscribeGroup(group, topicMap); err != nil {
+		return err
+	}
+	if group != "" {
+		b.getOrCreateGroup(group)
+	}
+	patterns := make([]Topic, 0, len(topicMap))
+	for topic := range topicMap {
+		b.subscriptionManager.AddGroupSubscription(subscriberID, group, topic)
+		patterns = append(patterns, topic)
+	}
+	if group == "" {
+		b.deliverRetained(subscriber, patterns)
 	}
+	return nil
+}
 
-	return subscriber.Subscribe(topicMap)
+// SetGroupStrategy 设置消费者组的负载均衡策略
+func (b *MessageBroker) SetGroupStrategy(group string, strategy GroupStrategy) {
+	b.groups.Set(group, NewConsumerGroup(group, strategy))
+	b.logger.Info("Consumer group strategy set", "group", group, "strategy", strategy)
+}
+
+// GetConsumerGroup 获取消费者组
+func (b *MessageBroker) GetConsumerGroup(group string) (*ConsumerGroup, bool) {
+	return b.groups.Get(group)
+}
+
+func (b *MessageBroker) getOrCreateGroup(group string) *ConsumerGroup {
+	var result *ConsumerGroup
+	b.groups.Update(group, func(old *ConsumerGroup) (*ConsumerGroup, bool) {
+		if old == nil {
+			old = NewConsumerGroup(group, b.config.GroupStrategy)
+		}
+		result = old
+		return old, true
+	})
+	return result
 }
 
 // Unsubscribe 取消订阅
@@ -208,7 +518,7 @@ func (b *MessageBroker) Unsubscribe(subscriberID string, topics []Topic) {
 
 	for _, topic := range topics {
 		b.subscriptionManager.RemoveSubscription(subscriberID, topic)
-		b.logger.Printf("Unsubscribed from topic %s", topic)
+		b.logger.Info("Unsubscribed from topic", "topic", topic)
 	}
 	subscriber.Unsubscribe(topics)
 }
@@ -216,26 +526,45 @@ func (b *MessageBroker) Unsubscribe(subscriberID string, topics []Topic) {
 func (b *MessageBroker) CancelDelayedMessage(msgID string) bool {
 	timer, ok := b.deliveryTimers.Get(msgID)
 	if !ok {
-		b.logger.Printf("No delayed message found with ID %s", msgID)
+		b.logger.Debug("No delayed message found", "message", msgID)
 		return false
 	}
 
 	stopped := timer.Stop()
 	if stopped {
-		b.logger.Printf("Successfully cancelled delayed message %s", msgID)
+		b.markDone(msgID)
+		b.logger.Debug("Cancelled delayed message", "message", msgID)
 	} else {
-		b.logger.Printf("Failed to cancel message %s (already triggered)", msgID)
+		b.logger.Debug("Cancel delayed message failed, already triggered", "message", msgID)
 	}
 	b.deliveryTimers.Delete(msgID)
 	return stopped
 }
 
 // messageDistributor 消息分发器协程
-func (b *MessageBroker) messageDistributor() {
-	defer b.wg.Done()
-	b.logger.Printf("Message distributor worker started")
+func (b *MessageBroker) messageDistributor(queue chan *Message) {
+	defer b.distributors.Done()
+	b.logger.Debug("Message distributor worker started")
+
+	for msg := range queue {
+		select {
+		case <-b.ctx.Done():
+			return
+		default:
+			b.distributeMessage(msg)
+		}
+	}
+}
 
-	for msg := range b.pendingMessages {
+// priorityDistributor 从优先级队列中取消息分发的协程
+func (b *MessageBroker) priorityDistributor() {
+	defer b.distributors.Done()
+
+	for {
+		msg, ok := b.pendingMessages.pop()
+		if !ok {
+			return
+		}
 		select {
 		case <-b.ctx.Done():
 			return
@@ -249,17 +578,20 @@ func (b *MessageBroker) messageDistributor() {
 func (b *MessageBroker) distributeMessage(msg *Message) {
 	if msg.IsExpired() {
 		b.messages.Delete(msg.ID)
-		b.logger.Printf("Message %s expired before distribution", msg.ID)
+		b.markDone(msg.ID)
+		atomic.AddUint64(&b.metrics.expired, 1)
+		b.logger.Debug("Message expired before distribution", "message", msg.ID)
 		return
 	}
 
-	b.logger.Printf("Distributing message %s for topic %s", msg.ID, msg.Topic)
+	b.logger.Debug("Distributing message", "message", msg.ID, "topic", msg.Topic)
 	if msg.Delay > 0 {
-		b.logger.Printf("Message %s scheduled for delayed delivery in %s", msg.ID, msg.Delay)
+		b.logger.Debug("Message scheduled for delayed delivery", "message", msg.ID, "delay", msg.Delay)
 
-		timer := time.AfterFunc(msg.DeliverAt.Sub(time.Now()), func() {
+		timer := b.timingWheel.AfterFunc(time.Until(msg.DeliverAt), func() {
 			b.deliveryTimers.Delete(msg.ID) // 清理定时器
-			b.logger.Printf("Delayed delivery triggered for message %s", msg.ID)
+			b.logger.Debug("Delayed delivery triggered", "message", msg.ID)
+			b.updateRetained(msg)
 			b.sendToSubscriber(msg)
 		})
 
@@ -271,30 +603,92 @@ func (b *MessageBroker) distributeMessage(msg *Message) {
 }
 
 func (b *MessageBroker) sendToSubscriber(msg *Message) {
-	// 确定目标订阅者
-	subscriberIDs := b.subscriptionManager.GetTopicSubscribers(msg.Topic)
+	// 通过订阅树确定目标订阅者及其命中的订阅模式
+	matches := b.subscriptionManager.MatchSubscriptions(msg.Topic)
 	//没有目标订阅者直接丢弃消息
-	if len(subscriberIDs) == 0 {
-		b.logger.Printf("No subscribers found for topic %s, message %s discarded", msg.Topic, msg.ID)
+	if len(matches) == 0 {
+		b.logger.Debug("No subscribers found, message discarded", "message", msg.ID, "topic", msg.Topic)
 		b.messages.Delete(msg.ID)
+		b.markDone(msg.ID)
 		return
 	}
 
-	targetSubscribers := make([]*Subscriber, 0, len(subscriberIDs))
-	for _, cid := range subscriberIDs {
-		if subscriber, exists := b.subscribers.Get(cid); exists {
-			targetSubscribers = append(targetSubscribers, subscriber)
+	// 普通订阅广播给所有订阅者，消费者组订阅按组归类
+	subscriberPatterns := make(map[string][]Topic)
+	groupPatterns := make(map[string]map[string][]Topic) // group -> subscriberID -> patterns
+	for _, match := range matches {
+		if match.Group == "" {
+			subscriberPatterns[match.SubscriberID] = append(subscriberPatterns[match.SubscriberID], match.Pattern)
+			continue
+		}
+		if groupPatterns[match.Group] == nil {
+			groupPatterns[match.Group] = make(map[string][]Topic)
+		}
+		groupPatterns[match.Group][match.SubscriberID] = append(groupPatterns[match.Group][match.SubscriberID], match.Pattern)
+	}
+
+	// 每个消费者组只选出一个成员
+	for groupName, members := range groupPatterns {
+		candidates := make([]*Subscriber, 0, len(members))
+		for subscriberID := range members {
+			if subscriber, exists := b.subscribers.Get(subscriberID); exists {
+				candidates = append(candidates, subscriber)
+			}
+		}
+		selected := b.getOrCreateGroup(groupName).pick(msg, candidates)
+		if selected == nil {
+			continue
 		}
+		subscriberPatterns[selected.ID()] = append(subscriberPatterns[selected.ID()], members[selected.ID()]...)
 	}
 
+	// 所有处理函数确认（成功或转入死信）后才从预写日志中移除
+	tracker := newDeliveryTracker(func() {
+		b.markDone(msg.ID)
+	})
+
 	// 通知所有订阅的订阅者有新消息
-	for _, subscriber := range targetSubscribers {
+	delivered := 0
+	for subscriberID, patterns := range subscriberPatterns {
+		subscriber, exists := b.subscribers.Get(subscriberID)
+		if !exists {
+			continue
+		}
 		// 创建消息副本
-		msgCopy := *msg
-		subscriber.HandleMessage(&msgCopy)
+		msgCopy := msg.Clone()
+		msgCopy.tracker = tracker
+		subscriber.deliver(msgCopy, patterns)
+		delivered++
+	}
+	tracker.done()
+
+	b.logger.Debug("Message delivered", "message", msg.ID, "subscribers", delivered)
+}
+
+// publishDeadLetter 将重试耗尽的消息转发到死信主题 deadLetter/<原主题>
+func (b *MessageBroker) publishDeadLetter(msg *Message, subscriberID string, reason error) {
+	if msg.Topic.IsDeadLetter() {
+		b.logger.Warn("Dead letter message failed again, discarded", "message", msg.ID)
+		return
 	}
 
-	b.logger.Printf("Delivered to %d subscribers about message %s", len(targetSubscribers), msg.ID)
+	deadLetter := NewMessage(TopicDeadLetterPrefix+msg.Topic, msg.Payload)
+	deadLetter.SenderID = msg.SenderID
+	for k, v := range msg.Headers {
+		deadLetter.SetHeader(k, v)
+	}
+	deadLetter.SetHeader(HeaderDeadLetterReason, reason.Error())
+	deadLetter.SetHeader(HeaderOriginalTopic, string(msg.Topic))
+	deadLetter.SetHeader(HeaderOriginalMessageID, msg.ID)
+	deadLetter.SetHeader(HeaderFailedSubscriber, subscriberID)
+	deadLetter.SetHeader(HeaderAttempts, strconv.Itoa(msg.Attempts))
+
+	if err := b.publishTrusted(context.Background(), deadLetter); err != nil {
+		b.logger.Error("Publish dead letter failed", "message", msg.ID, "error", err)
+		return
+	}
+	atomic.AddUint64(&b.metrics.deadLettered, 1)
+	b.logger.Warn("Message routed to dead letter topic", "message", msg.ID, "topic", deadLetter.Topic)
 }
 
 // GetMessage 获取消息详情
@@ -312,7 +706,7 @@ func (b *MessageBroker) GetMessage(messageID string) (*Message, error) {
 // cleaner 清理过期消息的协程
 func (b *MessageBroker) cleaner() {
 	defer b.wg.Done()
-	b.logger.Printf("Cleaner started with interval %v", b.config.CleanupInterval)
+	b.logger.Debug("Cleaner started", "interval", b.config.CleanupInterval)
 
 	ticker := time.NewTicker(b.config.CleanupInterval)
 	defer ticker.Stop()
@@ -322,7 +716,7 @@ func (b *MessageBroker) cleaner() {
 		case <-ticker.C:
 			b.cleanupExpiredMessages()
 		case <-b.ctx.Done():
-			b.logger.Printf("Cleaner stopping")
+			b.logger.Debug("Cleaner stopping")
 			return
 		}
 	}
@@ -341,17 +735,24 @@ func (b *MessageBroker) cleanupExpiredMessages() {
 
 	for _, id := range msgIdListToDelete {
 		b.messages.Delete(id)
+		b.markDone(id)
 	}
 	cleanedCount := len(msgIdListToDelete)
 	if cleanedCount > 0 {
-		b.logger.Printf("Cleaned up %d expired messages", cleanedCount)
+		b.logger.Debug("Cleaned up expired messages", "count", cleanedCount)
+	}
+
+	if b.dedup != nil {
+		if purged := b.dedup.purge(time.Now()); purged > 0 {
+			b.logger.Debug("Cleaned up expired dedup keys", "count", purged)
+		}
 	}
 }
 
 // monitor 监控协程
 func (b *MessageBroker) monitor() {
 	defer b.wg.Done()
-	b.logger.Printf("Monitor started")
+	b.logger.Debug("Monitor started")
 
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
@@ -360,45 +761,63 @@ func (b *MessageBroker) monitor() {
 		select {
 		case <-ticker.C:
 			stats := b.GetStats()
-			b.logger.Printf("Stats - Subscribers: %v, Topics: %v, Messages: %v, Pending: %v, Timers: %v",
-				stats["total_subscribers"], stats["total_topics"], stats["total_messages"],
-				stats["pending_queue_size"], stats["delivery_timers"])
+			b.logger.Info("Stats",
+				"subscribers", stats.TotalSubscribers, "topics", stats.TotalTopics, "messages", stats.TotalMessages,
+				"pending", stats.PendingQueueSize, "timers", stats.DeliveryTimers)
 		case <-b.ctx.Done():
-			b.logger.Printf("Monitor stopping")
+			b.logger.Debug("Monitor stopping")
 			return
 		}
 	}
 }
 
 // GetStats 获取消息代理的统计信息
-func (b *MessageBroker) GetStats() map[string]interface{} {
+func (b *MessageBroker) GetStats() BrokerStats {
+	stats := BrokerStats{
+		Running:          atomic.LoadInt32(&b.running) == 1,
+		TotalSubscribers: b.subscribers.Length(),
+		TotalTopics:      b.subscriptionManager.GetAllTopicsCount(),
+		TotalMessages:    b.messages.Length(),
+		PendingQueueSize: b.GetPendingMessageCount(),
+		DeliveryTimers:   b.deliveryTimers.Length(),
+		RetainedMessages: b.retained.Length(),
+		Schedules:        b.schedules.Length(),
+		MessageCounter:   atomic.LoadInt64(&b.msgCounter),
+		Published:        atomic.LoadUint64(&b.metrics.published),
+		Delivered:        atomic.LoadUint64(&b.metrics.delivered),
+		Expired:          atomic.LoadUint64(&b.metrics.expired),
+		Failed:           atomic.LoadUint64(&b.metrics.failed),
+		DeadLettered:     atomic.LoadUint64(&b.metrics.deadLettered),
+		Dropped:          atomic.LoadUint64(&b.metrics.dropped),
+		Deduplicated:     atomic.LoadUint64(&b.metrics.deduplicated),
+		Denied:           atomic.LoadUint64(&b.metrics.denied),
+		TopicSubscribers: make(map[Topic]int),
+		SubscriberInbox:  make(map[string]int),
+		HandlerLatency:   make(map[string]HistogramSnapshot),
+		PriorityQueues:   make(map[string]int),
+	}
 
-	stats := map[string]interface{}{
-		"total_subscribers":  b.subscribers.Length(),
-		"total_topic":        b.subscriptionManager.GetAllTopicsCount(),
-		"total_messages":     b.messages.Length(),
-		"pending_queue_size": len(b.pendingMessages),
-		"delivery_timers":    b.deliveryTimers.Length(),
-		"running":            atomic.LoadInt32(&b.running) == 1,
-		"message_counter":    atomic.LoadInt64(&b.msgCounter),
+	// 各优先级队列的积压数量
+	for priority, length := range b.pendingMessages.lengths() {
+		stats.PriorityQueues[priority.String()] = length
 	}
 
-	// 按状态统计消息
-	statusCount := make(map[string]int)
-	b.messages.ForEach(func(id string, msg *Message) bool {
-		statusCount[id] = statusCount[id] + 1
+	// 统计每个主题的订阅者数量
+	for _, topic := range b.subscriptionManager.GetAllTopics() {
+		stats.TopicSubscribers[topic] = b.subscriptionManager.GetSubscribersCount(topic)
+	}
+
+	// 统计每个订阅者收件箱的积压数量
+	b.subscribers.ForEach(func(id string, subscriber *Subscriber) bool {
+		stats.SubscriberInbox[id] = subscriber.InboxDepth()
 		return true
 	})
 
-	stats["message_status"] = statusCount
-
-	// 统计每个主题的订阅者数量
-	topicStats := make(map[Topic]int)
-	topics := b.subscriptionManager.GetAllTopics()
-	for _, topic := range topics {
-		topicStats[topic] = b.subscriptionManager.GetSubscribersCount(topic)
-	}
-	stats["topic_subscribers"] = topicStats
+	// 处理耗时分布
+	b.metrics.latency.ForEach(func(id string, histogram *Histogram) bool {
+		stats.HandlerLatency[id] = histogram.Snapshot()
+		return true
+	})
 
 	return stats
 }
@@ -408,7 +827,11 @@ func (b *MessageBroker) IsRunning() bool {
 }
 
 func (b *MessageBroker) GetPendingMessageCount() int {
-	return len(b.pendingMessages)
+	count := b.pendingMessages.size()
+	for _, queue := range b.keyedMessages {
+		count += len(queue)
+	}
+	return count
 }
 
 func (b *MessageBroker) Shutdown() error {
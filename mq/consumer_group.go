@@ -0,0 +1,109 @@
+package mq
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync/atomic"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/28 10 05
+//
+
+// HeaderMessageKey 消息键，未设置Message.Key时作为排序键和一致性哈希键
+const HeaderMessageKey = "x-message-key"
+
+// GroupStrategy 消费者组内的负载均衡策略
+type GroupStrategy int
+
+const (
+	GroupStrategyRoundRobin     GroupStrategy = iota // 轮询
+	GroupStrategyLeastInFlight                       // 处理中消息最少者优先
+	GroupStrategyConsistentHash                      // 按消息键一致性哈希
+)
+
+// String 返回策略的字符串表示
+func (s GroupStrategy) String() string {
+	switch s {
+	case GroupStrategyRoundRobin:
+		return "ROUND_ROBIN"
+	case GroupStrategyLeastInFlight:
+		return "LEAST_IN_FLIGHT"
+	case GroupStrategyConsistentHash:
+		return "CONSISTENT_HASH"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ConsumerGroup 消费者组，组内每条消息只投递给一个成员
+type ConsumerGroup struct {
+	name     string
+	strategy GroupStrategy
+	counter  uint64 // 轮询计数器
+}
+
+// NewConsumerGroup 创建消费者组
+func NewConsumerGroup(name string, strategy GroupStrategy) *ConsumerGroup {
+	return &ConsumerGroup{
+		name:     name,
+		strategy: strategy,
+	}
+}
+
+// Name 返回组名
+func (g *ConsumerGroup) Name() string {
+	return g.name
+}
+
+// Strategy 返回组的负载均衡策略
+func (g *ConsumerGroup) Strategy() GroupStrategy {
+	return g.strategy
+}
+
+// pick 从候选成员中选出本条消息的接收者
+func (g *ConsumerGroup) pick(msg *Message, members []*Subscriber) *Subscriber {
+	if len(members) == 0 {
+		return nil
+	}
+	// 按ID排序保证选择结果稳定
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].ID() < members[j].ID()
+	})
+
+	switch g.strategy {
+	case GroupStrategyLeastInFlight:
+		selected := members[0]
+		for _, member := range members[1:] {
+			if member.InFlight() < selected.InFlight() {
+				selected = member
+			}
+		}
+		return selected
+	case GroupStrategyConsistentHash:
+		if key := msg.OrderingKey(); key != "" {
+			return pickByRendezvousHash(key, members)
+		}
+	}
+
+	index := atomic.AddUint64(&g.counter, 1) - 1
+	return members[index%uint64(len(members))]
+}
+
+// pickByRendezvousHash 最高随机权重哈希，成员变化时只有少量键会被重新分配
+func pickByRendezvousHash(key string, members []*Subscriber) *Subscriber {
+	var selected *Subscriber
+	var maxWeight uint64
+	for _, member := range members {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(member.ID()))
+		if weight := h.Sum64(); selected == nil || weight > maxWeight {
+			selected = member
+			maxWeight = weight
+		}
+	}
+	return selected
+}
@@ -0,0 +1,151 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/28 14 40
+//
+
+type receiveCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+	keys   map[string]map[string]struct{} // key -> subscribers
+	total  int
+}
+
+func newReceiveCounter() *receiveCounter {
+	return &receiveCounter{counts: make(map[string]int), keys: make(map[string]map[string]struct{})}
+}
+
+func (r *receiveCounter) handler(subscriberID string) MessageHandler {
+	return func(ctx context.Context, msg *Message) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.counts[subscriberID]++
+		r.total++
+		key := msg.GetHeader(HeaderMessageKey)
+		if r.keys[key] == nil {
+			r.keys[key] = make(map[string]struct{})
+		}
+		r.keys[key][subscriberID] = struct{}{}
+		return nil
+	}
+}
+
+func (r *receiveCounter) waitTotal(t *testing.T, total int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		got := r.total
+		r.mu.Unlock()
+		if got >= total {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d deliveries, got %d", total, r.total)
+}
+
+func TestMQ_ConsumerGroupRoundRobin(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	counter := newReceiveCounter()
+	for _, id := range []string{"w1", "w2", "w3"} {
+		b.RegisterSubscriber(NewSubscriber(id))
+		if err := b.SubscribeGroup(id, "workers", map[Topic]MessageHandler{"jobs": counter.handler(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.RegisterSubscriber(NewSubscriber("audit"))
+	b.Subscribe("audit", map[Topic]MessageHandler{"jobs": counter.handler("audit")})
+
+	for i := 0; i < 30; i++ {
+		b.Publish(NewMessage("jobs", []byte(fmt.Sprintf("job %d", i))))
+	}
+	counter.waitTotal(t, 60)
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	if counter.counts["audit"] != 30 {
+		t.Fatalf("plain subscriber should receive every message, got %d", counter.counts["audit"])
+	}
+	for _, id := range []string{"w1", "w2", "w3"} {
+		if counter.counts[id] != 10 {
+			t.Fatalf("expected round robin to deliver 10 messages to %s, got %v", id, counter.counts)
+		}
+	}
+}
+
+func TestMQ_ConsumerGroupConsistentHash(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+	b.SetGroupStrategy("workers", GroupStrategyConsistentHash)
+
+	counter := newReceiveCounter()
+	for _, id := range []string{"w1", "w2", "w3"} {
+		b.RegisterSubscriber(NewSubscriber(id))
+		b.SubscribeGroup(id, "workers", map[Topic]MessageHandler{"device/+": counter.handler(id)})
+	}
+
+	for i := 0; i < 40; i++ {
+		msg := NewMessage(Topic(fmt.Sprintf("device/%d", i)), nil)
+		msg.SetHeader(HeaderMessageKey, fmt.Sprintf("key-%d", i%5))
+		b.Publish(msg)
+	}
+	counter.waitTotal(t, 40)
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	for key, subscribers := range counter.keys {
+		if len(subscribers) != 1 {
+			t.Fatalf("key %s was delivered to %d members", key, len(subscribers))
+		}
+	}
+}
+
+func TestMQ_ConsumerGroupConflict(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	counter := newReceiveCounter()
+	b.RegisterSubscriber(NewSubscriber("w1"))
+	if err := b.Subscribe("w1", map[Topic]MessageHandler{"device/+": counter.handler("w1")}); err != nil {
+		t.Fatal(err)
+	}
+	// 同一订阅者对同一主题的组订阅与普通订阅冲突，拒绝且不影响已有订阅
+	if err := b.SubscribeGroup("w1", "workers", map[Topic]MessageHandler{
+		"device/+": counter.handler("w1"),
+		"other/+":  counter.handler("w1"),
+	}); err == nil {
+		t.Fatal("expected conflicting group subscription to be rejected")
+	}
+	if err := b.SubscribeGroup("w1", "", map[Topic]MessageHandler{"device/+": counter.handler("w1")}); err != nil {
+		t.Fatalf("resubscribing with the same group should succeed: %v", err)
+	}
+
+	b.RegisterSubscriber(NewSubscriber("w2"))
+	b.SubscribeGroup("w2", "workers", map[Topic]MessageHandler{"device/+": counter.handler("w2")})
+	for i := 0; i < 4; i++ {
+		b.Publish(NewMessage(Topic(fmt.Sprintf("device/%d", i)), nil))
+	}
+	b.Publish(NewMessage("other/1", nil))
+	counter.waitTotal(t, 8)
+	time.Sleep(50 * time.Millisecond)
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	if counter.counts["w1"] != 4 || counter.counts["w2"] != 4 {
+		t.Fatalf("unexpected deliveries %v", counter.counts)
+	}
+}
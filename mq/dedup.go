@@ -0,0 +1,155 @@
+package mq
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/Yui100901/MyGo/concurrency"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/18 09 50
+//
+
+// HeaderIdempotencyKey 生产者提供的幂等键，同一主题下相同幂等键的消息在去重窗口内只发布一次
+const HeaderIdempotencyKey = "x-idempotency-key"
+
+// DedupConfig 消息去重配置
+type DedupConfig struct {
+	Window      time.Duration // 去重窗口，从首次发布开始计算
+	MaxEntries  int           // 最多记录的去重键数量，超出时淘汰最早记录的键
+	HashPayload bool          // 没有幂等键的消息是否按载荷哈希去重，默认关闭，开启后同一发布方在窗口内发布的相同载荷只保留一条
+}
+
+// DefaultDedupConfig 返回默认的去重配置
+func DefaultDedupConfig() *DedupConfig {
+	return &DedupConfig{
+		Window:      5 * time.Minute,
+		MaxEntries:  100000,
+		HashPayload: false,
+	}
+}
+
+// dedupEntry 去重键的记录顺序
+type dedupEntry struct {
+	key    string
+	seenAt time.Time
+}
+
+// dedupStore 带过期时间和容量上限的去重键存储
+type dedupStore struct {
+	config  *DedupConfig
+	entries *concurrency.SafeMap[string, time.Time] // 去重键 -> 首次发布时间
+
+	// 按记录顺序保存去重键，用于过期清理和容量淘汰
+	mu    sync.Mutex
+	order []dedupEntry
+}
+
+func newDedupStore(config *DedupConfig) *dedupStore {
+	if config.Window <= 0 {
+		config.Window = DefaultDedupConfig().Window
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultDedupConfig().MaxEntries
+	}
+	return &dedupStore{
+		config:  config,
+		entries: concurrency.NewSafeMap[string, time.Time](32),
+	}
+}
+
+// keyOf 返回消息的去重键，幂等键限定在主题内，载荷哈希限定在主题和发布方内，不参与去重时返回空
+// 代理自身产生的周期计划消息和死信消息不参与去重，
+// 请求和响应消息只按显式的幂等键去重，相同载荷的多次请求各自需要响应
+func (s *dedupStore) keyOf(msg *Message) string {
+	if msg.Topic.IsDeadLetter() || msg.GetHeader(HeaderScheduleID) != "" {
+		return ""
+	}
+	if key := msg.GetHeader(HeaderIdempotencyKey); key != "" {
+		return "key:" + string(msg.Topic) + "\x00" + key
+	}
+	if !s.config.HashPayload {
+		return ""
+	}
+	if msg.GetHeader(HeaderCorrelationID) != "" || msg.GetHeader(HeaderReplyTo) != "" {
+		return ""
+	}
+	sum := sha256.Sum256(msg.Payload)
+	return "hash:" + string(msg.Topic) + "\x00" + msg.SenderID + "\x00" + hex.EncodeToString(sum[:])
+}
+
+// seen 判断消息是否在去重窗口内出现过，未出现过时记录该消息
+func (s *dedupStore) seen(msg *Message, now time.Time) bool {
+	key := s.keyOf(msg)
+	if key == "" {
+		return false
+	}
+
+	duplicate := false
+	s.entries.Update(key, func(seenAt time.Time) (time.Time, bool) {
+		if !seenAt.IsZero() && now.Sub(seenAt) < s.config.Window {
+			duplicate = true
+			return seenAt, true
+		}
+		return now, true
+	})
+	if !duplicate {
+		s.track(key, now)
+	}
+	return duplicate
+}
+
+// forget 撤销seen在now时刻记录的去重键，用于发布失败后允许发布方重试，
+// 键在之后被重新记录过时保留
+func (s *dedupStore) forget(msg *Message, now time.Time) {
+	key := s.keyOf(msg)
+	if key == "" {
+		return
+	}
+	s.evict(dedupEntry{key: key, seenAt: now})
+}
+
+// track 记录去重键的顺序，超出容量时淘汰最早的键
+func (s *dedupStore) track(key string, seenAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.order) >= s.config.MaxEntries {
+		s.pop()
+	}
+	s.order = append(s.order, dedupEntry{key: key, seenAt: seenAt})
+}
+
+// pop 淘汰最早记录的键，调用方需持有锁
+func (s *dedupStore) pop() {
+	s.evict(s.order[0])
+	s.order[0] = dedupEntry{}
+	s.order = s.order[1:]
+}
+
+// evict 删除去重键，键在之后被重新记录过时保留
+func (s *dedupStore) evict(entry dedupEntry) {
+	s.entries.Update(entry.key, func(seenAt time.Time) (time.Time, bool) {
+		return seenAt, !seenAt.IsZero() && !seenAt.Equal(entry.seenAt)
+	})
+}
+
+// purge 清理已超出去重窗口的键
+func (s *dedupStore) purge(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	purged := 0
+	for len(s.order) > 0 && now.Sub(s.order[0].seenAt) >= s.config.Window {
+		s.pop()
+		purged++
+	}
+	return purged
+}
+
+// size 返回记录的去重键数量
+func (s *dedupStore) size() int {
+	return s.entries.Length()
+}
@@ -0,0 +1,193 @@
+package mq
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/18 14 30
+//
+
+func TestDedupStore(t *testing.T) {
+	store := newDedupStore(&DedupConfig{Window: time.Minute, MaxEntries: 2, HashPayload: true})
+	now := time.Now()
+
+	keyed := func(topic Topic, key string, payload string) *Message {
+		msg := NewMessage(topic, []byte(payload))
+		msg.SetHeader(HeaderIdempotencyKey, key)
+		return msg
+	}
+
+	if store.seen(keyed("a", "k1", "x"), now) {
+		t.Fatal("first message reported as duplicate")
+	}
+	// 相同幂等键即使载荷不同也视为重复
+	if !store.seen(keyed("a", "k1", "y"), now) {
+		t.Fatal("expected duplicate idempotency key to be detected")
+	}
+	// 幂等键限定在主题内
+	if store.seen(keyed("b", "k1", "x"), now) {
+		t.Fatal("expected idempotency key to be scoped by topic")
+	}
+
+	// 超出容量时淘汰最早的键
+	if store.seen(NewMessage("a", []byte("payload")), now) {
+		t.Fatal("first payload reported as duplicate")
+	}
+	if store.size() != 2 {
+		t.Fatalf("expected store bounded to 2 keys, got %d", store.size())
+	}
+	if store.seen(keyed("a", "k1", "x"), now) {
+		t.Fatal("expected evicted key to be accepted again")
+	}
+
+	// 超出窗口后不再视为重复
+	if !store.seen(NewMessage("a", []byte("payload")), now.Add(30*time.Second)) {
+		t.Fatal("expected duplicate payload within window")
+	}
+	if store.seen(NewMessage("a", []byte("payload")), now.Add(2*time.Minute)) {
+		t.Fatal("expected payload outside window to be accepted")
+	}
+
+	// 载荷哈希限定在发布方内
+	sent := NewMessage("a", []byte("payload"))
+	sent.SenderID = "device-1"
+	if store.seen(sent, now.Add(2*time.Minute)) {
+		t.Fatal("expected payload hash to be scoped by sender")
+	}
+
+	// 默认不按载荷哈希去重
+	defaults := newDedupStore(DefaultDedupConfig())
+	for i := 0; i < 2; i++ {
+		if defaults.seen(NewMessage("a", []byte("payload")), now) {
+			t.Fatal("expected payload hashing to be disabled by default")
+		}
+	}
+
+	if purged := store.purge(now.Add(time.Hour)); purged == 0 || store.size() != 0 {
+		t.Fatalf("expected all keys purged, purged %d, left %d", purged, store.size())
+	}
+}
+
+func TestMQ_Dedup(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.Dedup = DefaultDedupConfig()
+	config.Dedup.HashPayload = true
+	b := NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+
+	var received int32
+	b.RegisterSubscriber(NewSubscriber("c1"))
+	b.Subscribe("c1", map[Topic]MessageHandler{
+		"device/+": func(ctx context.Context, msg *Message) error {
+			atomic.AddInt32(&received, 1)
+			return nil
+		},
+	})
+
+	// 设备重连后重发同一条消息
+	for i := 0; i < 3; i++ {
+		msg := NewMessage("device/1", []byte("reading"))
+		msg.SetHeader(HeaderIdempotencyKey, "reading-42")
+		if err := b.Publish(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Publish(NewMessage("device/2", []byte("reading")))
+	b.Publish(NewMessage("device/2", []byte("reading")))
+	// 载荷哈希限定在发布方内，不同设备上报相同读数不是重复
+	other := NewMessage("device/2", []byte("reading"))
+	other.SenderID = "device-2"
+	b.Publish(other)
+
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&received) == 3 })
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&received); got != 3 {
+		t.Fatalf("expected 3 unique messages, got %d", got)
+	}
+	if stats := b.GetStats(); stats.Deduplicated != 3 {
+		t.Fatalf("expected 3 duplicates dropped, got %d", stats.Deduplicated)
+	}
+}
+
+func TestMQ_DedupRequests(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.Dedup = DefaultDedupConfig()
+	config.Dedup.HashPayload = true
+	b := NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+
+	// 相同载荷的请求和响应不能被当作重复丢弃
+	b.RegisterSubscriber(NewSubscriber("svc"))
+	b.Respond("svc", map[Topic]RequestHandler{
+		"service/status": func(ctx context.Context, msg *Message) ([]byte, error) {
+			return []byte("ok"), nil
+		},
+	})
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		resp, err := b.Request(ctx, "service/status", []byte("ping"))
+		cancel()
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i+1, err)
+		}
+		if string(resp.Payload) != "ok" {
+			t.Fatalf("unexpected reply %s", resp.Payload)
+		}
+	}
+	if stats := b.GetStats(); stats.Deduplicated != 0 {
+		t.Fatalf("expected no request or reply deduplicated, got %d", stats.Deduplicated)
+	}
+}
+
+func TestMQ_DedupFailedPublish(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.Dedup = DefaultDedupConfig()
+	config.WAL = DefaultWALConfig(t.TempDir())
+	b := NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+
+	var received int32
+	b.RegisterSubscriber(NewSubscriber("c1"))
+	b.Subscribe("c1", map[Topic]MessageHandler{
+		"orders/+": func(ctx context.Context, msg *Message) error {
+			atomic.AddInt32(&received, 1)
+			return nil
+		},
+	})
+
+	newOrder := func() *Message {
+		msg := NewMessage("orders/1", []byte("created"))
+		msg.SetHeader(HeaderIdempotencyKey, "order-1")
+		return msg
+	}
+
+	// 预写日志写入失败时发布失败，重试不能被当作重复丢弃
+	b.wal.Close()
+	if err := b.Publish(newOrder()); err == nil {
+		t.Fatal("expected publish to fail with closed wal")
+	}
+	wal, err := OpenWAL(config.WAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.wal = wal
+	if err := b.Publish(newOrder()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&received) == 1 })
+
+	// 成功发布后重复的消息仍被丢弃
+	b.Publish(newOrder())
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&received); got != 1 {
+		t.Fatalf("expected 1 delivery, got %d", got)
+	}
+}
@@ -0,0 +1,241 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/17 10 20
+//
+
+var (
+	ErrBrokerDraining = errors.New("broker is draining")
+	ErrQueueClosed    = errors.New("broker queue is closed")
+)
+
+// DrainReport 优雅关闭的结果，记录关闭时遗留的消息
+type DrainReport struct {
+	Queued    int            `json:"queued"`    // 截止时仍在分发队列中、未被分发的消息数量
+	InFlight  map[string]int `json:"in_flight"` // 截止时仍未处理完成的消息数量: subscriberID -> count
+	Delayed   int            `json:"delayed"`   // 尚未到期的延迟消息数量
+	Persisted int            `json:"persisted"` // 已持久化、下次启动时恢复的延迟消息数量
+	Duration  time.Duration  `json:"duration"`  // 关闭耗时
+}
+
+// Clean 是否没有遗留任何未持久化的消息
+func (r *DrainReport) Clean() bool {
+	return r.Queued == 0 && len(r.InFlight) == 0 && r.Delayed == r.Persisted
+}
+
+// Drain 优雅关闭消息代理：
+// 拒绝新的发布，分发完队列中已有的消息，在ctx截止前等待处理函数完成（含重试），
+// 保存尚未到期的延迟消息（启用预写日志时保留在日志中，否则写入DelayedFile），然后停止代理。
+// ctx截止时仍会停止代理并返回ctx的错误，遗留的消息记录在返回的报告中。
+func (b *MessageBroker) Drain(ctx context.Context) (*DrainReport, error) {
+	if !atomic.CompareAndSwapInt32(&b.draining, 0, 1) {
+		return nil, ErrBrokerDraining
+	}
+	defer atomic.StoreInt32(&b.draining, 0)
+	if !b.IsRunning() {
+		return nil, errors.New("broker is not running")
+	}
+
+	start := time.Now()
+	b.logger.Info("Draining message broker")
+
+	// 停止周期性发布计划，并关闭队列，分发协程处理完剩余消息后退出
+	b.stopSchedules()
+	b.closeQueues()
+
+	distributed := make(chan struct{})
+	go func() {
+		b.distributors.Wait()
+		close(distributed)
+	}()
+
+	var drainErr error
+	select {
+	case <-distributed:
+		b.logger.Info("All queued messages distributed")
+	case <-ctx.Done():
+		drainErr = ctx.Err()
+	}
+
+	// 等待处理函数完成
+	report := &DrainReport{InFlight: make(map[string]int)}
+	if drainErr == nil {
+		drainErr = b.waitInFlight(ctx)
+	}
+	report.Queued = b.GetPendingMessageCount()
+	b.subscribers.ForEach(func(id string, subscriber *Subscriber) bool {
+		if inFlight := subscriber.InFlight(); inFlight > 0 {
+			report.InFlight[id] = inFlight
+		}
+		return true
+	})
+
+	// 保存尚未到期的延迟消息
+	delayed := b.takeDelayed()
+	report.Delayed = len(delayed)
+	report.Persisted = b.persistDelayed(delayed)
+
+	if err := b.Stop(); err != nil && drainErr == nil {
+		drainErr = err
+	}
+	report.Duration = time.Since(start)
+
+	b.logger.Info("Message broker drained", "duration", report.Duration, "queued", report.Queued,
+		"in_flight_subscribers", len(report.InFlight), "delayed", report.Delayed, "persisted", report.Persisted)
+	return report, drainErr
+}
+
+// IsDraining 是否正在优雅关闭
+func (b *MessageBroker) IsDraining() bool {
+	return atomic.LoadInt32(&b.draining) == 1
+}
+
+// closeQueues 关闭分发队列，之后入队的消息返回ErrQueueClosed而不是向已关闭的通道发送
+func (b *MessageBroker) closeQueues() {
+	b.queueMu.Lock()
+	defer b.queueMu.Unlock()
+	if b.queueClosed {
+		return
+	}
+	b.queueClosed = true
+	b.pendingMessages.close()
+	for _, queue := range b.keyedMessages {
+		close(queue)
+	}
+	b.logger.Info("Closed pending messages queue")
+}
+
+// distributeDirect 队列关闭后直接分发消息（如处理中的消息转入的死信），
+// 在独立协程中分发，避免订阅者收件箱阻塞时卡住调用方的工作协程
+func (b *MessageBroker) distributeDirect(msg *Message) {
+	atomic.AddInt32(&b.direct, 1)
+	go func() {
+		defer atomic.AddInt32(&b.direct, -1)
+		b.distributeMessage(msg)
+	}()
+}
+
+// waitInFlight 等待直接分发的消息进入收件箱，并等待所有订阅者处理完已接收的消息
+func (b *MessageBroker) waitInFlight(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		busy := atomic.LoadInt32(&b.direct) > 0
+		b.subscribers.ForEach(func(id string, subscriber *Subscriber) bool {
+			busy = busy || subscriber.InFlight() > 0
+			return !busy
+		})
+		if !busy {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// takeDelayed 停止所有尚未触发的延迟投递定时器，返回对应的消息，按投递时间排序
+func (b *MessageBroker) takeDelayed() []*Message {
+	delayed := make([]*Message, 0)
+	for _, msgID := range b.deliveryTimers.Keys() {
+		timer, ok := b.deliveryTimers.Pop(msgID)
+		if !ok || !timer.Stop() {
+			continue
+		}
+		if msg, exists := b.messages.Get(msgID); exists {
+			delayed = append(delayed, msg)
+		}
+	}
+	sort.Slice(delayed, func(i, j int) bool {
+		return delayed[i].DeliverAt.Before(delayed[j].DeliverAt)
+	})
+	return delayed
+}
+
+// persistDelayed 保存延迟消息，返回保存的数量
+// 启用预写日志时延迟消息未被标记完成，下次启动时会从日志中重放
+func (b *MessageBroker) persistDelayed(delayed []*Message) int {
+	if len(delayed) == 0 {
+		return 0
+	}
+	if b.wal != nil {
+		return len(delayed)
+	}
+	if b.config.DelayedFile == "" {
+		return 0
+	}
+
+	data, err := json.MarshalIndent(delayed, "", "  ")
+	if err != nil {
+		b.logger.Error("Encode delayed messages failed", "error", err)
+		return 0
+	}
+	if dir := filepath.Dir(b.config.DelayedFile); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			b.logger.Error("Create delayed message dir failed", "error", err)
+			return 0
+		}
+	}
+	tmp := b.config.DelayedFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		b.logger.Error("Write delayed message file failed", "error", err)
+		return 0
+	}
+	if err := os.Rename(tmp, b.config.DelayedFile); err != nil {
+		b.logger.Error("Replace delayed message file failed", "error", err)
+		return 0
+	}
+	return len(delayed)
+}
+
+// loadDelayed 启动时恢复上次关闭时保存的延迟消息，恢复后删除文件
+func (b *MessageBroker) loadDelayed() error {
+	if b.config.DelayedFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(b.config.DelayedFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var delayed []*Message
+	if err := json.Unmarshal(data, &delayed); err != nil {
+		return fmt.Errorf("decode delayed message file failed: %w", err)
+	}
+
+	restored := 0
+	for _, msg := range delayed {
+		if msg.IsExpired() {
+			continue
+		}
+		if b.wal != nil {
+			if err := b.wal.Append(msg); err != nil {
+				return fmt.Errorf("write wal failed: %w", err)
+			}
+		}
+		b.messages.Set(msg.ID, msg)
+		if err := b.enqueue(msg); err != nil {
+			return err
+		}
+		restored++
+	}
+	b.logger.Info("Restored delayed messages", "count", restored, "file", b.config.DelayedFile)
+	return os.Remove(b.config.DelayedFile)
+}
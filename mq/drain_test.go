@@ -0,0 +1,199 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/17 15 00
+//
+
+func TestMQ_Drain(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+
+	var handled int32
+	b.RegisterSubscriber(NewSubscriber("slow"))
+	b.Subscribe("slow", map[Topic]MessageHandler{
+		"jobs": func(ctx context.Context, msg *Message) error {
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&handled, 1)
+			return nil
+		},
+	})
+
+	for i := 0; i < 20; i++ {
+		b.Publish(NewMessage("jobs", []byte("job")))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report, err := b.Drain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&handled); got != 20 {
+		t.Fatalf("expected all 20 messages handled before drain returned, got %d", got)
+	}
+	if !report.Clean() {
+		t.Fatalf("expected clean drain report, got %+v", report)
+	}
+	if b.IsRunning() {
+		t.Fatal("expected broker stopped after drain")
+	}
+}
+
+func TestMQ_DrainDeadLetter(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+
+	// 处理函数在优雅关闭开始后才失败，死信仍需投递
+	b.RegisterSubscriber(NewSubscriber("failing"))
+	b.Subscribe("failing", map[Topic]MessageHandler{
+		"jobs": func(ctx context.Context, msg *Message) error {
+			time.Sleep(50 * time.Millisecond)
+			return Permanent(errors.New("bad job"))
+		},
+	})
+	var deadLetters int32
+	b.RegisterSubscriber(NewSubscriber("dlq"))
+	b.Subscribe("dlq", map[Topic]MessageHandler{
+		TopicDeadLetterPrefix + "jobs": func(ctx context.Context, msg *Message) error {
+			atomic.AddInt32(&deadLetters, 1)
+			return nil
+		},
+	})
+
+	for i := 0; i < 5; i++ {
+		b.Publish(NewMessage("jobs", nil))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report, err := b.Drain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&deadLetters); got != 5 {
+		t.Fatalf("expected 5 dead letters delivered during drain, got %d", got)
+	}
+	if !report.Clean() {
+		t.Fatalf("expected clean drain report, got %+v", report)
+	}
+}
+
+func TestMQ_DrainDeadline(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{}, 1)
+	b.RegisterSubscriber(NewSubscriber("stuck"))
+	b.Subscribe("stuck", map[Topic]MessageHandler{
+		"jobs": func(ctx context.Context, msg *Message) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		},
+	})
+	b.Publish(NewMessage("jobs", nil))
+	<-started
+
+	// 排空期间拒绝新的发布
+	publishErr := make(chan error, 1)
+	go func() {
+		for !b.IsDraining() {
+			time.Sleep(time.Millisecond)
+		}
+		publishErr <- b.Publish(NewMessage("jobs", nil))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	report, err := b.Drain(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if report.InFlight["stuck"] != 1 {
+		t.Fatalf("expected 1 in-flight message left behind, got %+v", report.InFlight)
+	}
+	if err := <-publishErr; !errors.Is(err, ErrBrokerDraining) {
+		t.Fatalf("expected publish during drain to be rejected, got %v", err)
+	}
+}
+
+func TestMQ_DrainPersistDelayed(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "delayed.json")
+	config := DefaultBrokerConfig()
+	config.DelayedFile = file
+
+	b := NewMessageBroker(config)
+	b.Start()
+	msg := NewMessage("reminder", []byte("later"))
+	msg.SetDelay(300 * time.Millisecond)
+	b.Publish(msg)
+	waitFor(t, time.Second, func() bool { return b.deliveryTimers.Length() == 1 })
+
+	report, err := b.Drain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Delayed != 1 || report.Persisted != 1 {
+		t.Fatalf("expected 1 persisted delayed message, got %+v", report)
+	}
+
+	restarted := NewMessageBroker(config)
+	received := make(chan *Message, 1)
+	restarted.RegisterSubscriber(NewSubscriber("c1"))
+	restarted.Subscribe("c1", map[Topic]MessageHandler{
+		"reminder": func(ctx context.Context, msg *Message) error {
+			received <- msg
+			return nil
+		},
+	})
+	restarted.Start()
+	defer restarted.Stop()
+
+	select {
+	case got := <-received:
+		if got.ID != msg.ID || time.Now().Before(msg.DeliverAt) {
+			t.Fatalf("unexpected restored delivery of %s at %s", got.ID, time.Now())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("delayed message not restored after restart")
+	}
+}
+
+func TestMQ_PublishDuringStop(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					// 停止后返回错误，不能因向已关闭的队列发送而panic
+					_ = b.Publish(NewMessage("busy", nil))
+				}
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	b.Stop()
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,637 @@
+package mq
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yui100901/MyGo/concurrency"
+	"github.com/Yui100901/MyGo/log_utils"
+	"github.com/Yui100901/MyGo/network/tcp_utils"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/26 10 15
+//
+
+// HeaderFederationPath 消息经过的节点ID，以逗号分隔，第一个为发布消息的节点
+const HeaderFederationPath = "x-federation-path"
+
+// federationSubscriberPrefix 为每个对等节点注册的转发订阅者ID前缀，其订阅不计入本节点的订阅兴趣
+const federationSubscriberPrefix = "federation_"
+
+// 节点之间的协议帧类型
+const (
+	frameHello    frameType = "hello"    // 握手，交换节点ID
+	frameInterest frameType = "interest" // 通告订阅兴趣
+	frameForward  frameType = "forward"  // 转发消息
+)
+
+// federationFrame 节点之间的协议帧
+type federationFrame struct {
+	Type     frameType     `json:"type"`
+	NodeID   string        `json:"node_id,omitempty"`  // 发送方节点ID，仅握手时携带
+	Token    string        `json:"token,omitempty"`    // 集群共享令牌，仅握手时携带
+	Interest map[Topic]int `json:"interest,omitempty"` // 订阅模式 -> 到达订阅者还需的转发次数
+	Message  *Message      `json:"message,omitempty"`  // 转发的消息
+	Error    string        `json:"error,omitempty"`    // 握手失败原因
+}
+
+// FederationConfig 集群联邦配置
+type FederationConfig struct {
+	NodeID            string        // 本节点ID，集群内唯一
+	Listen            string        // 监听地址，为空时不接受其他节点的连接
+	Peers             []string      // 静态对等节点地址，与每个节点保持一条连接
+	Token             string        // 集群共享令牌，不为空时对等节点必须携带相同的令牌
+	MaxHops           int           // 消息最多被转发的次数
+	SyncInterval      time.Duration // 订阅兴趣的同步间隔
+	ReconnectInterval time.Duration // 断线重连间隔
+	DialTimeout       time.Duration // 连接对等节点的超时时间
+	SeenWindow        time.Duration // 已接收消息ID的保留时间，用于丢弃经不同路径到达的重复消息
+}
+
+// DefaultFederationConfig 返回默认的集群联邦配置
+func DefaultFederationConfig(nodeID string) *FederationConfig {
+	return &FederationConfig{
+		NodeID:            nodeID,
+		MaxHops:           4,
+		SyncInterval:      time.Second,
+		ReconnectInterval: time.Second,
+		DialTimeout:       5 * time.Second,
+		SeenWindow:        time.Minute,
+	}
+}
+
+// FederationStats 集群联邦统计
+type FederationStats struct {
+	Links      []string // 已连接的节点ID
+	Forwarded  uint64   // 转发给其他节点的消息数量
+	Received   uint64   // 从其他节点接收并发布的消息数量
+	Duplicates uint64   // 因重复或回环被丢弃的消息数量
+}
+
+// Federation 将多个消息代理节点组成集群
+// 节点之间通过TCP互联并通告各自的订阅兴趣，消息只转发给有匹配订阅的节点，
+// 经过多个节点转发时由HeaderFederationPath和MaxHops防止回环
+type Federation struct {
+	broker *MessageBroker
+	config *FederationConfig
+
+	mu       sync.Mutex                                    // 保护连接的建立和替换
+	syncMu   sync.Mutex                                    // 保证订阅兴趣按顺序通告
+	links    *concurrency.SafeMap[string, *federationLink] // 节点ID -> 连接
+	seen     *concurrency.SafeMap[string, time.Time]       // 已接收的消息ID -> 接收时间
+	listener net.Listener
+
+	forwarded  uint64
+	received   uint64
+	duplicates uint64
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	stopOnce  sync.Once
+
+	logHandler slog.Handler
+	logger     *slog.Logger
+}
+
+// NewFederation 创建集群联邦，未指定opts时沿用消息代理的日志处理器
+func NewFederation(broker *MessageBroker, config *FederationConfig, opts ...log_utils.Option) (*Federation, error) {
+	if broker == nil {
+		return nil, errors.New("federation requires a broker")
+	}
+	if config == nil || config.NodeID == "" {
+		return nil, errors.New("federation requires a node id")
+	}
+	if strings.Contains(config.NodeID, ",") {
+		return nil, fmt.Errorf("invalid node id %q", config.NodeID)
+	}
+	defaults := DefaultFederationConfig(config.NodeID)
+	if config.MaxHops <= 0 {
+		config.MaxHops = defaults.MaxHops
+	}
+	if config.SyncInterval <= 0 {
+		config.SyncInterval = defaults.SyncInterval
+	}
+	if config.ReconnectInterval <= 0 {
+		config.ReconnectInterval = defaults.ReconnectInterval
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = defaults.DialTimeout
+	}
+	if config.SeenWindow <= 0 {
+		config.SeenWindow = defaults.SeenWindow
+	}
+
+	logHandler := log_utils.NewHandler(append([]log_utils.Option{log_utils.WithHandler(broker.logHandler)}, opts...)...)
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Federation{
+		broker:     broker,
+		config:     config,
+		links:      concurrency.NewSafeMap[string, *federationLink](32),
+		seen:       concurrency.NewSafeMap[string, time.Time](1024),
+		ctx:        ctx,
+		cancel:     cancel,
+		logHandler: logHandler,
+		logger:     slog.New(logHandler).With("component", "mq-federation", "node", config.NodeID),
+	}, nil
+}
+
+// Start 开始监听并连接所有对等节点
+func (f *Federation) Start() error {
+	var err error
+	f.startOnce.Do(func() {
+		if f.config.Listen != "" {
+			f.listener, err = net.Listen("tcp", f.config.Listen)
+			if err != nil {
+				return
+			}
+			f.wg.Add(1)
+			go func() {
+				defer f.wg.Done()
+				_ = tcp_utils.Serve(f.listener, f.serveTCPConn, log_utils.WithHandler(f.logHandler))
+			}()
+		}
+		for _, addr := range f.config.Peers {
+			f.wg.Add(1)
+			go f.dialLoop(addr)
+		}
+		f.wg.Add(1)
+		go f.syncLoop()
+		f.logger.Info("Federation started", "listen", f.Addr(), "peers", len(f.config.Peers))
+	})
+	return err
+}
+
+// Stop 断开所有节点并注销转发订阅者
+func (f *Federation) Stop() {
+	f.stopOnce.Do(func() {
+		f.cancel()
+		if f.listener != nil {
+			_ = f.listener.Close()
+		}
+		links := f.links.Values()
+		for _, link := range links {
+			link.conn.Close()
+		}
+		f.wg.Wait()
+		for _, link := range links {
+			f.unregister(link)
+		}
+		f.logger.Info("Federation stopped")
+	})
+}
+
+// Addr 返回监听地址，未监听时返回空字符串
+func (f *Federation) Addr() string {
+	if f.listener == nil {
+		return ""
+	}
+	return f.listener.Addr().String()
+}
+
+// Links 返回已连接的节点ID
+func (f *Federation) Links() []string {
+	links := f.links.Keys()
+	slices.Sort(links)
+	return links
+}
+
+// RemoteInterest 返回节点通告的订阅模式
+func (f *Federation) RemoteInterest(nodeID string) []Topic {
+	link, ok := f.links.Get(nodeID)
+	if !ok {
+		return nil
+	}
+	patterns := slices.Collect(maps.Keys(link.interestSnapshot()))
+	slices.Sort(patterns)
+	return patterns
+}
+
+// Stats 返回集群联邦统计
+func (f *Federation) Stats() FederationStats {
+	return FederationStats{
+		Links:      f.Links(),
+		Forwarded:  atomic.LoadUint64(&f.forwarded),
+		Received:   atomic.LoadUint64(&f.received),
+		Duplicates: atomic.LoadUint64(&f.duplicates),
+	}
+}
+
+// dialLoop 与对等节点保持连接，断开后按间隔重连
+func (f *Federation) dialLoop(addr string) {
+	defer f.wg.Done()
+	var nodeID string // 握手后得到的节点ID
+	for {
+		// 对方主动建立的连接同样可用，已连接时不重复拨号
+		if _, connected := f.links.Get(nodeID); nodeID == "" || !connected {
+			conn, err := tcp_utils.Dial(addr, f.config.DialTimeout, log_utils.WithHandler(f.logHandler))
+			if err != nil {
+				f.logger.Debug("Dial peer failed", "addr", addr, "error", err)
+			} else {
+				link := f.newLink(newTCPFrameConn(conn), true)
+				if err := link.send(&federationFrame{Type: frameHello, NodeID: f.config.NodeID, Token: f.config.Token}); err != nil {
+					link.conn.Close()
+				} else {
+					link.serve()
+				}
+				if link.nodeID != "" {
+					nodeID = link.nodeID
+				}
+			}
+		}
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-time.After(f.config.ReconnectInterval):
+		}
+	}
+}
+
+// serveTCPConn 处理其他节点主动建立的连接
+func (f *Federation) serveTCPConn(conn *tcp_utils.TCPConn) {
+	f.newLink(newTCPFrameConn(conn), false).serve()
+}
+
+// syncLoop 定期同步订阅兴趣并清理过期的消息ID
+func (f *Federation) syncLoop() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(f.config.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case now := <-ticker.C:
+			f.sync()
+			f.seen.DeleteIf(func(id string, at time.Time) bool {
+				return now.Sub(at) > f.config.SeenWindow
+			})
+		}
+	}
+}
+
+// sync 向每个节点通告发生变化的订阅兴趣
+func (f *Federation) sync() {
+	f.syncMu.Lock()
+	defer f.syncMu.Unlock()
+
+	local := f.localInterest()
+	for _, link := range f.links.Values() {
+		interest := maps.Clone(local)
+		// 其他节点的兴趣加一跳后转告，超出MaxHops的不再传播，使失效的兴趣在环路中最终消失
+		for _, other := range f.links.Values() {
+			if other == link {
+				continue
+			}
+			for pattern, hops := range other.interestSnapshot() {
+				if hops+1 >= f.config.MaxHops {
+					continue
+				}
+				if current, ok := interest[pattern]; !ok || hops+1 < current {
+					interest[pattern] = hops + 1
+				}
+			}
+		}
+		if maps.Equal(interest, link.advertised) {
+			continue
+		}
+		if err := link.send(&federationFrame{Type: frameInterest, Interest: interest}); err != nil {
+			f.logger.Error("Send interest failed", "peer", link.nodeID, "error", err)
+			continue
+		}
+		link.advertised = interest
+	}
+}
+
+// localInterest 返回本节点订阅者的订阅模式，不含转发订阅者
+func (f *Federation) localInterest() map[Topic]int {
+	manager := f.broker.subscriptionManager
+	interest := make(map[Topic]int)
+	for _, subscriberID := range manager.GetAllSubscribers() {
+		if strings.HasPrefix(subscriberID, federationSubscriberPrefix) {
+			continue
+		}
+		for _, pattern := range manager.GetSubscriberTopics(subscriberID) {
+			interest[pattern] = 0
+		}
+	}
+	return interest
+}
+
+// register 登记握手完成的连接，同一节点存在两条连接时保留节点ID较小的一方拨出的连接
+func (f *Federation) register(link *federationLink) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.links.Get(link.nodeID)
+	if ok && link.dialer() > existing.dialer() {
+		return false
+	}
+	f.links.Set(link.nodeID, link)
+	if ok {
+		existing.conn.Close()
+	}
+
+	// 重新创建转发订阅者，订阅在收到对方的兴趣后建立
+	subscriberID := federationSubscriberPrefix + link.nodeID
+	if f.broker.subscribers.Has(subscriberID) {
+		f.broker.UnregisterSubscriber(subscriberID)
+	}
+	if err := f.broker.RegisterSubscriber(NewSubscriber(subscriberID, log_utils.WithHandler(f.logHandler))); err != nil {
+		f.logger.Error("Register forwarding subscriber failed", "peer", link.nodeID, "error", err)
+	}
+	f.logger.Info("Peer connected", "peer", link.nodeID, "remote", link.conn.RemoteAddr(), "outbound", link.outbound)
+	return true
+}
+
+// unregister 连接断开时移除，已被新连接替换时不做处理
+func (f *Federation) unregister(link *federationLink) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if current, ok := f.links.Get(link.nodeID); !ok || current != link {
+		return
+	}
+	f.links.Delete(link.nodeID)
+	f.broker.UnregisterSubscriber(federationSubscriberPrefix + link.nodeID)
+	f.logger.Info("Peer disconnected", "peer", link.nodeID)
+}
+
+// updateInterest 按对方通告的兴趣调整转发订阅者的订阅
+func (f *Federation) updateInterest(link *federationLink, interest map[Topic]int) {
+	f.mu.Lock()
+	if current, ok := f.links.Get(link.nodeID); !ok || current != link {
+		f.mu.Unlock()
+		return
+	}
+	subscriberID := federationSubscriberPrefix + link.nodeID
+	subscriber, ok := f.broker.subscribers.Get(subscriberID)
+	if !ok {
+		f.mu.Unlock()
+		return
+	}
+
+	previous := link.setInterest(interest)
+	var removed []Topic
+	for pattern := range previous {
+		if _, ok := interest[pattern]; !ok {
+			removed = append(removed, pattern)
+		}
+	}
+	added := make(map[Topic]MessageHandler)
+	for pattern := range interest {
+		if _, ok := previous[pattern]; ok {
+			continue
+		}
+		if err := pattern.Validate(); err != nil {
+			f.logger.Warn("Skip invalid interest", "peer", link.nodeID, "topic", pattern, "error", err)
+			continue
+		}
+		added[pattern] = f.forwardHandler(link.nodeID, pattern)
+	}
+	f.broker.Unsubscribe(subscriberID, removed)
+	if err := f.broker.subscribeTrusted(subscriber, "", added); err != nil {
+		f.logger.Error("Subscribe remote interest failed", "peer", link.nodeID, "error", err)
+	}
+	f.mu.Unlock()
+
+	// 兴趣变化需要转告其他节点
+	f.sync()
+}
+
+// forwardHandler 返回将消息转发给节点的处理函数
+func (f *Federation) forwardHandler(nodeID string, pattern Topic) MessageHandler {
+	return func(ctx context.Context, msg *Message) error {
+		link, ok := f.links.Get(nodeID)
+		if !ok {
+			return nil
+		}
+		return link.forward(pattern, msg)
+	}
+}
+
+// receive 发布其他节点转发的消息，重复或回环的消息被丢弃
+func (f *Federation) receive(link *federationLink, msg *Message) {
+	if msg == nil || msg.ID == "" {
+		return
+	}
+	if slices.Contains(federationPath(msg), f.config.NodeID) {
+		atomic.AddUint64(&f.duplicates, 1)
+		return
+	}
+	duplicate := false
+	now := time.Now()
+	f.seen.Update(msg.ID, func(old time.Time) (time.Time, bool) {
+		duplicate = !old.IsZero() && now.Sub(old) <= f.config.SeenWindow
+		if duplicate {
+			return old, true
+		}
+		return now, true
+	})
+	if duplicate {
+		atomic.AddUint64(&f.duplicates, 1)
+		return
+	}
+
+	// 其他节点转发的消息视为外部发布，优雅关闭期间拒绝
+	if f.broker.IsDraining() {
+		f.logger.Warn("Broker draining, forwarded message rejected", "peer", link.nodeID, "message", msg.ID)
+		return
+	}
+	msg.Attempts = 0
+	if err := f.broker.publishTrusted(f.ctx, msg); err != nil {
+		f.logger.Error("Publish forwarded message failed", "peer", link.nodeID, "message", msg.ID, "error", err)
+		return
+	}
+	atomic.AddUint64(&f.received, 1)
+	f.logger.Debug("Received forwarded message", "peer", link.nodeID, "message", msg.ID, "topic", msg.Topic)
+}
+
+// federationPath 返回消息经过的节点ID
+func federationPath(msg *Message) []string {
+	path := msg.GetHeader(HeaderFederationPath)
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ",")
+}
+
+// federationLink 与一个对等节点之间的连接
+type federationLink struct {
+	federation *Federation
+	conn       frameConn
+	outbound   bool   // 是否由本节点拨出
+	nodeID     string // 对方节点ID，握手完成后设置
+
+	mu         sync.RWMutex
+	interest   map[Topic]int // 对方通告的订阅兴趣
+	advertised map[Topic]int // 最近一次通告给对方的订阅兴趣，由syncMu保护
+}
+
+func (f *Federation) newLink(conn frameConn, outbound bool) *federationLink {
+	return &federationLink{federation: f, conn: conn, outbound: outbound}
+}
+
+// dialer 返回拨出该连接的节点ID
+func (l *federationLink) dialer() string {
+	if l.outbound {
+		return l.federation.config.NodeID
+	}
+	return l.nodeID
+}
+
+func (l *federationLink) interestSnapshot() map[Topic]int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.interest
+}
+
+func (l *federationLink) setInterest(interest map[Topic]int) map[Topic]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	previous := l.interest
+	l.interest = interest
+	return previous
+}
+
+// serve 阻塞处理连接上的帧直到连接关闭
+func (l *federationLink) serve() {
+	f := l.federation
+	// 联邦停止时关闭握手尚未完成的连接
+	go func() {
+		select {
+		case <-f.ctx.Done():
+			l.conn.Close()
+		case <-l.conn.Done():
+		}
+	}()
+
+	registered := false
+	if err := l.conn.Serve(func(data []byte) {
+		var frame federationFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			f.logger.Error("Decode frame failed", "remote", l.conn.RemoteAddr(), "error", err)
+			return
+		}
+		if !registered {
+			registered = l.handshake(&frame)
+			if !registered {
+				l.conn.Close()
+			}
+			return
+		}
+		switch frame.Type {
+		case frameInterest:
+			f.updateInterest(l, frame.Interest)
+		case frameForward:
+			f.receive(l, frame.Message)
+		default:
+			f.logger.Warn("Unknown frame type", "peer", l.nodeID, "type", frame.Type)
+		}
+	}); err != nil {
+		f.logger.Debug("Peer connection closed with error", "remote", l.conn.RemoteAddr(), "error", err)
+	}
+	if registered {
+		f.unregister(l)
+	}
+}
+
+// handshake 处理握手帧，被动方校验后回复自己的节点ID
+func (l *federationLink) handshake(frame *federationFrame) bool {
+	f := l.federation
+	if frame.Type != frameHello {
+		return false
+	}
+	if frame.Error != "" {
+		f.logger.Warn("Peer rejected handshake", "remote", l.conn.RemoteAddr(), "error", frame.Error)
+		return false
+	}
+
+	var err error
+	switch {
+	case frame.NodeID == "":
+		err = errors.New("node id can not be empty")
+	case frame.NodeID == f.config.NodeID:
+		err = fmt.Errorf("node id %s conflicts with local node", frame.NodeID)
+	case !l.outbound && f.config.Token != "" && subtle.ConstantTimeCompare([]byte(frame.Token), []byte(f.config.Token)) != 1:
+		err = fmt.Errorf("%w: invalid federation token from %s", ErrUnauthorized, frame.NodeID)
+	}
+	if err != nil {
+		f.logger.Warn("Peer handshake failed", "remote", l.conn.RemoteAddr(), "error", err)
+		if !l.outbound {
+			_ = l.send(&federationFrame{Type: frameHello, Error: err.Error()})
+		}
+		return false
+	}
+
+	l.nodeID = frame.NodeID
+	if !l.outbound {
+		if err := l.send(&federationFrame{Type: frameHello, NodeID: f.config.NodeID}); err != nil {
+			return false
+		}
+	}
+	if !f.register(l) {
+		return false
+	}
+	f.sync()
+	return true
+}
+
+// forward 将命中订阅模式的消息转发给对方
+func (l *federationLink) forward(pattern Topic, msg *Message) error {
+	f := l.federation
+	interest := l.interestSnapshot()
+	hops, ok := interest[pattern]
+	if !ok {
+		return nil
+	}
+	// 同一消息可能命中对方的多个订阅模式，只由排序最小的模式转发一次
+	for other := range interest {
+		if other < pattern && other.Matches(msg.Topic) {
+			return nil
+		}
+	}
+
+	path := federationPath(msg)
+	if slices.Contains(path, l.nodeID) {
+		return nil
+	}
+	if len(path) == 0 || path[len(path)-1] != f.config.NodeID {
+		path = append(path, f.config.NodeID)
+	}
+	// 已转发次数加上本次及对方到达订阅者所需的次数不能超过MaxHops
+	if len(path)+hops > f.config.MaxHops {
+		return nil
+	}
+
+	forwarded := msg.Clone()
+	forwarded.Attempts = 0
+	forwarded.SetHeader(HeaderFederationPath, strings.Join(path, ","))
+	if err := l.send(&federationFrame{Type: frameForward, Message: forwarded}); err != nil {
+		return fmt.Errorf("forward to peer %s failed: %w", l.nodeID, err)
+	}
+	atomic.AddUint64(&f.forwarded, 1)
+	return nil
+}
+
+func (l *federationLink) send(frame *federationFrame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	return l.conn.Send(data)
+}
@@ -0,0 +1,182 @@
+package mq
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/26 16 30
+//
+
+func startFederatedNode(t *testing.T, id string, configure func(*FederationConfig), peers ...*Federation) (*MessageBroker, *Federation) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	t.Cleanup(func() { b.Stop() })
+
+	config := DefaultFederationConfig(id)
+	config.Listen = "127.0.0.1:0"
+	config.SyncInterval = 50 * time.Millisecond
+	config.ReconnectInterval = 50 * time.Millisecond
+	for _, peer := range peers {
+		config.Peers = append(config.Peers, peer.Addr())
+	}
+	if configure != nil {
+		configure(config)
+	}
+	f, err := NewFederation(b, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(f.Stop)
+	return b, f
+}
+
+// countingSubscriber 注册计数订阅者
+func countingSubscriber(t *testing.T, b *MessageBroker, id string, pattern Topic) *int32 {
+	var count int32
+	if err := b.RegisterSubscriber(NewSubscriber(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Subscribe(id, map[Topic]MessageHandler{
+		pattern: func(ctx context.Context, msg *Message) error {
+			atomic.AddInt32(&count, 1)
+			return nil
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return &count
+}
+
+func TestFederation_InterestForwarding(t *testing.T) {
+	b1, f1 := startFederatedNode(t, "n1", nil)
+	b2, f2 := startFederatedNode(t, "n2", nil, f1)
+	waitFor(t, 2*time.Second, func() bool {
+		return slices.Equal(f1.Links(), []string{"n2"}) && slices.Equal(f2.Links(), []string{"n1"})
+	})
+
+	received := countingSubscriber(t, b2, "c2", "sensor/#")
+	waitFor(t, 2*time.Second, func() bool { return slices.Contains(f1.RemoteInterest("n2"), "sensor/#") })
+
+	b1.Publish(NewMessage("sensor/1/temp", []byte("21")))
+	b1.Publish(NewMessage("other/topic", []byte("x")))
+	waitFor(t, 2*time.Second, func() bool { return atomic.LoadInt32(received) == 1 })
+
+	time.Sleep(100 * time.Millisecond)
+	if stats := f1.Stats(); stats.Forwarded != 1 {
+		t.Fatalf("expected only the matching message forwarded, got %d", stats.Forwarded)
+	}
+
+	// 取消订阅后不再转发
+	b2.UnregisterSubscriber("c2")
+	waitFor(t, 2*time.Second, func() bool { return len(f1.RemoteInterest("n2")) == 0 })
+}
+
+func TestFederation_MultiHop(t *testing.T) {
+	// n1 - n2 - n3 链式拓扑，n1与n3之间没有直接连接
+	b1, f1 := startFederatedNode(t, "n1", nil)
+	_, f2 := startFederatedNode(t, "n2", nil, f1)
+	b3, _ := startFederatedNode(t, "n3", nil, f2)
+
+	paths := make(chan string, 10)
+	b3.RegisterSubscriber(NewSubscriber("c3"))
+	b3.Subscribe("c3", map[Topic]MessageHandler{
+		"orders/+": func(ctx context.Context, msg *Message) error {
+			paths <- msg.GetHeader(HeaderFederationPath)
+			return nil
+		},
+	})
+	waitFor(t, 2*time.Second, func() bool { return slices.Contains(f1.RemoteInterest("n2"), "orders/+") })
+
+	b1.Publish(NewMessage("orders/1", nil))
+	select {
+	case path := <-paths:
+		if path != "n1,n2" {
+			t.Fatalf("unexpected federation path %q", path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not forwarded over two hops")
+	}
+}
+
+func TestFederation_MaxHops(t *testing.T) {
+	limit := func(c *FederationConfig) { c.MaxHops = 1 }
+	_, f1 := startFederatedNode(t, "n1", limit)
+	_, f2 := startFederatedNode(t, "n2", limit, f1)
+	b3, f3 := startFederatedNode(t, "n3", limit, f2)
+
+	countingSubscriber(t, b3, "c3", "orders/+")
+	waitFor(t, 2*time.Second, func() bool { return slices.Contains(f2.RemoteInterest("n3"), "orders/+") })
+
+	// 兴趣只传播一跳，超出跳数的节点不会收到通告
+	time.Sleep(200 * time.Millisecond)
+	if interest := f1.RemoteInterest("n2"); len(interest) != 0 {
+		t.Fatalf("expected interest beyond max hops to be dropped, got %v", interest)
+	}
+	if links := f3.Links(); !slices.Equal(links, []string{"n2"}) {
+		t.Fatalf("unexpected links %v", links)
+	}
+}
+
+func TestFederation_MeshNoDuplicates(t *testing.T) {
+	b1, f1 := startFederatedNode(t, "n1", nil)
+	b2, f2 := startFederatedNode(t, "n2", nil, f1)
+	b3, f3 := startFederatedNode(t, "n3", nil, f1, f2)
+	waitFor(t, 2*time.Second, func() bool {
+		return len(f1.Links()) == 2 && len(f2.Links()) == 2 && len(f3.Links()) == 2
+	})
+
+	counts := []*int32{
+		countingSubscriber(t, b1, "c1", "events/#"),
+		countingSubscriber(t, b2, "c2", "events/#"),
+		countingSubscriber(t, b3, "c3", "events/+"),
+	}
+	waitFor(t, 2*time.Second, func() bool {
+		return slices.Contains(f1.RemoteInterest("n2"), "events/#") &&
+			slices.Contains(f1.RemoteInterest("n3"), "events/+") &&
+			slices.Contains(f2.RemoteInterest("n3"), "events/+")
+	})
+
+	for i := 0; i < 10; i++ {
+		b1.Publish(NewMessage("events/login", nil))
+	}
+	waitFor(t, 2*time.Second, func() bool {
+		for _, count := range counts {
+			if atomic.LoadInt32(count) != 10 {
+				return false
+			}
+		}
+		return true
+	})
+
+	// 等待可能经其他路径到达的副本
+	time.Sleep(300 * time.Millisecond)
+	for i, count := range counts {
+		if got := atomic.LoadInt32(count); got != 10 {
+			t.Fatalf("node %d received %d messages, expected 10", i+1, got)
+		}
+	}
+}
+
+func TestFederation_Token(t *testing.T) {
+	_, f1 := startFederatedNode(t, "n1", func(c *FederationConfig) { c.Token = "secret" })
+	_, f2 := startFederatedNode(t, "n2", func(c *FederationConfig) { c.Token = "wrong" }, f1)
+	_, f3 := startFederatedNode(t, "n3", func(c *FederationConfig) { c.Token = "secret" }, f1)
+
+	waitFor(t, 2*time.Second, func() bool { return slices.Equal(f3.Links(), []string{"n1"}) })
+	time.Sleep(200 * time.Millisecond)
+	if links := f2.Links(); len(links) != 0 {
+		t.Fatalf("expected node with invalid token to be rejected, got links %v", links)
+	}
+	if links := f1.Links(); !slices.Equal(links, []string{"n3"}) {
+		t.Fatalf("unexpected links %v", links)
+	}
+}
@@ -0,0 +1,426 @@
+package mq
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Yui100901/MyGo/concurrency"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/15 09 40
+//
+
+const (
+	defaultHistorySpillSize = 64 * 1024 * 1024
+	defaultHistoryMaxTopics = 10000
+)
+
+// HeaderReplay 重放的消息带有该消息头
+const HeaderReplay = "x-replay"
+
+// HistoryConfig 主题历史配置
+type HistoryConfig struct {
+	Size         int    // 每个主题在内存中保留的最近消息数量
+	SpillFile    string // 溢出文件，被挤出内存的消息追加写入该文件，为空时直接丢弃
+	MaxSpillSize int64  // 溢出文件超过该字节数时轮转为<SpillFile>.old，只保留一份旧文件
+	MaxTopics    int    // 内存中最多保留历史的主题数量，超出时最久未发布的主题整体挤出到溢出文件
+}
+
+// DefaultHistoryConfig 返回默认的主题历史配置
+func DefaultHistoryConfig() *HistoryConfig {
+	return &HistoryConfig{
+		Size:         100,
+		MaxSpillSize: defaultHistorySpillSize,
+		MaxTopics:    defaultHistoryMaxTopics,
+	}
+}
+
+// historyRing 单个主题的环形缓冲
+type historyRing struct {
+	mu       sync.Mutex
+	messages []*Message
+	start    int
+	count    int
+	updated  time.Time // 最近一次写入的时间，用于挤出最久未发布的主题
+	removed  bool      // 已从主题表中移除，写入方需要重新获取缓冲
+}
+
+func newHistoryRing(size int) *historyRing {
+	return &historyRing{messages: make([]*Message, size), updated: time.Now()}
+}
+
+// push 追加消息，缓冲已满时返回被挤出的最旧消息；缓冲已被移除时返回false
+func (r *historyRing) push(msg *Message) (*Message, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.removed {
+		return nil, false
+	}
+	r.updated = time.Now()
+	size := len(r.messages)
+	if r.count < size {
+		r.messages[(r.start+r.count)%size] = msg
+		r.count++
+		return nil, true
+	}
+	evicted := r.messages[r.start]
+	r.messages[r.start] = msg
+	r.start = (r.start + 1) % size
+	return evicted, true
+}
+
+// snapshot 按发布顺序返回缓冲中的消息，以及早于缓冲的消息是否可能不早于since
+func (r *historyRing) snapshot(since time.Time) ([]*Message, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]*Message, 0, r.count)
+	for i := 0; i < r.count; i++ {
+		result = append(result, r.messages[(r.start+i)%len(r.messages)])
+	}
+	return result, r.count == 0 || !result[0].CreatedAt.Before(since)
+}
+
+// drain 移除缓冲并返回其中的全部消息
+func (r *historyRing) drain() []*Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.removed {
+		return nil
+	}
+	r.removed = true
+	result := make([]*Message, 0, r.count)
+	for i := 0; i < r.count; i++ {
+		result = append(result, r.messages[(r.start+i)%len(r.messages)])
+	}
+	r.messages, r.count = nil, 0
+	return result
+}
+
+// topicHistory 按主题保存最近发布的消息
+type topicHistory struct {
+	config *HistoryConfig
+	rings  *concurrency.SafeMap[Topic, *historyRing]
+
+	spillMu   sync.Mutex
+	spill     *os.File
+	spillSize int64
+}
+
+func newTopicHistory(config *HistoryConfig) *topicHistory {
+	if config.Size <= 0 {
+		config.Size = 1
+	}
+	if config.MaxSpillSize <= 0 {
+		config.MaxSpillSize = defaultHistorySpillSize
+	}
+	if config.MaxTopics <= 0 {
+		config.MaxTopics = defaultHistoryMaxTopics
+	}
+	return &topicHistory{
+		config: config,
+		rings:  concurrency.NewSafeMap[Topic, *historyRing](32),
+	}
+}
+
+// record 记录一条已发布的消息
+func (h *topicHistory) record(msg *Message) error {
+	historyCopy := msg.Clone()
+	historyCopy.tracker = nil
+
+	for {
+		var ring *historyRing
+		created := false
+		h.rings.Update(msg.Topic, func(old *historyRing) (*historyRing, bool) {
+			if old == nil {
+				old = newHistoryRing(h.config.Size)
+				created = true
+			}
+			ring = old
+			return old, true
+		})
+		if created && h.rings.Length() > h.config.MaxTopics {
+			if err := h.evictTopic(msg.Topic); err != nil {
+				return err
+			}
+		}
+
+		evicted, ok := ring.push(historyCopy)
+		if !ok {
+			// 缓冲刚被挤出，重新创建
+			continue
+		}
+		if evicted == nil {
+			return nil
+		}
+		return h.spillMessages(evicted)
+	}
+}
+
+// evictTopic 挤出最久未发布的主题（不包括keep），其消息写入溢出文件
+func (h *topicHistory) evictTopic(keep Topic) error {
+	var victim Topic
+	var victimRing *historyRing
+	var oldest time.Time
+	h.rings.ForEach(func(topic Topic, ring *historyRing) bool {
+		if topic == keep {
+			return true
+		}
+		ring.mu.Lock()
+		updated := ring.updated
+		ring.mu.Unlock()
+		if victimRing == nil || updated.Before(oldest) {
+			victim, victimRing, oldest = topic, ring, updated
+		}
+		return true
+	})
+	if victimRing == nil {
+		return nil
+	}
+	h.rings.Update(victim, func(old *historyRing) (*historyRing, bool) {
+		return old, old != victimRing
+	})
+	return h.spillMessages(victimRing.drain()...)
+}
+
+// spillMessages 将被挤出内存的未过期消息写入溢出文件，未配置溢出文件时直接丢弃
+func (h *topicHistory) spillMessages(messages ...*Message) error {
+	if h.config.SpillFile == "" {
+		return nil
+	}
+	for _, msg := range messages {
+		if msg.IsExpired() {
+			continue
+		}
+		if err := h.writeSpill(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// query 返回与pattern匹配、创建时间不早于since且未过期的消息，按创建时间排序，
+// limit大于0时只返回最近的limit条
+func (h *topicHistory) query(pattern Topic, since time.Time, limit int) ([]*Message, error) {
+	result := make([]*Message, 0)
+	// 具体主题的缓冲中最旧的消息早于since时，溢出文件中不会有需要的消息；
+	// 通配模式可能匹配只在溢出文件中的主题（重启前或被挤出的主题），总是需要读取
+	complete := false
+	h.rings.ForEach(func(topic Topic, ring *historyRing) bool {
+		if !pattern.Matches(topic) {
+			return true
+		}
+		messages, older := ring.snapshot(since)
+		result = append(result, messages...)
+		complete = !pattern.IsWildcard() && !older
+		return true
+	})
+
+	if !complete && h.hasSpill() {
+		spilled, err := h.readSpill(pattern, since)
+		if err != nil {
+			return nil, err
+		}
+		result = append(spilled, result...)
+	}
+
+	seen := make(map[string]bool, len(result))
+	filtered := make([]*Message, 0, len(result))
+	for _, msg := range result {
+		if seen[msg.ID] || msg.CreatedAt.Before(since) || msg.IsExpired() {
+			continue
+		}
+		seen[msg.ID] = true
+		filtered = append(filtered, msg)
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].CreatedAt.Before(filtered[j].CreatedAt)
+	})
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[len(filtered)-limit:]
+	}
+	return filtered, nil
+}
+
+// writeSpill 以JSON行的形式追加写入溢出文件，超过大小上限时轮转
+func (h *topicHistory) writeSpill(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encode history message failed: %w", err)
+	}
+	data = append(data, '\n')
+
+	h.spillMu.Lock()
+	defer h.spillMu.Unlock()
+	if h.spill == nil {
+		if err := h.openSpill(); err != nil {
+			return err
+		}
+	}
+	if h.spillSize+int64(len(data)) > h.config.MaxSpillSize && h.spillSize > 0 {
+		if err := h.rotateSpill(); err != nil {
+			return err
+		}
+	}
+	n, err := h.spill.Write(data)
+	h.spillSize += int64(n)
+	if err != nil {
+		return fmt.Errorf("write history spill file failed: %w", err)
+	}
+	return nil
+}
+
+func (h *topicHistory) openSpill() error {
+	if dir := filepath.Dir(h.config.SpillFile); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("create history spill dir failed: %w", err)
+		}
+	}
+	file, err := os.OpenFile(h.config.SpillFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open history spill file failed: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("stat history spill file failed: %w", err)
+	}
+	h.spill = file
+	h.spillSize = info.Size()
+	return nil
+}
+
+func (h *topicHistory) rotateSpill() error {
+	if err := h.spill.Close(); err != nil {
+		return fmt.Errorf("close history spill file failed: %w", err)
+	}
+	h.spill = nil
+	if err := os.Rename(h.config.SpillFile, h.config.SpillFile+".old"); err != nil {
+		return fmt.Errorf("rotate history spill file failed: %w", err)
+	}
+	return h.openSpill()
+}
+
+// hasSpill 溢出文件是否存在，包括重启前写入的文件
+func (h *topicHistory) hasSpill() bool {
+	if h.config.SpillFile == "" {
+		return false
+	}
+	for _, path := range []string{h.config.SpillFile, h.config.SpillFile + ".old"} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// readSpill 从旧的和当前的溢出文件中读取匹配的消息
+func (h *topicHistory) readSpill(pattern Topic, since time.Time) ([]*Message, error) {
+	h.spillMu.Lock()
+	defer h.spillMu.Unlock()
+
+	result := make([]*Message, 0)
+	for _, path := range []string{h.config.SpillFile + ".old", h.config.SpillFile} {
+		file, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("open history spill file failed: %w", err)
+		}
+		reader := bufio.NewReader(file)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 && line[len(line)-1] == '\n' {
+				var msg Message
+				// 损坏的行直接跳过
+				if json.Unmarshal(line, &msg) == nil && pattern.Matches(msg.Topic) && !msg.CreatedAt.Before(since) {
+					result = append(result, &msg)
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					_ = file.Close()
+					return nil, fmt.Errorf("read history spill file failed: %w", err)
+				}
+				break
+			}
+		}
+		_ = file.Close()
+	}
+	return result, nil
+}
+
+// close 关闭溢出文件，之后写入时会重新打开
+func (h *topicHistory) close() error {
+	h.spillMu.Lock()
+	defer h.spillMu.Unlock()
+	if h.spill == nil {
+		return nil
+	}
+	err := h.spill.Close()
+	h.spill = nil
+	return err
+}
+
+// History 查询主题历史，topic可以是通配符模式；返回创建时间不早于since且未过期的消息，
+// 按创建时间排序，limit大于0时只返回最近的limit条。
+// 不做授权检查，代表其他主体查询时使用HistoryAs
+func (b *MessageBroker) History(topic Topic, since time.Time, limit int) ([]*Message, error) {
+	if b.history == nil {
+		return nil, errors.New("history is not enabled")
+	}
+	if err := topic.Validate(); err != nil {
+		return nil, err
+	}
+	messages, err := b.history.query(topic, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i, msg := range messages {
+		messages[i] = msg.Clone()
+	}
+	return messages, nil
+}
+
+// HistoryAs 以principal的身份查询主题历史，设置了授权检查时需要principal有订阅topic的权限
+func (b *MessageBroker) HistoryAs(principal string, topic Topic, since time.Time, limit int) ([]*Message, error) {
+	if err := topic.Validate(); err != nil {
+		return nil, err
+	}
+	if err := b.authorize(principal, ActionSubscribe, topic); err != nil {
+		return nil, err
+	}
+	return b.History(topic, since, limit)
+}
+
+// Replay 将主题历史中创建时间不早于since且未过期的消息重新投递给指定订阅者，返回重放的消息数量，
+// limit大于0时只重放最近的limit条，since为零值时即重放最近的limit条消息。
+// 重放的消息带有x-replay消息头，只投递给该订阅者中与消息主题匹配的订阅，
+// 设置了授权检查时需要订阅者有订阅topic的权限
+func (b *MessageBroker) Replay(subscriberID string, topic Topic, since time.Time, limit int) (int, error) {
+	subscriber, exists := b.subscribers.Get(subscriberID)
+	if !exists {
+		return 0, fmt.Errorf("subscriber %s not found", subscriberID)
+	}
+	messages, err := b.HistoryAs(subscriberID, topic, since, limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, msg := range messages {
+		msg.Attempts = 0
+		msg.SetHeader(HeaderReplay, "true")
+		subscriber.HandleMessage(msg)
+	}
+	b.logger.Info("Replayed history", "count", len(messages), "topic", topic, "subscriber", subscriberID)
+	return len(messages), nil
+}
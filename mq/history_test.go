@@ -0,0 +1,262 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/15 14 10
+//
+
+func TestMQ_History(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.History = &HistoryConfig{Size: 3}
+	b := NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+
+	for i := 1; i <= 5; i++ {
+		b.Publish(NewMessage("sensor/a", []byte(fmt.Sprint(i))))
+	}
+	b.Publish(NewMessage("sensor/b", []byte("b")))
+	expired := NewMessage("sensor/a", []byte("expired"))
+	expired.SetTTL(time.Millisecond)
+	b.Publish(expired)
+	time.Sleep(5 * time.Millisecond)
+
+	payloads := func(messages []*Message) string {
+		result := ""
+		for _, msg := range messages {
+			result += string(msg.Payload)
+		}
+		return result
+	}
+
+	// 只保留最近3条，过期的消息不返回
+	history, err := b.History("sensor/a", time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := payloads(history); got != "45" {
+		t.Fatalf("expected history 45, got %s", got)
+	}
+
+	history, _ = b.History("sensor/+", time.Time{}, 2)
+	if got := payloads(history); got != "5b" {
+		t.Fatalf("expected last two messages 5b, got %s", got)
+	}
+
+	if _, err := NewMessageBroker(nil).History("sensor/a", time.Time{}, 0); err == nil {
+		t.Fatal("expected error when history is disabled")
+	}
+}
+
+func TestMQ_HistorySpill(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.History = &HistoryConfig{Size: 2, SpillFile: filepath.Join(t.TempDir(), "history.jsonl")}
+	b := NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+
+	var since time.Time
+	for i := 1; i <= 6; i++ {
+		msg := NewMessage("log", []byte(fmt.Sprint(i)))
+		if i == 2 {
+			since = msg.CreatedAt
+		}
+		b.Publish(msg)
+	}
+
+	history, err := b.History("log", since, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 5 {
+		t.Fatalf("expected 5 messages from memory and spill file, got %d", len(history))
+	}
+	for i, msg := range history {
+		if string(msg.Payload) != fmt.Sprint(i+2) {
+			t.Fatalf("expected payload %d at %d, got %s", i+2, i, msg.Payload)
+		}
+	}
+}
+
+func TestMQ_HistorySpillRestart(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.History = &HistoryConfig{Size: 2, SpillFile: filepath.Join(t.TempDir(), "history.jsonl")}
+	b := NewMessageBroker(config)
+	b.Start()
+	for i := 1; i <= 4; i++ {
+		b.Publish(NewMessage("log", []byte(fmt.Sprint(i))))
+	}
+	b.Stop()
+
+	payloads := func(b *MessageBroker, topic Topic) string {
+		t.Helper()
+		history, err := b.History(topic, time.Time{}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := ""
+		for _, msg := range history {
+			result += string(msg.Payload)
+		}
+		return result
+	}
+
+	// 重启后内存中没有该主题，仍能查询到之前溢出的消息
+	restarted := NewMessageBroker(config)
+	restarted.Start()
+	defer restarted.Stop()
+	if got := payloads(restarted, "log"); got != "12" {
+		t.Fatalf("expected spilled messages 12 after restart, got %s", got)
+	}
+	restarted.Publish(NewMessage("log", []byte("5")))
+	if got := payloads(restarted, "log"); got != "125" {
+		t.Fatalf("expected spilled and new messages 125, got %s", got)
+	}
+	if got := payloads(restarted, "#"); got != "125" {
+		t.Fatalf("expected wildcard query to read spill file, got %s", got)
+	}
+}
+
+func TestMQ_HistoryMaxTopics(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.History = &HistoryConfig{Size: 2, MaxTopics: 2, SpillFile: filepath.Join(t.TempDir(), "history.jsonl")}
+	b := NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+
+	for i := 1; i <= 5; i++ {
+		b.Publish(NewMessage(Topic(fmt.Sprintf("device/%d", i)), []byte(fmt.Sprint(i))))
+	}
+	if n := b.history.rings.Length(); n != 2 {
+		t.Fatalf("expected history bounded to 2 topics, got %d", n)
+	}
+	// 被挤出的主题可以从溢出文件中查询
+	history, err := b.History("device/1", time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || string(history[0].Payload) != "1" {
+		t.Fatalf("expected evicted topic in spill file, got %v", history)
+	}
+	if history, _ := b.History("device/+", time.Time{}, 0); len(history) != 5 {
+		t.Fatalf("expected 5 messages across topics, got %d", len(history))
+	}
+}
+
+func TestMQ_Replay(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.History = DefaultHistoryConfig()
+	b := NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+
+	for i := 1; i <= 3; i++ {
+		msg := NewMessage("orders/created", []byte(fmt.Sprint(i)))
+		b.Publish(msg)
+		// 等待分发完成，避免订阅后收到实时消息
+		waitFor(t, time.Second, func() bool {
+			_, err := b.GetMessage(msg.ID)
+			return err != nil
+		})
+	}
+
+	var mu sync.Mutex
+	received := make([]*Message, 0)
+	b.RegisterSubscriber(NewSubscriber("debugger"))
+	b.Subscribe("debugger", map[Topic]MessageHandler{
+		"orders/#": func(ctx context.Context, msg *Message) error {
+			mu.Lock()
+			received = append(received, msg)
+			mu.Unlock()
+			return nil
+		},
+	})
+
+	count, err := b.Replay("debugger", "orders/#", time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("expected 3 replayed messages, got %d", count)
+	}
+	waitFor(t, 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 3
+	})
+	mu.Lock()
+	for _, msg := range received {
+		if msg.GetHeader(HeaderReplay) != "true" {
+			t.Fatalf("expected replay header on message %s", msg.ID)
+		}
+	}
+	mu.Unlock()
+
+	// 只重放最近的一条
+	if count, err := b.Replay("debugger", "orders/#", time.Time{}, 1); err != nil || count != 1 {
+		t.Fatalf("expected 1 replayed message, got %d, %v", count, err)
+	}
+	waitFor(t, 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 4
+	})
+	mu.Lock()
+	if last := received[3]; string(last.Payload) != "3" {
+		t.Fatalf("expected latest message replayed, got %s", last.Payload)
+	}
+	mu.Unlock()
+
+	if _, err := b.Replay("missing", "orders/#", time.Time{}, 0); err == nil {
+		t.Fatal("expected error for unknown subscriber")
+	}
+}
+
+func TestMQ_HistoryAuthorization(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.History = DefaultHistoryConfig()
+	b := NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+
+	b.Publish(NewMessage("orders/created", []byte("1")))
+	b.Publish(NewMessage("secret/key", []byte("2")))
+	waitFor(t, time.Second, func() bool {
+		history, _ := b.History("#", time.Time{}, 0)
+		return len(history) == 2
+	})
+
+	b.SetAuthorizer(NewRuleAuthorizer(Deny,
+		AccessRule{Effect: Allow, Principals: []string{"debugger"}, Actions: []Action{ActionSubscribe}, Topics: []Topic{"orders/#"}},
+	))
+	b.RegisterSubscriber(NewSubscriber("debugger"))
+	if err := b.Subscribe("debugger", map[Topic]MessageHandler{
+		"orders/#": func(ctx context.Context, msg *Message) error { return nil },
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Replay("debugger", "secret/#", time.Time{}, 0); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected replay of denied topic to fail, got %v", err)
+	}
+	if _, err := b.HistoryAs("debugger", "#", time.Time{}, 0); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected history of denied topic to fail, got %v", err)
+	}
+	history, err := b.HistoryAs("debugger", "orders/#", time.Time{}, 0)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("expected 1 allowed message, got %d, %v", len(history), err)
+	}
+	if count, err := b.Replay("debugger", "orders/#", time.Time{}, 0); err != nil || count != 1 {
+		t.Fatalf("expected 1 replayed message, got %d, %v", count, err)
+	}
+}
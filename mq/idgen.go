@@ -0,0 +1,247 @@
+package mq
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/19 10 30
+//
+
+// IDGenerator 消息ID生成器，生成的ID必须全局唯一，且按字典序排序时与生成时间顺序一致
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc 函数形式的ID生成器
+type IDGeneratorFunc func() string
+
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+// defaultIDGenerator 包级默认的ID生成器
+var defaultIDGenerator atomic.Value
+
+func init() {
+	defaultIDGenerator.Store(idGeneratorHolder{NewULIDGenerator()})
+}
+
+// idGeneratorHolder 保证atomic.Value中存储的类型一致
+type idGeneratorHolder struct {
+	IDGenerator
+}
+
+// SetIDGenerator 设置NewMessage等使用的默认ID生成器，为nil时恢复为ULID
+func SetIDGenerator(generator IDGenerator) {
+	if generator == nil {
+		generator = NewULIDGenerator()
+	}
+	defaultIDGenerator.Store(idGeneratorHolder{generator})
+}
+
+// NewID 使用默认的ID生成器生成ID
+func NewID() string {
+	return defaultIDGenerator.Load().(idGeneratorHolder).NewID()
+}
+
+// unixMilli 返回毫秒时间戳，时钟回拨时沿用上一次的时间戳以保证单调递增，调用方需持有锁
+func unixMilli(last uint64) uint64 {
+	return max(uint64(time.Now().UnixMilli()), last)
+}
+
+// ULIDGenerator ULID生成器：48位毫秒时间戳 + 80位随机数，Crockford Base32编码为26个字符。
+// 同一毫秒内的ID在上一个随机数的基础上加一，保证单调递增
+type ULIDGenerator struct {
+	mu      sync.Mutex
+	last    uint64
+	entropy [10]byte
+}
+
+// NewULIDGenerator 创建ULID生成器
+func NewULIDGenerator() *ULIDGenerator {
+	return &ULIDGenerator{}
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (g *ULIDGenerator) NewID() string {
+	g.mu.Lock()
+	now := unixMilli(g.last)
+	// 同一毫秒内随机数递增，新的毫秒或随机数溢出时重新生成随机数
+	if now != g.last || !increment(g.entropy[:]) {
+		if now == g.last {
+			// 随机数溢出，借用下一毫秒
+			now++
+		}
+		g.last = now
+		_, _ = rand.Read(g.entropy[:])
+	}
+	var id [16]byte
+	id[0] = byte(now >> 40)
+	id[1] = byte(now >> 32)
+	id[2] = byte(now >> 24)
+	id[3] = byte(now >> 16)
+	id[4] = byte(now >> 8)
+	id[5] = byte(now)
+	copy(id[6:], g.entropy[:])
+	g.mu.Unlock()
+	return encodeULID(id)
+}
+
+// increment 将大端序字节数组加一，溢出时返回false
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID 将128位ID编码为26个Crockford Base32字符，首字符只使用3位
+func encodeULID(id [16]byte) string {
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// UUIDv7Generator UUIDv7生成器（RFC 9562）：48位毫秒时间戳，rand_a的12位作为同一毫秒内的计数器，
+// 其余62位为随机数，格式为标准的8-4-4-4-12小写十六进制
+type UUIDv7Generator struct {
+	mu      sync.Mutex
+	last    uint64
+	counter uint16
+}
+
+// NewUUIDv7Generator 创建UUIDv7生成器
+func NewUUIDv7Generator() *UUIDv7Generator {
+	return &UUIDv7Generator{}
+}
+
+func (g *UUIDv7Generator) NewID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[6:])
+
+	g.mu.Lock()
+	now := unixMilli(g.last)
+	if now == g.last {
+		g.counter++
+		if g.counter > 0xfff {
+			// 计数器溢出，借用下一毫秒
+			now++
+			g.counter = 0
+		}
+	} else {
+		// 计数器从随机的低位开始，保留一半空间用于递增
+		g.counter = binary.BigEndian.Uint16(id[6:8]) & 0x7ff
+	}
+	g.last = now
+	counter := g.counter
+	g.mu.Unlock()
+
+	id[0] = byte(now >> 40)
+	id[1] = byte(now >> 32)
+	id[2] = byte(now >> 24)
+	id[3] = byte(now >> 16)
+	id[4] = byte(now >> 8)
+	id[5] = byte(now)
+	id[6] = 0x70 | byte(counter>>8) // 版本7
+	id[7] = byte(counter)
+	id[8] = 0x80 | id[8]&0x3f // RFC 9562变体
+
+	var out [36]byte
+	hex.Encode(out[0:8], id[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], id[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], id[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], id[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:36], id[10:16])
+	return string(out[:])
+}
+
+// Snowflake ID的位分配
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxNode      = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+// SnowflakeEpoch Snowflake时间戳的起始时间
+var SnowflakeEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeGenerator Snowflake生成器：41位毫秒时间戳 + 10位节点ID + 12位序列号，
+// 以19位补零的十进制字符串表示，不同主机使用不同的节点ID即可避免冲突
+type SnowflakeGenerator struct {
+	mu       sync.Mutex
+	node     int64
+	epoch    int64
+	last     int64
+	sequence int64
+}
+
+// NewSnowflakeGenerator 创建Snowflake生成器，node取值范围为0~1023
+func NewSnowflakeGenerator(node int64) (*SnowflakeGenerator, error) {
+	if node < 0 || node > snowflakeMaxNode {
+		return nil, fmt.Errorf("snowflake node must be between 0 and %d", snowflakeMaxNode)
+	}
+	return &SnowflakeGenerator{node: node, epoch: SnowflakeEpoch.UnixMilli()}, nil
+}
+
+func (g *SnowflakeGenerator) NewID() string {
+	return fmt.Sprintf("%019d", g.Next())
+}
+
+// Next 返回下一个数值形式的ID
+func (g *SnowflakeGenerator) Next() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := max(time.Now().UnixMilli()-g.epoch, g.last)
+	if now == g.last {
+		g.sequence = (g.sequence + 1) & snowflakeMaxSequence
+		if g.sequence == 0 {
+			// 序列号用完，等待下一毫秒
+			for now <= g.last {
+				time.Sleep(100 * time.Microsecond)
+				now = max(time.Now().UnixMilli()-g.epoch, now)
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.last = now
+	return now<<(snowflakeNodeBits+snowflakeSequenceBits) | g.node<<snowflakeSequenceBits | g.sequence
+}
+
+// ParseSnowflake 解析Snowflake ID，返回生成时间、节点ID和序列号
+func ParseSnowflake(id string) (time.Time, int64, int64, error) {
+	value, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || value < 0 {
+		return time.Time{}, 0, 0, errors.New("invalid snowflake id")
+	}
+	ms := value >> (snowflakeNodeBits + snowflakeSequenceBits)
+	node := value >> snowflakeSequenceBits & snowflakeMaxNode
+	sequence := value & snowflakeMaxSequence
+	return time.UnixMilli(SnowflakeEpoch.UnixMilli() + ms), node, sequence, nil
+}
@@ -0,0 +1,119 @@
+package mq
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/19 15 10
+//
+
+func TestIDGenerators(t *testing.T) {
+	snowflake, err := NewSnowflakeGenerator(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generators := map[string]struct {
+		generator IDGenerator
+		format    *regexp.Regexp
+	}{
+		"ulid":      {NewULIDGenerator(), regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)},
+		"uuidv7":    {NewUUIDv7Generator(), regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		"snowflake": {snowflake, regexp.MustCompile(`^[0-9]{19}$`)},
+	}
+
+	for name, c := range generators {
+		t.Run(name, func(t *testing.T) {
+			// 顺序生成的ID严格递增
+			previous := ""
+			for i := 0; i < 10000; i++ {
+				id := c.generator.NewID()
+				if !c.format.MatchString(id) {
+					t.Fatalf("invalid id format %s", id)
+				}
+				if id <= previous {
+					t.Fatalf("id %s not greater than previous %s", id, previous)
+				}
+				previous = id
+			}
+
+			// 并发生成的ID不重复
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			seen := make(map[string]bool)
+			for w := 0; w < 8; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ids := make([]string, 0, 2000)
+					for i := 0; i < 2000; i++ {
+						ids = append(ids, c.generator.NewID())
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					for _, id := range ids {
+						if seen[id] {
+							t.Errorf("duplicate id %s", id)
+						}
+						seen[id] = true
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestIDGenerator_TimeOrdered(t *testing.T) {
+	generator := NewULIDGenerator()
+	first := generator.NewID()
+	time.Sleep(2 * time.Millisecond)
+	second := generator.NewID()
+	ids := []string{second, first}
+	sort.Strings(ids)
+	if ids[0] != first {
+		t.Fatalf("expected %s to sort before %s", first, second)
+	}
+}
+
+func TestParseSnowflake(t *testing.T) {
+	generator, _ := NewSnowflakeGenerator(1023)
+	before := time.Now().Add(-time.Millisecond)
+	generated, node, _, err := ParseSnowflake(generator.NewID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node != 1023 || generated.Before(before) || generated.After(time.Now()) {
+		t.Fatalf("unexpected snowflake fields: time=%s node=%d", generated, node)
+	}
+	if _, err := NewSnowflakeGenerator(1024); err == nil {
+		t.Fatal("expected error for node out of range")
+	}
+}
+
+func TestMQ_IDGenerator(t *testing.T) {
+	SetIDGenerator(IDGeneratorFunc(func() string { return "fixed" }))
+	if id := NewMessage("a", nil).ID; id != "fixed" {
+		t.Fatalf("expected custom generator to be used, got %s", id)
+	}
+	SetIDGenerator(nil)
+
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+	msg := &Message{Topic: "a", ExpiresAt: time.Now().Add(time.Minute)}
+	if err := b.Publish(msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID == "" {
+		t.Fatal("expected broker to assign missing message id")
+	}
+	if got := b.GetStats().MessageCounter; got != 1 {
+		t.Fatalf("expected message counter 1, got %d", got)
+	}
+}
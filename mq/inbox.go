@@ -0,0 +1,168 @@
+package mq
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/2 09 40
+//
+
+// ErrInboxFull 订阅者收件箱已满
+var ErrInboxFull = errors.New("subscriber inbox is full")
+
+// OverflowPolicy 订阅者收件箱满时的处理策略
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // 阻塞发布方直到收件箱有空位
+	OverflowDropOldest                       // 丢弃收件箱中最早的消息
+	OverflowDropNewest                       // 丢弃新到达的消息
+	OverflowDeadLetter                       // 将新到达的消息转入死信
+)
+
+// String 返回策略的字符串表示
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "BLOCK"
+	case OverflowDropOldest:
+		return "DROP_OLDEST"
+	case OverflowDropNewest:
+		return "DROP_NEWEST"
+	case OverflowDeadLetter:
+		return "DEAD_LETTER"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// SubscriberConfig 订阅者配置
+type SubscriberConfig struct {
+	InboxSize      int            // 收件箱容量
+	Workers        int            // 处理消息的工作协程数量
+	OverflowPolicy OverflowPolicy // 收件箱满时的处理策略
+}
+
+// DefaultSubscriberConfig 返回默认的订阅者配置
+func DefaultSubscriberConfig() *SubscriberConfig {
+	return &SubscriberConfig{
+		InboxSize:      256,
+		Workers:        8,
+		OverflowPolicy: OverflowBlock,
+	}
+}
+
+// delivery 收件箱中的一次投递：一份消息副本及其处理函数
+type delivery struct {
+	message *Message
+	handler MessageHandler
+}
+
+// startWorkers 启动工作协程，只执行一次
+func (s *Subscriber) startWorkers() {
+	s.startOnce.Do(func() {
+		for _, lane := range s.lanes {
+			go s.worker(lane)
+		}
+	})
+}
+
+// stop 停止工作协程，收件箱中剩余的消息保持未确认状态
+func (s *Subscriber) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// worker 工作协程，处理共享收件箱和自己专属的有序队列
+func (s *Subscriber) worker(lane chan *delivery) {
+	for {
+		select {
+		case d := <-lane:
+			s.process(d)
+		case d := <-s.inbox:
+			s.process(d)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// queueOf 返回投递应进入的队列，带排序键的消息进入其所属的有序队列
+func (s *Subscriber) queueOf(d *delivery) chan *delivery {
+	if key := d.message.OrderingKey(); key != "" {
+		return s.lanes[partitionIndex(key, len(s.lanes))]
+	}
+	return s.inbox
+}
+
+// push 按溢出策略将投递放入收件箱，返回是否入队成功
+func (s *Subscriber) push(d *delivery, policy OverflowPolicy) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	queue := s.queueOf(d)
+	switch policy {
+	case OverflowDropNewest:
+		select {
+		case queue <- d:
+			return true
+		default:
+			s.logger.Warn("Inbox full, message dropped", "message", d.message.ID)
+			s.discard(d)
+			return false
+		}
+	case OverflowDeadLetter:
+		select {
+		case queue <- d:
+			return true
+		default:
+			s.logger.Warn("Inbox full, message routed to dead letter", "message", d.message.ID)
+			if s.deadLetter != nil {
+				s.deadLetter(d.message, s.id, ErrInboxFull)
+			}
+			s.discard(d)
+			return false
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- d:
+				return true
+			default:
+			}
+			select {
+			case oldest := <-queue:
+				s.logger.Warn("Inbox full, oldest message dropped", "message", oldest.message.ID)
+				s.discard(oldest)
+			default:
+			}
+		}
+	default:
+		select {
+		case queue <- d:
+			return true
+		case <-s.done:
+			return false
+		}
+	}
+}
+
+// discard 放弃一次投递并确认，避免消息被重放
+func (s *Subscriber) discard(d *delivery) {
+	atomic.AddInt64(&s.dropped, 1)
+	s.metrics.observeDropped()
+	s.finish(d)
+}
+
+// finish 一次投递结束（成功、死信或丢弃）
+func (s *Subscriber) finish(d *delivery) {
+	atomic.AddInt32(&s.inFlight, -1)
+	d.message.settle()
+}
@@ -0,0 +1,171 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/2 14 20
+//
+
+// newBlockedSubscriber 创建单工作协程、容量为1的订阅者，处理函数阻塞直到release关闭
+func newBlockedSubscriber(t *testing.T, policy OverflowPolicy) (*Subscriber, chan struct{}, chan string) {
+	s := NewSubscriberWithConfig("inbox", &SubscriberConfig{InboxSize: 1, Workers: 1, OverflowPolicy: policy})
+	release := make(chan struct{})
+	handled := make(chan string, 8)
+	s.Subscribe(map[Topic]MessageHandler{
+		"inbox/test": func(ctx context.Context, msg *Message) error {
+			<-release
+			handled <- string(msg.Payload)
+			return nil
+		},
+	})
+	t.Cleanup(s.stop)
+	return s, release, handled
+}
+
+func publishTo(s *Subscriber, payload string) {
+	s.HandleMessage(NewMessage("inbox/test", []byte(payload)))
+}
+
+func collect(t *testing.T, handled chan string, n int) []string {
+	got := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case p := <-handled:
+			got = append(got, p)
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d messages, got %v", n, got)
+		}
+	}
+	return got
+}
+
+func TestSubscriber_OverflowDropNewest(t *testing.T) {
+	s, release, handled := newBlockedSubscriber(t, OverflowDropNewest)
+	publishTo(s, "1") // 被工作协程取走并阻塞
+	waitFor(t, time.Second, func() bool { return s.InboxDepth() == 0 })
+	publishTo(s, "2") // 进入收件箱
+	publishTo(s, "3") // 收件箱已满，被丢弃
+
+	if s.Dropped() != 1 || s.InboxDepth() != 1 {
+		t.Fatalf("expected 1 dropped and depth 1, got %d and %d", s.Dropped(), s.InboxDepth())
+	}
+	close(release)
+	if got := collect(t, handled, 2); got[0] != "1" || got[1] != "2" {
+		t.Fatalf("unexpected messages %v", got)
+	}
+}
+
+func TestSubscriber_OverflowDropOldest(t *testing.T) {
+	s, release, handled := newBlockedSubscriber(t, OverflowDropOldest)
+	publishTo(s, "1")
+	waitFor(t, time.Second, func() bool { return s.InboxDepth() == 0 })
+	publishTo(s, "2")
+	publishTo(s, "3") // 挤掉收件箱中的2
+
+	if s.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped, got %d", s.Dropped())
+	}
+	close(release)
+	if got := collect(t, handled, 2); got[0] != "1" || got[1] != "3" {
+		t.Fatalf("unexpected messages %v", got)
+	}
+}
+
+func TestSubscriber_OverflowDeadLetter(t *testing.T) {
+	s, release, _ := newBlockedSubscriber(t, OverflowDeadLetter)
+	var reason error
+	s.attach(context.Background(), nil, func(msg *Message, subscriberID string, err error) {
+		reason = err
+	}, nil)
+	publishTo(s, "1")
+	waitFor(t, time.Second, func() bool { return s.InboxDepth() == 0 })
+	publishTo(s, "2")
+	publishTo(s, "3")
+	close(release)
+
+	if !errors.Is(reason, ErrInboxFull) {
+		t.Fatalf("expected inbox full dead letter, got %v", reason)
+	}
+}
+
+func TestSubscriber_OverflowBlock(t *testing.T) {
+	s, release, handled := newBlockedSubscriber(t, OverflowBlock)
+	publishTo(s, "1")
+	waitFor(t, time.Second, func() bool { return s.InboxDepth() == 0 })
+	publishTo(s, "2")
+
+	var published int32
+	go func() {
+		publishTo(s, "3")
+		atomic.StoreInt32(&published, 1)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&published) != 0 {
+		t.Fatal("publisher should be blocked while inbox is full")
+	}
+	close(release)
+	collect(t, handled, 3)
+	if s.Dropped() != 0 {
+		t.Fatalf("expected nothing dropped, got %d", s.Dropped())
+	}
+}
+
+func TestSubscriber_WorkersBounded(t *testing.T) {
+	s := NewSubscriberWithConfig("workers", &SubscriberConfig{InboxSize: 16, Workers: 2})
+	defer s.stop()
+	var running, peak, done int32
+	s.Subscribe(map[Topic]MessageHandler{
+		"inbox/test": func(ctx context.Context, msg *Message) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&done, 1)
+			return nil
+		},
+	})
+	for i := 0; i < 10; i++ {
+		publishTo(s, "x")
+	}
+	waitFor(t, 2*time.Second, func() bool { return atomic.LoadInt32(&done) == 10 })
+	if peak > 2 {
+		t.Fatalf("expected at most 2 concurrent handlers, got %d", peak)
+	}
+}
+
+func TestMQ_StatsInboxDepth(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	release := make(chan struct{})
+	defer close(release)
+	s := NewSubscriberWithConfig("slow", &SubscriberConfig{InboxSize: 4, Workers: 1})
+	b.RegisterSubscriber(s)
+	b.Subscribe(s.ID(), map[Topic]MessageHandler{
+		"inbox/test": func(ctx context.Context, msg *Message) error {
+			<-release
+			return nil
+		},
+	})
+	for i := 0; i < 3; i++ {
+		b.Publish(NewMessage("inbox/test", []byte("x")))
+	}
+
+	// 第一条被工作协程取走，其余两条积压在收件箱
+	waitFor(t, time.Second, func() bool {
+		return b.GetStats().SubscriberInbox[s.ID()] == 2
+	})
+}
@@ -0,0 +1,43 @@
+package mq
+
+import (
+	"context"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/8 09 45
+//
+
+// PublishFunc 消息发布函数
+type PublishFunc func(ctx context.Context, msg *Message) error
+
+// PublishInterceptor 发布拦截器，可修改消息头和元数据、包装上下文后调用next继续发布，
+// 不调用next即短路本次发布，返回的错误会作为Publish的结果
+type PublishInterceptor func(ctx context.Context, msg *Message, next PublishFunc) error
+
+// HandleInterceptor 处理拦截器，可修改消息头和元数据、包装上下文后调用next继续处理，
+// 不调用next即短路本次处理，返回的错误按处理失败参与重试和死信
+type HandleInterceptor func(ctx context.Context, msg *Message, next MessageHandler) error
+
+// chainPublish 按注册顺序组装发布拦截器链，先注册的拦截器位于最外层
+func chainPublish(interceptors []PublishInterceptor, final PublishFunc) PublishFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], final
+		final = func(ctx context.Context, msg *Message) error {
+			return interceptor(ctx, msg, next)
+		}
+	}
+	return final
+}
+
+// chainHandle 按注册顺序组装处理拦截器链，先注册的拦截器位于最外层
+func chainHandle(interceptors []HandleInterceptor, final MessageHandler) MessageHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], final
+		final = func(ctx context.Context, msg *Message) error {
+			return interceptor(ctx, msg, next)
+		}
+	}
+	return final
+}
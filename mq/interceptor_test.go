@@ -0,0 +1,80 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/8 14 10
+//
+
+type traceKey struct{}
+
+func TestMQ_Interceptors(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	var order []string
+	errBlocked := errors.New("topic blocked")
+	b.Use(
+		func(ctx context.Context, msg *Message, next PublishFunc) error {
+			order = append(order, "outer")
+			msg.SetHeader("x-trace-id", "trace-1")
+			return next(ctx, msg)
+		},
+		func(ctx context.Context, msg *Message, next PublishFunc) error {
+			order = append(order, "inner")
+			if msg.Topic == "blocked" {
+				return errBlocked
+			}
+			return next(ctx, msg)
+		},
+	)
+
+	received := make(chan string, 2)
+	s := NewSubscriber("intercepted")
+	s.Use(func(ctx context.Context, msg *Message, next MessageHandler) error {
+		if msg.GetHeader("x-skip") != "" {
+			return nil
+		}
+		return next(context.WithValue(ctx, traceKey{}, msg.GetHeader("x-trace-id")), msg)
+	})
+	b.RegisterSubscriber(s)
+	b.Subscribe(s.ID(), map[Topic]MessageHandler{
+		"orders/#": func(ctx context.Context, msg *Message) error {
+			received <- ctx.Value(traceKey{}).(string)
+			return nil
+		},
+	})
+
+	if err := b.Publish(NewMessage("blocked", nil)); !errors.Is(err, errBlocked) {
+		t.Fatalf("expected blocked error, got %v", err)
+	}
+	if len(order) != 2 || order[0] != "outer" || order[1] != "inner" {
+		t.Fatalf("unexpected interceptor order %v", order)
+	}
+
+	skipped := NewMessage("orders/1", nil)
+	skipped.SetHeader("x-skip", "1")
+	b.Publish(skipped)
+	b.Publish(NewMessage("orders/2", nil))
+
+	select {
+	case traceID := <-received:
+		if traceID != "trace-1" {
+			t.Fatalf("expected trace id from publish interceptor, got %q", traceID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message was not handled")
+	}
+	select {
+	case <-received:
+		t.Fatal("short-circuited message should not reach the handler")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,75 @@
+package mq
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yui100901/MyGo/log_utils"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/24 14 20
+//
+
+// syncBuffer 并发安全的日志缓冲
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMQ_Logging(t *testing.T) {
+	publish := func(level slog.Level) string {
+		var out syncBuffer
+		opt := log_utils.WithHandler(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: level}))
+		b := NewMessageBroker(nil, opt)
+		b.Start()
+		received := make(chan struct{}, 1)
+		b.RegisterSubscriber(NewSubscriber("c1", opt))
+		b.Subscribe("c1", map[Topic]MessageHandler{
+			"a": func(ctx context.Context, msg *Message) error {
+				received <- struct{}{}
+				return nil
+			},
+		})
+		b.Publish(NewMessage("a", nil))
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatal("message not delivered")
+		}
+		b.Stop()
+		return out.String()
+	}
+
+	// 默认的信息级别只输出生命周期日志
+	info := publish(slog.LevelInfo)
+	if !strings.Contains(info, "Message broker started successfully") {
+		t.Fatalf("expected lifecycle logs, got %q", info)
+	}
+	if strings.Contains(info, "Publishing message") {
+		t.Fatalf("expected per-message logs to be suppressed at info level")
+	}
+
+	debug := publish(slog.LevelDebug)
+	if !strings.Contains(debug, "Publishing message") || !strings.Contains(debug, "component=mq-broker") {
+		t.Fatalf("expected per-message logs at debug level, got %q", debug)
+	}
+}
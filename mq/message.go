@@ -1,7 +1,7 @@
 package mq
 
 import (
-	"fmt"
+	"sync/atomic"
 	"time"
 )
 
@@ -41,24 +41,39 @@ import (
 
 const defaultMessageTTL = 1 * time.Hour
 
+// 消息头定义
+const (
+	HeaderDeadLetterReason  = "x-dead-letter-reason"  // 进入死信的原因
+	HeaderOriginalTopic     = "x-original-topic"      // 死信消息的原始主题
+	HeaderOriginalMessageID = "x-original-message-id" // 死信消息的原始消息ID
+	HeaderFailedSubscriber  = "x-failed-subscriber"   // 处理失败的订阅者
+	HeaderAttempts          = "x-attempts"            // 已尝试投递次数
+)
+
 // Message 消息结构体，包含消息的所有属性和元数据
 type Message struct {
 	ID       string                 `json:"id"`                  // 消息唯一标识符
 	Topic    Topic                  `json:"topic"`               // 消息主题
 	SenderID string                 `json:"sender_id,omitempty"` // 发送方客户端ID
+	Key      string                 `json:"key,omitempty"`       // 排序键，相同键的消息按发布顺序处理
 	Payload  []byte                 `json:"payload"`             // 消息载荷
 	Headers  map[string]string      `json:"headers,omitempty"`   // 消息头部信息
 	Metadata map[string]interface{} `json:"metadata,omitempty"`  // 扩展元数据
 	//Status      MessageStatus          `json:"status"`                 // 消息状态
-	Delay     time.Duration `json:"delay,omitempty"` // 发送延迟
-	CreatedAt time.Time     `json:"created_at"`      // 创建时间
-	DeliverAt time.Time     `json:"delivered_at"`    // 发送时间
-	TTL       time.Duration `json:"ttl"`             // 存活时间
-	ExpiresAt time.Time     `json:"expires_at"`      // 过期时间
+	Delay     time.Duration `json:"delay,omitempty"`    // 发送延迟
+	CreatedAt time.Time     `json:"created_at"`         // 创建时间
+	DeliverAt time.Time     `json:"delivered_at"`       // 发送时间
+	TTL       time.Duration `json:"ttl"`                // 存活时间
+	ExpiresAt time.Time     `json:"expires_at"`         // 过期时间
+	Attempts  int           `json:"attempts,omitempty"` // 当前投递尝试次数
+	Retained  bool          `json:"retained,omitempty"` // 保留消息，代理保存每个主题最后一条并投递给新订阅
+	Priority  Priority      `json:"priority,omitempty"` // 分发优先级，高优先级的消息优先分发
+
+	tracker *deliveryTracker // 投递跟踪器，所有处理函数完成后确认消息
 }
 
 func NewMessage(topic Topic, payload []byte) *Message {
-	msgID := fmt.Sprintf("msg_%d", time.Now().UnixNano())
+	msgID := NewID()
 	now := time.Now()
 	msg := &Message{
 		ID:      msgID,
@@ -84,7 +99,92 @@ func (m *Message) SetTTL(ttl time.Duration) {
 	m.ExpiresAt = m.CreatedAt.Add(ttl)
 }
 
+// SetRetained 设置是否为保留消息
+func (m *Message) SetRetained(retained bool) {
+	m.Retained = retained
+}
+
+// SetPriority 设置分发优先级
+func (m *Message) SetPriority(priority Priority) {
+	m.Priority = priority
+}
+
+// SetKey 设置排序键
+func (m *Message) SetKey(key string) {
+	m.Key = key
+}
+
+// OrderingKey 返回排序键，未设置Key时使用消息头 x-message-key
+func (m *Message) OrderingKey() string {
+	if m.Key != "" {
+		return m.Key
+	}
+	return m.GetHeader(HeaderMessageKey)
+}
+
 func (m *Message) IsExpired() bool {
 	now := time.Now()
 	return now.After(m.ExpiresAt)
 }
+
+// SetHeader 设置消息头
+func (m *Message) SetHeader(key, value string) {
+	if m.Headers == nil {
+		m.Headers = make(map[string]string)
+	}
+	m.Headers[key] = value
+}
+
+// GetHeader 获取消息头
+func (m *Message) GetHeader(key string) string {
+	if m.Headers == nil {
+		return ""
+	}
+	return m.Headers[key]
+}
+
+// Clone 复制消息，Headers和Metadata会被浅拷贝为新的map
+func (m *Message) Clone() *Message {
+	msgCopy := *m
+	if m.Headers != nil {
+		msgCopy.Headers = make(map[string]string, len(m.Headers))
+		for k, v := range m.Headers {
+			msgCopy.Headers[k] = v
+		}
+	}
+	if m.Metadata != nil {
+		msgCopy.Metadata = make(map[string]interface{}, len(m.Metadata))
+		for k, v := range m.Metadata {
+			msgCopy.Metadata[k] = v
+		}
+	}
+	return &msgCopy
+}
+
+// settle 确认当前副本处理完成
+func (m *Message) settle() {
+	if m.tracker != nil {
+		m.tracker.done()
+	}
+}
+
+// deliveryTracker 跟踪一条消息在所有订阅者上的处理进度
+type deliveryTracker struct {
+	pending    int32
+	onComplete func()
+}
+
+// newDeliveryTracker 创建跟踪器，初始计数1由分发方持有
+func newDeliveryTracker(onComplete func()) *deliveryTracker {
+	return &deliveryTracker{pending: 1, onComplete: onComplete}
+}
+
+func (t *deliveryTracker) add() {
+	atomic.AddInt32(&t.pending, 1)
+}
+
+func (t *deliveryTracker) done() {
+	if atomic.AddInt32(&t.pending, -1) == 0 && t.onComplete != nil {
+		t.onComplete()
+	}
+}
@@ -0,0 +1,161 @@
+package mq
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yui100901/MyGo/concurrency"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/5 10 10
+//
+
+// DefaultLatencyBuckets 处理耗时直方图的默认桶上界（秒）
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// BrokerStats 消息代理的统计信息
+type BrokerStats struct {
+	Running          bool                         `json:"running"`            // 是否运行中
+	TotalSubscribers int                          `json:"total_subscribers"`  // 订阅者数量
+	TotalTopics      int                          `json:"total_topics"`       // 订阅主题数量
+	TotalMessages    int                          `json:"total_messages"`     // 存储的消息数量
+	PendingQueueSize int                          `json:"pending_queue_size"` // 等待分发的消息数量
+	DeliveryTimers   int                          `json:"delivery_timers"`    // 等待投递的延迟消息数量
+	RetainedMessages int                          `json:"retained_messages"`  // 保留消息数量
+	Schedules        int                          `json:"schedules"`          // 周期性发布计划数量
+	MessageCounter   int64                        `json:"message_counter"`    // 接收的消息总数（含重复消息）
+	Published        uint64                       `json:"published"`          // 发布成功的消息数量
+	Delivered        uint64                       `json:"delivered"`          // 处理函数成功处理的次数
+	Expired          uint64                       `json:"expired"`            // 分发前已过期的消息数量
+	Failed           uint64                       `json:"failed"`             // 处理函数失败的次数（含重试）
+	DeadLettered     uint64                       `json:"dead_lettered"`      // 转入死信的消息数量
+	Dropped          uint64                       `json:"dropped"`            // 因收件箱溢出被丢弃的消息数量
+	Deduplicated     uint64                       `json:"deduplicated"`       // 去重窗口内被丢弃的重复消息数量
+	Denied           uint64                       `json:"denied"`             // 被授权检查拒绝的发布和订阅次数
+	TopicSubscribers map[Topic]int                `json:"topic_subscribers"`  // 每个订阅主题的订阅者数量
+	SubscriberInbox  map[string]int               `json:"subscriber_inbox"`   // 每个订阅者收件箱的积压数量
+	PriorityQueues   map[string]int               `json:"priority_queues"`    // 每个优先级队列等待分发的消息数量
+	HandlerLatency   map[string]HistogramSnapshot `json:"handler_latency"`    // 每个订阅者处理函数的耗时分布
+}
+
+// HistogramSnapshot 直方图快照
+type HistogramSnapshot struct {
+	Buckets []float64 `json:"buckets"` // 桶上界
+	Counts  []uint64  `json:"counts"`  // 每个桶的累计计数（小于等于上界）
+	Sum     float64   `json:"sum"`     // 观测值总和
+	Count   uint64    `json:"count"`   // 观测次数
+}
+
+// Histogram 固定桶的直方图，并发安全
+type Histogram struct {
+	buckets []float64
+	counts  []uint64 // 每个桶的非累计计数，最后一个为+Inf
+	sumBits uint64   // 观测值总和的float64位表示
+	count   uint64
+}
+
+// NewHistogram 创建直方图，buckets为升序的桶上界
+func NewHistogram(buckets []float64) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		buckets: sorted,
+		counts:  make([]uint64, len(sorted)+1),
+	}
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(value float64) {
+	index := sort.SearchFloat64s(h.buckets, value)
+	atomic.AddUint64(&h.counts[index], 1)
+	atomic.AddUint64(&h.count, 1)
+	for {
+		old := atomic.LoadUint64(&h.sumBits)
+		sum := math.Float64frombits(old) + value
+		if atomic.CompareAndSwapUint64(&h.sumBits, old, math.Float64bits(sum)) {
+			return
+		}
+	}
+}
+
+// Snapshot 返回直方图快照，桶计数为累计值
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	snapshot := HistogramSnapshot{
+		Buckets: append([]float64(nil), h.buckets...),
+		Counts:  make([]uint64, len(h.buckets)),
+		Sum:     math.Float64frombits(atomic.LoadUint64(&h.sumBits)),
+		Count:   atomic.LoadUint64(&h.count),
+	}
+	var cumulative uint64
+	for i := range h.buckets {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		snapshot.Counts[i] = cumulative
+	}
+	return snapshot
+}
+
+// brokerMetrics 代理运行过程中累计的计数器
+type brokerMetrics struct {
+	published    uint64
+	delivered    uint64
+	expired      uint64
+	failed       uint64
+	deadLettered uint64
+	dropped      uint64
+	deduplicated uint64
+	denied       uint64
+
+	buckets []float64
+	latency *concurrency.SafeMap[string, *Histogram] // subscriberID -> 处理耗时
+}
+
+func newBrokerMetrics(buckets []float64) *brokerMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	return &brokerMetrics{
+		buckets: buckets,
+		latency: concurrency.NewSafeMap[string, *Histogram](32),
+	}
+}
+
+// observeHandler 记录一次处理函数调用的结果和耗时
+func (m *brokerMetrics) observeHandler(subscriberID string, elapsed time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		atomic.AddUint64(&m.failed, 1)
+	} else {
+		atomic.AddUint64(&m.delivered, 1)
+	}
+
+	histogram, ok := m.latency.Get(subscriberID)
+	if !ok {
+		m.latency.Update(subscriberID, func(old *Histogram) (*Histogram, bool) {
+			if old == nil {
+				old = NewHistogram(m.buckets)
+			}
+			histogram = old
+			return old, true
+		})
+	}
+	histogram.Observe(elapsed.Seconds())
+}
+
+// observeDropped 记录一次收件箱溢出丢弃
+func (m *brokerMetrics) observeDropped() {
+	if m == nil {
+		return
+	}
+	atomic.AddUint64(&m.dropped, 1)
+}
+
+// removeSubscriber 订阅者注销后移除其耗时统计
+func (m *brokerMetrics) removeSubscriber(subscriberID string) {
+	m.latency.Delete(subscriberID)
+}
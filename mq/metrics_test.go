@@ -0,0 +1,82 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/5 16 00
+//
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	snapshot := h.Snapshot()
+	if snapshot.Count != 4 || snapshot.Sum != 2.65 {
+		t.Fatalf("unexpected count %d sum %v", snapshot.Count, snapshot.Sum)
+	}
+	if snapshot.Counts[0] != 2 || snapshot.Counts[1] != 3 {
+		t.Fatalf("unexpected cumulative counts %v", snapshot.Counts)
+	}
+}
+
+func TestMQ_StatsAndPrometheus(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.RetryPolicy = &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, Multiplier: 1}
+	b := NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+
+	b.RegisterSubscriber(NewSubscriber("metrics"))
+	b.Subscribe("metrics", map[Topic]MessageHandler{
+		"ok": func(ctx context.Context, msg *Message) error {
+			return nil
+		},
+		"bad": func(ctx context.Context, msg *Message) error {
+			return errors.New("always fails")
+		},
+	})
+
+	b.Publish(NewMessage("ok", nil))
+	b.Publish(NewMessage("bad", nil))
+	expired := NewMessage("ok", nil)
+	expired.SetTTL(-time.Second)
+	b.Publish(expired)
+
+	waitFor(t, time.Second, func() bool {
+		stats := b.GetStats()
+		return stats.Delivered == 1 && stats.Failed == 2 && stats.DeadLettered == 1 && stats.Expired == 1
+	})
+
+	stats := b.GetStats()
+	// 三条原始消息加一条死信
+	if stats.Published != 4 || stats.TotalTopics != 2 || stats.HandlerLatency["metrics"].Count != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	recorder := httptest.NewRecorder()
+	b.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, want := range []string{
+		"# TYPE mq_messages_published_total counter",
+		"mq_messages_published_total 4",
+		"mq_messages_dead_lettered_total 1",
+		`mq_subscriber_inbox_depth{subscriber="metrics"} 0`,
+		`mq_handler_duration_seconds_bucket{subscriber="metrics",le="+Inf"} 3`,
+		`mq_handler_duration_seconds_count{subscriber="metrics"} 3`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
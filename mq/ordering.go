@@ -0,0 +1,22 @@
+package mq
+
+import (
+	"hash/fnv"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/3 10 20
+//
+
+// 有序投递：携带相同键的消息在代理中进入同一个分区队列，由单个分发协程按顺序分发；
+// 在订阅者中进入同一个工作协程的专属队列，按顺序处理，失败时原地重试，
+// 保证同一订阅者对同一键的消息严格先进先出，不同键之间仍然并行处理。
+// 延迟消息按到期时间投递，不参与有序保证。
+
+// partitionIndex 根据键计算分区下标
+func partitionIndex(key string, partitions int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(partitions))
+}
@@ -0,0 +1,113 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/3 15 10
+//
+
+func TestMQ_OrderedByKey(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.RetryPolicy = &RetryPolicy{MaxAttempts: 3, InitialBackoff: 5 * time.Millisecond, Multiplier: 1}
+	b := NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+
+	const keys, perKey = 4, 50
+	var mu sync.Mutex
+	received := make(map[string][]int)
+	failed := make(map[string]bool)
+
+	s := NewSubscriber("device-sink")
+	b.RegisterSubscriber(s)
+	b.Subscribe(s.ID(), map[Topic]MessageHandler{
+		"device/+/state": func(ctx context.Context, msg *Message) error {
+			seq, _ := strconv.Atoi(string(msg.Payload))
+			mu.Lock()
+			defer mu.Unlock()
+			// 每个键的第10条消息第一次处理失败，后续消息必须等它重试成功
+			if seq == 10 && !failed[msg.Key] {
+				failed[msg.Key] = true
+				return errors.New("temporary failure")
+			}
+			received[msg.Key] = append(received[msg.Key], seq)
+			return nil
+		},
+	})
+
+	for i := 0; i < perKey; i++ {
+		for k := 0; k < keys; k++ {
+			key := fmt.Sprintf("dev-%d", k)
+			msg := NewMessage(Topic("device/"+key+"/state"), []byte(strconv.Itoa(i)))
+			msg.SetKey(key)
+			b.Publish(msg)
+		}
+	}
+
+	waitFor(t, 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		total := 0
+		for _, seqs := range received {
+			total += len(seqs)
+		}
+		return total == keys*perKey
+	})
+
+	for key, seqs := range received {
+		for i, seq := range seqs {
+			if seq != i {
+				t.Fatalf("key %s out of order at %d: %v", key, i, seqs)
+			}
+		}
+	}
+}
+
+func TestSubscriber_UnrelatedKeysParallel(t *testing.T) {
+	s := NewSubscriberWithConfig("parallel", &SubscriberConfig{InboxSize: 8, Workers: 2})
+	defer s.stop()
+
+	// 找到落在不同有序队列上的两个键
+	keyA, keyB := "a", ""
+	for i := 0; keyB == ""; i++ {
+		if k := fmt.Sprintf("b%d", i); partitionIndex(k, 2) != partitionIndex(keyA, 2) {
+			keyB = k
+		}
+	}
+
+	release := make(chan struct{})
+	handledB := make(chan struct{}, 1)
+	s.Subscribe(map[Topic]MessageHandler{
+		"inbox/test": func(ctx context.Context, msg *Message) error {
+			if msg.Key == keyA {
+				<-release
+				return nil
+			}
+			handledB <- struct{}{}
+			return nil
+		},
+	})
+
+	msgA := NewMessage("inbox/test", nil)
+	msgA.SetKey(keyA)
+	s.HandleMessage(msgA)
+	msgB := NewMessage("inbox/test", nil)
+	msgB.SetKey(keyB)
+	s.HandleMessage(msgB)
+
+	select {
+	case <-handledB:
+	case <-time.After(time.Second):
+		t.Fatal("blocked key should not delay an unrelated key")
+	}
+	close(release)
+}
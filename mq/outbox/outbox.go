@@ -0,0 +1,131 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Yui100901/MyGo/db"
+	"github.com/Yui100901/MyGo/mq"
+	"gorm.io/gorm"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/29 10 00
+//
+
+// Status 发件箱事件状态
+type Status string
+
+const (
+	StatusPending Status = "pending" // 等待发布
+	StatusSent    Status = "sent"    // 已发布
+	StatusFailed  Status = "failed"  // 重试耗尽，不再发布
+)
+
+// Event 发件箱中的一条事件，与业务数据在同一事务中写入
+type Event struct {
+	ID            uint64 `gorm:"primaryKey;autoIncrement"`
+	MessageID     string `gorm:"size:64;uniqueIndex;not null"` // 发布时使用的消息ID，重复发布时订阅方可据此去重
+	Topic         string `gorm:"size:255;not null"`
+	Key           string `gorm:"column:message_key;size:255"` // 排序键，同一键的事件按写入顺序发布
+	Payload       []byte
+	Headers       string `gorm:"type:text"` // JSON编码的消息头
+	Priority      int8
+	Retained      bool
+	Delay         time.Duration
+	TTL           time.Duration
+	Status        Status    `gorm:"size:16;not null;index:idx_mq_outbox_poll,priority:1"`
+	NextAttemptAt time.Time `gorm:"index:idx_mq_outbox_poll,priority:2"` // 下一次尝试发布的时间
+	Attempts      int       // 发布失败的次数
+	LastError     string    `gorm:"type:text"`
+	CreatedAt     time.Time
+	SentAt        *time.Time `gorm:"index"`
+}
+
+func (Event) TableName() string {
+	return "mq_outbox"
+}
+
+// AutoMigrate 创建或更新发件箱表
+func AutoMigrate(database *gorm.DB) error {
+	return database.AutoMigrate(&Event{})
+}
+
+// Add 在事务中写入待发布的消息，tx为Mapper.Transaction回调中的Mapper，
+// 事务提交后消息才会被Relay发布，回滚时一并丢弃
+func Add[T db.Model](tx *db.Mapper[T], messages ...*mq.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	events := make([]*Event, 0, len(messages))
+	for _, msg := range messages {
+		event, err := newEvent(msg)
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+	}
+	return db.NewMapper[Event](tx.GetDB()).CreateBatch(events).Err
+}
+
+// newEvent 将消息转换为发件箱事件
+func newEvent(msg *mq.Message) (*Event, error) {
+	if msg == nil {
+		return nil, errors.New("message can not be nil")
+	}
+	if err := msg.Topic.Validate(); err != nil {
+		return nil, err
+	}
+	if msg.ID == "" {
+		msg.ID = mq.NewID()
+	}
+	var headers string
+	if len(msg.Headers) > 0 {
+		data, err := json.Marshal(msg.Headers)
+		if err != nil {
+			return nil, err
+		}
+		headers = string(data)
+	}
+	now := time.Now()
+	return &Event{
+		MessageID:     msg.ID,
+		Topic:         string(msg.Topic),
+		Key:           msg.Key,
+		Payload:       msg.Payload,
+		Headers:       headers,
+		Priority:      int8(msg.Priority),
+		Retained:      msg.Retained,
+		Delay:         msg.Delay,
+		TTL:           msg.TTL,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}, nil
+}
+
+// Message 还原为待发布的消息，消息ID同时作为幂等键，开启去重的代理会丢弃重复发布
+func (e *Event) Message() (*mq.Message, error) {
+	msg := mq.NewMessage(mq.Topic(e.Topic), e.Payload)
+	msg.ID = e.MessageID
+	msg.SetKey(e.Key)
+	msg.SetPriority(mq.Priority(e.Priority))
+	msg.SetRetained(e.Retained)
+	if e.Delay > 0 {
+		msg.SetDelay(e.Delay)
+	}
+	if e.TTL > 0 {
+		msg.SetTTL(e.TTL)
+	}
+	if e.Headers != "" {
+		if err := json.Unmarshal([]byte(e.Headers), &msg.Headers); err != nil {
+			return nil, err
+		}
+	}
+	if msg.GetHeader(mq.HeaderIdempotencyKey) == "" {
+		msg.SetHeader(mq.HeaderIdempotencyKey, e.MessageID)
+	}
+	return msg, nil
+}
@@ -0,0 +1,252 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yui100901/MyGo/db"
+	"github.com/Yui100901/MyGo/mq"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/29 14 10
+//
+
+type order struct {
+	ID     uint64 `gorm:"primaryKey;autoIncrement"`
+	Amount int
+}
+
+func (order) TableName() string {
+	return "orders"
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "outbox.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AutoMigrate(&order{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AutoMigrate(database); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+// createOrder 在同一事务中写入订单和事件
+func createOrder(mapper *db.Mapper[order], amount int, fail error) error {
+	return mapper.Transaction(func(tx *db.Mapper[order]) error {
+		record := &order{Amount: amount}
+		if result := tx.Create(record); result.Err != nil {
+			return result.Err
+		}
+		msg := mq.NewMessage("orders/created", []byte("order"))
+		msg.SetKey("orders")
+		if err := Add(tx, msg); err != nil {
+			return err
+		}
+		return fail
+	})
+}
+
+func countEvents(t *testing.T, database *gorm.DB, status Status) int64 {
+	result := db.NewMapper[Event](database).Where("status = ?", status).Count()
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	return result.Data
+}
+
+// flakyPublisher 前failures次发布失败，之后记录发布的消息
+type flakyPublisher struct {
+	mu       sync.Mutex
+	failures int
+	messages []*mq.Message
+}
+
+func (p *flakyPublisher) Publish(msg *mq.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker unavailable")
+	}
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+func (p *flakyPublisher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.messages)
+}
+
+func TestOutbox_Transaction(t *testing.T) {
+	database := openDB(t)
+	mapper := db.NewMapper[order](database)
+
+	if err := createOrder(mapper, 10, errors.New("rollback")); err == nil {
+		t.Fatal("expected transaction to fail")
+	}
+	if n := countEvents(t, database, StatusPending); n != 0 {
+		t.Fatalf("expected rolled back event to be discarded, got %d", n)
+	}
+	if err := createOrder(mapper, 20, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := countEvents(t, database, StatusPending); n != 1 {
+		t.Fatalf("expected one pending event, got %d", n)
+	}
+
+	broker := mq.NewMessageBroker(nil)
+	broker.Start()
+	defer broker.Stop()
+	received := make(chan *mq.Message, 1)
+	broker.RegisterSubscriber(mq.NewSubscriber("consumer"))
+	broker.Subscribe("consumer", map[mq.Topic]mq.MessageHandler{
+		"orders/+": func(ctx context.Context, msg *mq.Message) error {
+			received <- msg
+			return nil
+		},
+	})
+
+	relay, err := NewRelay(database, broker, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := relay.Flush(); err != nil || n != 1 {
+		t.Fatalf("expected one event flushed, got %d, %v", n, err)
+	}
+	select {
+	case msg := <-received:
+		if msg.Key != "orders" || msg.GetHeader(mq.HeaderIdempotencyKey) != msg.ID {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event not published")
+	}
+	if n := countEvents(t, database, StatusSent); n != 1 {
+		t.Fatalf("expected event marked sent, got %d", n)
+	}
+	if n, _ := relay.Flush(); n != 0 {
+		t.Fatalf("expected sent event not to be republished, got %d", n)
+	}
+}
+
+func TestRelay_Retry(t *testing.T) {
+	database := openDB(t)
+	mapper := db.NewMapper[order](database)
+	for i := 0; i < 3; i++ {
+		if err := createOrder(mapper, i, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publisher := &flakyPublisher{failures: 1}
+	config := DefaultRelayConfig()
+	config.RetryBackoff = 10 * time.Millisecond
+	relay, err := NewRelay(database, publisher, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一个事件失败后，同一排序键的后续事件在本轮跳过
+	if _, err := relay.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if publisher.count() != 0 || relay.Failed() != 1 {
+		t.Fatalf("expected events with the same key to wait, published %d", publisher.count())
+	}
+	if _, err := relay.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if publisher.count() != 0 {
+		t.Fatal("expected event to wait for backoff")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := relay.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if publisher.count() != 3 || relay.Published() != 3 {
+		t.Fatalf("expected all events published after retry, got %d", publisher.count())
+	}
+	for i := 1; i < len(publisher.messages); i++ {
+		if publisher.messages[i-1].ID >= publisher.messages[i].ID {
+			t.Fatal("expected events published in insertion order")
+		}
+	}
+}
+
+func TestRelay_MaxAttempts(t *testing.T) {
+	database := openDB(t)
+	if err := createOrder(db.NewMapper[order](database), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultRelayConfig()
+	config.RetryBackoff = time.Millisecond
+	config.MaxAttempts = 2
+	relay, err := NewRelay(database, &flakyPublisher{failures: 10}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		relay.Flush()
+		time.Sleep(5 * time.Millisecond)
+	}
+	if relay.Failed() != 2 {
+		t.Fatalf("expected two attempts, got %d", relay.Failed())
+	}
+	event := db.NewMapper[Event](database).First()
+	if event.Err != nil {
+		t.Fatal(event.Err)
+	}
+	if event.Data.Status != StatusFailed || event.Data.Attempts != 2 || event.Data.LastError != "broker unavailable" {
+		t.Fatalf("unexpected event state %+v", event.Data)
+	}
+}
+
+func TestRelay_PurgeSent(t *testing.T) {
+	database := openDB(t)
+	mapper := db.NewMapper[order](database)
+	if err := createOrder(mapper, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := &flakyPublisher{}
+	config := DefaultRelayConfig()
+	config.PollInterval = 10 * time.Millisecond
+	config.PurgeSent = true
+	relay, err := NewRelay(database, publisher, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay.Start()
+	defer relay.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for publisher.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if publisher.count() != 1 {
+		t.Fatal("event not published by background relay")
+	}
+	relay.Stop()
+	result := db.NewMapper[Event](database).Count()
+	if result.Err != nil || result.Data != 0 {
+		t.Fatalf("expected sent event purged, got %d, %v", result.Data, result.Err)
+	}
+}
@@ -0,0 +1,260 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yui100901/MyGo/db"
+	"github.com/Yui100901/MyGo/log_utils"
+	"github.com/Yui100901/MyGo/mq"
+	"gorm.io/gorm"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/29 11 20
+//
+
+// Publisher 发布消息的目标，MessageBroker和RemoteClient均满足该接口
+type Publisher interface {
+	Publish(msg *mq.Message) error
+}
+
+var (
+	_ Publisher = (*mq.MessageBroker)(nil)
+	_ Publisher = (*mq.RemoteClient)(nil)
+)
+
+// RelayConfig 发件箱中继配置
+type RelayConfig struct {
+	PollInterval time.Duration // 轮询间隔
+	BatchSize    int           // 每次轮询最多发布的事件数量
+	RetryBackoff time.Duration // 首次重试的等待时间，之后每次翻倍
+	MaxBackoff   time.Duration // 重试等待时间上限
+	MaxAttempts  int           // 最大发布次数，超过后标记为失败，为0时一直重试
+	PurgeSent    bool          // 发布成功后直接删除事件，否则标记为已发布
+	Retention    time.Duration // 已发布事件的保留时间，为0时一直保留，PurgeSent为true时无效
+}
+
+// DefaultRelayConfig 返回默认的中继配置
+func DefaultRelayConfig() *RelayConfig {
+	return &RelayConfig{
+		PollInterval: time.Second,
+		BatchSize:    100,
+		RetryBackoff: time.Second,
+		MaxBackoff:   time.Minute,
+		MaxAttempts:  0,
+		PurgeSent:    false,
+		Retention:    24 * time.Hour,
+	}
+}
+
+// Relay 轮询发件箱并发布事件，保证至少一次投递：
+// 发布成功但更新事件状态失败时，事件会在下一次轮询时再次发布
+type Relay struct {
+	mapper    *db.Mapper[Event]
+	publisher Publisher
+	config    *RelayConfig
+
+	mu        sync.Mutex // 保证同一时刻只有一次轮询
+	published uint64
+	failed    uint64
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	stopOnce  sync.Once
+
+	logger *slog.Logger
+}
+
+// NewRelay 创建发件箱中继，opts配置日志输出
+func NewRelay(database *gorm.DB, publisher Publisher, config *RelayConfig, opts ...log_utils.Option) (*Relay, error) {
+	if database == nil || publisher == nil {
+		return nil, errors.New("relay requires a database and a publisher")
+	}
+	if config == nil {
+		config = DefaultRelayConfig()
+	}
+	defaults := DefaultRelayConfig()
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaults.RetryBackoff
+	}
+	if config.MaxBackoff < config.RetryBackoff {
+		config.MaxBackoff = config.RetryBackoff
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Relay{
+		mapper:    db.NewMapper[Event](database),
+		publisher: publisher,
+		config:    config,
+		ctx:       ctx,
+		cancel:    cancel,
+		logger:    log_utils.NewLogger("mq-outbox", opts...),
+	}, nil
+}
+
+// Start 启动轮询协程
+func (r *Relay) Start() {
+	r.startOnce.Do(func() {
+		r.wg.Add(1)
+		go r.loop()
+		r.logger.Info("Outbox relay started", "interval", r.config.PollInterval)
+	})
+}
+
+// Stop 停止轮询，等待进行中的发布完成
+func (r *Relay) Stop() {
+	r.stopOnce.Do(func() {
+		r.cancel()
+		r.wg.Wait()
+		r.logger.Info("Outbox relay stopped")
+	})
+}
+
+// Published 返回发布成功的事件数量
+func (r *Relay) Published() uint64 {
+	return atomic.LoadUint64(&r.published)
+}
+
+// Failed 返回发布失败的次数
+func (r *Relay) Failed() uint64 {
+	return atomic.LoadUint64(&r.failed)
+}
+
+func (r *Relay) loop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			// 一批发满时说明可能还有积压，立即继续
+			for {
+				count, err := r.Flush()
+				if err != nil {
+					r.logger.Error("Poll outbox failed", "error", err)
+				}
+				if err != nil || count < r.config.BatchSize || r.ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Flush 执行一次轮询，发布到期的事件并返回处理的事件数量
+func (r *Relay) Flush() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	// 同一排序键中更早的事件仍在退避等待时，后续事件不能越过它先发布
+	result := r.mapper.
+		Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+		Where("message_key = '' OR NOT EXISTS (SELECT 1 FROM mq_outbox AS earlier WHERE earlier.message_key = mq_outbox.message_key AND earlier.status = ? AND earlier.id < mq_outbox.id AND earlier.next_attempt_at > ?)", StatusPending, now).
+		Order("id").
+		Limit(r.config.BatchSize).
+		Find()
+	if result.Err != nil {
+		return 0, result.Err
+	}
+
+	// 同一排序键的事件发布失败后，本轮跳过该键后续的事件以保持顺序
+	blocked := make(map[string]struct{})
+	for _, event := range result.Data {
+		if event.Key != "" {
+			if _, ok := blocked[event.Key]; ok {
+				continue
+			}
+		}
+		if err := r.publish(event, now); err != nil {
+			if event.Key != "" {
+				blocked[event.Key] = struct{}{}
+			}
+		}
+	}
+
+	if !r.config.PurgeSent && r.config.Retention > 0 {
+		purged := r.mapper.Where("status = ? AND sent_at < ?", StatusSent, now.Add(-r.config.Retention)).Delete()
+		if purged.Err != nil {
+			r.logger.Error("Purge sent events failed", "error", purged.Err)
+		} else if purged.Rows > 0 {
+			r.logger.Debug("Purged sent events", "count", purged.Rows)
+		}
+	}
+	return len(result.Data), nil
+}
+
+// publish 发布单个事件并记录结果
+func (r *Relay) publish(event *Event, now time.Time) error {
+	msg, err := event.Message()
+	if err == nil {
+		err = r.publisher.Publish(msg)
+	}
+	if err != nil {
+		atomic.AddUint64(&r.failed, 1)
+		r.markFailed(event, err, now)
+		return err
+	}
+
+	atomic.AddUint64(&r.published, 1)
+	var update *db.Result[int64]
+	if r.config.PurgeSent {
+		update = r.mapper.DeleteWhere(map[string]interface{}{"id": event.ID})
+	} else {
+		update = r.mapper.UpdateWhere(map[string]interface{}{"id": event.ID}, map[string]interface{}{
+			"status":  StatusSent,
+			"sent_at": now,
+		})
+	}
+	if update.Err != nil {
+		// 下一次轮询会再次发布，订阅方可以按消息ID去重
+		r.logger.Error("Mark event sent failed", "event", event.ID, "message", event.MessageID, "error", update.Err)
+	} else {
+		r.logger.Debug("Event published", "event", event.ID, "message", event.MessageID, "topic", event.Topic)
+	}
+	return nil
+}
+
+// markFailed 记录发布失败，按指数退避安排下一次重试，超过最大次数时标记为失败
+func (r *Relay) markFailed(event *Event, cause error, now time.Time) {
+	attempts := event.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":   attempts,
+		"last_error": cause.Error(),
+	}
+	if r.config.MaxAttempts > 0 && attempts >= r.config.MaxAttempts {
+		updates["status"] = StatusFailed
+		r.logger.Error("Event publish failed, giving up", "event", event.ID, "message", event.MessageID, "attempts", attempts, "error", cause)
+	} else {
+		updates["next_attempt_at"] = now.Add(r.backoff(attempts))
+		r.logger.Warn("Event publish failed, will retry", "event", event.ID, "message", event.MessageID, "attempts", attempts, "error", cause)
+	}
+	if update := r.mapper.UpdateWhere(map[string]interface{}{"id": event.ID}, updates); update.Err != nil {
+		r.logger.Error("Record publish failure failed", "event", event.ID, "error", update.Err)
+	}
+}
+
+// backoff 返回第attempts次失败后的等待时间
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.config.RetryBackoff
+	for i := 1; i < attempts && delay < r.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.config.MaxBackoff)
+}
@@ -0,0 +1,160 @@
+package mq
+
+import (
+	"sync"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/16 10 00
+//
+
+// 多级优先级队列：每个优先级一个有界队列，分发协程按加权公平的方式取消息。
+// 每一轮中优先级p最多被取Weight(p)次，同一轮内总是先取高优先级，
+// 高优先级的额度用完或队列为空时才轮到低优先级，所有非空队列的额度都用完后开始新的一轮，
+// 因此低优先级消息在高优先级持续积压时仍能获得固定比例的分发机会，不会饿死。
+// 带排序键的消息在所属分区内保持发布顺序，不参与优先级调度。
+
+// Priority 消息优先级，零值为PriorityNormal
+type Priority int8
+
+const (
+	PriorityLow      Priority = -1 // 低优先级，如批量数据
+	PriorityNormal   Priority = 0  // 默认优先级
+	PriorityHigh     Priority = 1  // 高优先级
+	PriorityCritical Priority = 2  // 最高优先级，如告警
+
+	priorityLevels = int(PriorityCritical-PriorityLow) + 1
+)
+
+// Priorities 所有优先级，从高到低
+var Priorities = []Priority{PriorityCritical, PriorityHigh, PriorityNormal, PriorityLow}
+
+// DefaultPriorityWeights 默认的各优先级每轮分发份额
+var DefaultPriorityWeights = map[Priority]int{
+	PriorityCritical: 8,
+	PriorityHigh:     4,
+	PriorityNormal:   2,
+	PriorityLow:      1,
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// clamp 将超出范围的优先级限制到最近的有效优先级
+func (p Priority) clamp() Priority {
+	return max(PriorityLow, min(p, PriorityCritical))
+}
+
+// level 返回优先级在队列数组中的下标，0为最高优先级
+func (p Priority) level() int {
+	return int(PriorityCritical - p.clamp())
+}
+
+// priorityQueue 多级优先级队列
+type priorityQueue struct {
+	levels  [priorityLevels]chan *Message
+	weights [priorityLevels]int
+	// ready 中的每个令牌对应一条已入队的消息，取令牌后一定能取到消息
+	ready chan struct{}
+
+	mu      sync.Mutex
+	credits [priorityLevels]int // 当前轮次各优先级剩余的份额
+}
+
+// newPriorityQueue 创建优先级队列，sizes和weights中未配置的优先级使用defaultSize和默认份额
+func newPriorityQueue(defaultSize int, sizes map[Priority]int, weights map[Priority]int) *priorityQueue {
+	q := &priorityQueue{}
+	total := 0
+	for _, p := range Priorities {
+		size := sizes[p]
+		if size <= 0 {
+			size = defaultSize
+		}
+		weight := weights[p]
+		if weight <= 0 {
+			weight = DefaultPriorityWeights[p]
+		}
+		q.levels[p.level()] = make(chan *Message, size)
+		q.weights[p.level()] = weight
+		total += size
+	}
+	q.credits = q.weights
+	q.ready = make(chan struct{}, total)
+	return q
+}
+
+// queue 返回消息所属优先级的队列
+func (q *priorityQueue) queue(msg *Message) chan *Message {
+	return q.levels[msg.Priority.level()]
+}
+
+// signal 通知分发协程有新消息入队，必须在消息写入queue之后调用
+func (q *priorityQueue) signal() {
+	q.ready <- struct{}{}
+}
+
+// pop 阻塞直到取出一条消息，队列关闭且取完后返回false
+func (q *priorityQueue) pop() (*Message, bool) {
+	if _, ok := <-q.ready; !ok {
+		return nil, false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		nonEmpty := false
+		for level, queue := range q.levels {
+			if len(queue) == 0 {
+				continue
+			}
+			nonEmpty = true
+			if q.credits[level] == 0 {
+				continue
+			}
+			q.credits[level]--
+			return <-queue, true
+		}
+		if !nonEmpty {
+			// 不会发生：令牌总是在消息入队之后发出
+			return nil, false
+		}
+		// 所有非空队列的份额都已用完，开始新的一轮
+		q.credits = q.weights
+	}
+}
+
+// close 关闭队列，剩余的消息仍可被取出
+func (q *priorityQueue) close() {
+	close(q.ready)
+}
+
+// size 返回所有优先级中等待分发的消息数量
+func (q *priorityQueue) size() int {
+	count := 0
+	for _, queue := range q.levels {
+		count += len(queue)
+	}
+	return count
+}
+
+// lengths 返回各优先级中等待分发的消息数量
+func (q *priorityQueue) lengths() map[Priority]int {
+	result := make(map[Priority]int, priorityLevels)
+	for _, p := range Priorities {
+		result[p] = len(q.levels[p.level()])
+	}
+	return result
+}
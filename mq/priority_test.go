@@ -0,0 +1,72 @@
+package mq
+
+import (
+	"strings"
+	"testing"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/16 15 20
+//
+
+func TestPriorityQueue_WeightedFairShare(t *testing.T) {
+	q := newPriorityQueue(100, nil, map[Priority]int{PriorityCritical: 3, PriorityLow: 1})
+	push := func(priority Priority, count int) {
+		for i := 0; i < count; i++ {
+			msg := NewMessage("t", nil)
+			msg.SetPriority(priority)
+			q.queue(msg) <- msg
+			q.signal()
+		}
+	}
+	push(PriorityLow, 3)
+	push(PriorityCritical, 7)
+	push(PriorityNormal, 1)
+
+	order := make([]string, 0)
+	for q.size() > 0 {
+		msg, ok := q.pop()
+		if !ok {
+			t.Fatal("unexpected closed queue")
+		}
+		order = append(order, msg.Priority.String()[:1])
+	}
+
+	// 每轮critical最多3次，normal和low各自的份额保证不会饿死
+	expected := "cccnlcccl" + "cl"
+	if got := strings.Join(order, ""); got != expected {
+		t.Fatalf("expected dispatch order %s, got %s", expected, got)
+	}
+
+	q.close()
+	if _, ok := q.pop(); ok {
+		t.Fatal("expected pop to fail after close")
+	}
+}
+
+func TestPriority_Clamp(t *testing.T) {
+	if Priority(100).level() != PriorityCritical.level() {
+		t.Fatal("expected out of range priority to be clamped to critical")
+	}
+	if Priority(-100).level() != PriorityLow.level() {
+		t.Fatal("expected out of range priority to be clamped to low")
+	}
+}
+
+func TestMQ_PriorityQueueSizes(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.PriorityQueueSizes = map[Priority]int{PriorityCritical: 2}
+	b := NewMessageBroker(config)
+	if got := cap(b.pendingMessages.queue(&Message{Priority: PriorityCritical})); got != 2 {
+		t.Fatalf("expected critical queue size 2, got %d", got)
+	}
+	if got := cap(b.pendingMessages.queue(&Message{})); got != config.QueueSize {
+		t.Fatalf("expected normal queue size %d, got %d", config.QueueSize, got)
+	}
+
+	stats := b.GetStats()
+	if len(stats.PriorityQueues) != len(Priorities) {
+		t.Fatalf("expected %d priority queues in stats, got %v", len(Priorities), stats.PriorityQueues)
+	}
+}
@@ -0,0 +1,113 @@
+package mq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/5 14 30
+//
+
+// prometheusContentType Prometheus文本格式的Content-Type
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// MetricsHandler 返回以Prometheus文本格式输出代理指标的http.Handler
+func (b *MessageBroker) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", prometheusContentType)
+		if err := b.WritePrometheus(w); err != nil {
+			b.logger.Error("Write metrics failed", "error", err)
+		}
+	})
+}
+
+// WritePrometheus 以Prometheus文本格式写出代理指标
+func (b *MessageBroker) WritePrometheus(w io.Writer) error {
+	stats := b.GetStats()
+	bw := bufio.NewWriter(w)
+
+	running := 0
+	if stats.Running {
+		running = 1
+	}
+	writeMetric(bw, "mq_up", "gauge", "Whether the broker is running.", float64(running))
+
+	writeMetric(bw, "mq_messages_published_total", "counter", "Total number of published messages.", float64(stats.Published))
+	writeMetric(bw, "mq_messages_delivered_total", "counter", "Total number of successful handler invocations.", float64(stats.Delivered))
+	writeMetric(bw, "mq_messages_expired_total", "counter", "Total number of messages expired before distribution.", float64(stats.Expired))
+	writeMetric(bw, "mq_messages_failed_total", "counter", "Total number of failed handler invocations, including retries.", float64(stats.Failed))
+	writeMetric(bw, "mq_messages_dead_lettered_total", "counter", "Total number of messages routed to dead letter topics.", float64(stats.DeadLettered))
+	writeMetric(bw, "mq_messages_dropped_total", "counter", "Total number of messages dropped by subscriber inbox overflow.", float64(stats.Dropped))
+	writeMetric(bw, "mq_messages_deduplicated_total", "counter", "Total number of duplicate messages dropped within the dedup window.", float64(stats.Deduplicated))
+	writeMetric(bw, "mq_access_denied_total", "counter", "Total number of publish and subscribe attempts denied by the authorizer.", float64(stats.Denied))
+
+	writeMetric(bw, "mq_subscribers", "gauge", "Number of registered subscribers.", float64(stats.TotalSubscribers))
+	writeMetric(bw, "mq_topics", "gauge", "Number of subscribed topic patterns.", float64(stats.TotalTopics))
+	writeMetric(bw, "mq_messages_stored", "gauge", "Number of messages held by the broker.", float64(stats.TotalMessages))
+	writeMetric(bw, "mq_pending_queue_size", "gauge", "Number of messages waiting for distribution.", float64(stats.PendingQueueSize))
+	writeMetric(bw, "mq_delivery_timers", "gauge", "Number of delayed messages waiting for delivery.", float64(stats.DeliveryTimers))
+	writeMetric(bw, "mq_retained_messages", "gauge", "Number of retained messages.", float64(stats.RetainedMessages))
+	writeMetric(bw, "mq_schedules", "gauge", "Number of recurring schedules.", float64(stats.Schedules))
+
+	// 每个优先级队列积压
+	writeHeader(bw, "mq_priority_queue_size", "gauge", "Number of messages waiting for distribution per priority.")
+	for _, priority := range sortedKeys(stats.PriorityQueues) {
+		fmt.Fprintf(bw, "mq_priority_queue_size{priority=\"%s\"} %d\n", priority, stats.PriorityQueues[priority])
+	}
+
+	// 每个订阅者收件箱积压
+	writeHeader(bw, "mq_subscriber_inbox_depth", "gauge", "Number of messages waiting in a subscriber inbox.")
+	for _, id := range sortedKeys(stats.SubscriberInbox) {
+		fmt.Fprintf(bw, "mq_subscriber_inbox_depth{subscriber=\"%s\"} %d\n", escapeLabel(id), stats.SubscriberInbox[id])
+	}
+
+	// 处理耗时直方图
+	writeHeader(bw, "mq_handler_duration_seconds", "histogram", "Handler execution time in seconds.")
+	for _, id := range sortedKeys(stats.HandlerLatency) {
+		snapshot := stats.HandlerLatency[id]
+		label := escapeLabel(id)
+		for i, bound := range snapshot.Buckets {
+			fmt.Fprintf(bw, "mq_handler_duration_seconds_bucket{subscriber=\"%s\",le=\"%s\"} %d\n",
+				label, formatFloat(bound), snapshot.Counts[i])
+		}
+		fmt.Fprintf(bw, "mq_handler_duration_seconds_bucket{subscriber=\"%s\",le=\"+Inf\"} %d\n", label, snapshot.Count)
+		fmt.Fprintf(bw, "mq_handler_duration_seconds_sum{subscriber=\"%s\"} %s\n", label, formatFloat(snapshot.Sum))
+		fmt.Fprintf(bw, "mq_handler_duration_seconds_count{subscriber=\"%s\"} %d\n", label, snapshot.Count)
+	}
+
+	return bw.Flush()
+}
+
+func writeHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func writeMetric(w io.Writer, name, metricType, help string, value float64) {
+	writeHeader(w, name, metricType, help)
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escapeLabel 转义标签值中的反斜杠、双引号和换行
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
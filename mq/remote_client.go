@@ -0,0 +1,235 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yui100901/MyGo/concurrency"
+	"github.com/Yui100901/MyGo/log_utils"
+	"github.com/Yui100901/MyGo/network/tcp_utils"
+	"github.com/Yui100901/MyGo/network/websocket_utils"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/29 14 30
+//
+
+// RemoteClient 远程消息代理客户端，接口与MessageBroker保持一致
+type RemoteClient struct {
+	id       string
+	conn     frameConn
+	handlers *concurrency.SafeMap[Topic, MessageHandler]     // 订阅处理函数: pattern -> handler
+	pending  *concurrency.SafeMap[uint64, chan *remoteFrame] // 等待响应的请求: seq -> result
+	seq      uint64
+	timeout  time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	logger *slog.Logger
+}
+
+// DialTCP 通过TCP连接远程消息代理，opts配置日志输出
+func DialTCP(addr string, clientID string, timeout time.Duration, opts ...log_utils.Option) (*RemoteClient, error) {
+	return DialTCPWithToken(addr, clientID, "", timeout, opts...)
+}
+
+// DialTCPWithToken 通过TCP连接远程消息代理，并使用令牌认证身份
+func DialTCPWithToken(addr string, clientID string, token string, timeout time.Duration, opts ...log_utils.Option) (*RemoteClient, error) {
+	conn, err := tcp_utils.Dial(addr, timeout, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newRemoteClient(newTCPFrameConn(conn), clientID, token, opts...)
+}
+
+// DialWebSocket 通过WebSocket连接远程消息代理，opts配置日志输出
+func DialWebSocket(url string, clientID string, requestHeader http.Header, opts ...log_utils.Option) (*RemoteClient, error) {
+	return DialWebSocketWithToken(url, clientID, "", requestHeader, opts...)
+}
+
+// DialWebSocketWithToken 通过WebSocket连接远程消息代理，并使用令牌认证身份
+func DialWebSocketWithToken(url string, clientID string, token string, requestHeader http.Header, opts ...log_utils.Option) (*RemoteClient, error) {
+	conn, err := websocket_utils.NewWebSocketByDial(nil, url, requestHeader, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newRemoteClient(newWSFrameConn(conn), clientID, token, opts...)
+}
+
+func newRemoteClient(conn frameConn, clientID string, token string, opts ...log_utils.Option) (*RemoteClient, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &RemoteClient{
+		id:       clientID,
+		conn:     conn,
+		handlers: concurrency.NewSafeMap[Topic, MessageHandler](32),
+		pending:  concurrency.NewSafeMap[uint64, chan *remoteFrame](32),
+		timeout:  defaultRemoteTimeout,
+		ctx:      ctx,
+		cancel:   cancel,
+		logger:   log_utils.NewLogger("mq-client", opts...).With("client", clientID),
+	}
+
+	go func() {
+		if err := conn.Serve(c.handleFrame); err != nil {
+			c.logger.Warn("Connection closed with error", "error", err)
+		}
+		c.cancel()
+	}()
+
+	if err := c.call(&remoteFrame{Type: frameConnect, ClientID: clientID, Token: token}); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("connect failed: %w", err)
+	}
+	return c, nil
+}
+
+// ID 返回客户端ID，即其在远程代理中的订阅者ID
+func (c *RemoteClient) ID() string {
+	return c.id
+}
+
+// SetTimeout 设置请求超时时间
+func (c *RemoteClient) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// Publish 发布消息
+func (c *RemoteClient) Publish(msg *Message) error {
+	return c.call(&remoteFrame{Type: framePublish, Message: msg})
+}
+
+// Subscribe 订阅主题
+func (c *RemoteClient) Subscribe(topicMap map[Topic]MessageHandler) error {
+	return c.SubscribeGroup("", topicMap)
+}
+
+// SubscribeGroup 以消费者组成员身份订阅
+func (c *RemoteClient) SubscribeGroup(group string, topicMap map[Topic]MessageHandler) error {
+	if len(topicMap) == 0 {
+		return nil
+	}
+	topics := make([]Topic, 0, len(topicMap))
+	for topic, handler := range topicMap {
+		topics = append(topics, topic)
+		c.handlers.Set(topic, handler)
+	}
+	if err := c.call(&remoteFrame{Type: frameSubscribe, Topics: topics, Group: group}); err != nil {
+		for _, topic := range topics {
+			c.handlers.Delete(topic)
+		}
+		return err
+	}
+	return nil
+}
+
+// Unsubscribe 取消订阅
+func (c *RemoteClient) Unsubscribe(topics []Topic) error {
+	if len(topics) == 0 {
+		return nil
+	}
+	if err := c.call(&remoteFrame{Type: frameUnsubscribe, Topics: topics}); err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		c.handlers.Delete(topic)
+	}
+	return nil
+}
+
+// Close 关闭连接，远程代理会自动注销该订阅者
+func (c *RemoteClient) Close() {
+	c.cancel()
+	c.conn.Close()
+}
+
+// Done 获取连接关闭信号通道
+func (c *RemoteClient) Done() <-chan struct{} {
+	return c.conn.Done()
+}
+
+// call 发送请求并等待服务端响应
+func (c *RemoteClient) call(frame *remoteFrame) error {
+	frame.Seq = atomic.AddUint64(&c.seq, 1)
+	result := make(chan *remoteFrame, 1)
+	c.pending.Set(frame.Seq, result)
+	defer c.pending.Delete(frame.Seq)
+
+	if err := c.send(frame); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-result:
+		if resp.Error != "" {
+			return errors.New(resp.Error)
+		}
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("request %s timeout", frame.Type)
+	case <-c.ctx.Done():
+		return errors.New("connection closed")
+	}
+}
+
+func (c *RemoteClient) handleFrame(data []byte) {
+	frame, err := decodeFrame(data)
+	if err != nil {
+		c.logger.Error("Decode frame failed", "error", err)
+		return
+	}
+
+	switch frame.Type {
+	case frameResult:
+		if result, ok := c.pending.Get(frame.Seq); ok {
+			select {
+			case result <- frame:
+			default:
+			}
+		}
+	case frameDeliver:
+		go c.handleDelivery(frame)
+	}
+}
+
+// handleDelivery 调用本地处理函数并向服务端确认处理结果
+func (c *RemoteClient) handleDelivery(frame *remoteFrame) {
+	ack := &remoteFrame{Type: frameAck, Seq: frame.Seq}
+	if err := c.invoke(frame); err != nil {
+		ack.Error = err.Error()
+	}
+	if err := c.send(ack); err != nil {
+		c.logger.Error("Ack message failed", "error", err)
+	}
+}
+
+func (c *RemoteClient) invoke(frame *remoteFrame) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	if frame.Message == nil || len(frame.Topics) == 0 {
+		return errors.New("invalid delivery")
+	}
+	handler, ok := c.handlers.Get(frame.Topics[0])
+	if !ok {
+		return fmt.Errorf("no handler for topic %s", frame.Topics[0])
+	}
+	return handler(c.ctx, frame.Message)
+}
+
+func (c *RemoteClient) send(frame *remoteFrame) error {
+	data, err := encodeFrame(frame)
+	if err != nil {
+		return err
+	}
+	return c.conn.Send(data)
+}
@@ -0,0 +1,128 @@
+package mq
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Yui100901/MyGo/network/tcp_utils"
+	"github.com/Yui100901/MyGo/network/websocket_utils"
+	"github.com/gorilla/websocket"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/29 10 20
+//
+
+const (
+	defaultRemoteTimeout = 10 * time.Second // 远程请求的默认超时时间
+	defaultAckTimeout    = 30 * time.Second // 远程订阅者确认消息的默认超时时间
+)
+
+// frameType 远程协议帧类型
+type frameType string
+
+const (
+	frameConnect     frameType = "connect"     // 客户端 -> 服务端：建立会话
+	framePublish     frameType = "publish"     // 客户端 -> 服务端：发布消息
+	frameSubscribe   frameType = "subscribe"   // 客户端 -> 服务端：订阅主题
+	frameUnsubscribe frameType = "unsubscribe" // 客户端 -> 服务端：取消订阅
+	frameResult      frameType = "result"      // 服务端 -> 客户端：请求结果
+	frameDeliver     frameType = "deliver"     // 服务端 -> 客户端：投递消息
+	frameAck         frameType = "ack"         // 客户端 -> 服务端：消息处理结果
+)
+
+// remoteFrame 远程协议帧，以JSON编码后通过连接的分帧机制传输
+type remoteFrame struct {
+	Type     frameType `json:"type"`
+	Seq      uint64    `json:"seq,omitempty"`       // 请求与响应、投递与确认的关联序号
+	ClientID string    `json:"client_id,omitempty"` // 客户端ID
+	Token    string    `json:"token,omitempty"`     // 认证令牌，仅在建立会话时携带
+	Topics   []Topic   `json:"topics,omitempty"`    // 订阅主题，投递时为命中的订阅模式
+	Group    string    `json:"group,omitempty"`     // 消费者组
+	Message  *Message  `json:"message,omitempty"`   // 消息
+	Error    string    `json:"error,omitempty"`     // 错误信息，为空表示成功
+}
+
+func encodeFrame(frame *remoteFrame) ([]byte, error) {
+	return json.Marshal(frame)
+}
+
+func decodeFrame(data []byte) (*remoteFrame, error) {
+	var frame remoteFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return nil, err
+	}
+	return &frame, nil
+}
+
+// frameConn 面向帧的双向连接
+type frameConn interface {
+	Send(data []byte) error
+	Serve(handler func(data []byte)) error // 阻塞读取直到连接关闭
+	Done() <-chan struct{}
+	Close()
+	RemoteAddr() string
+}
+
+// tcpFrameConn 基于长度前缀分帧的TCP连接
+type tcpFrameConn struct {
+	conn *tcp_utils.TCPConn
+}
+
+func newTCPFrameConn(conn *tcp_utils.TCPConn) *tcpFrameConn {
+	// 长连接依靠对端关闭感知断开，不设置读超时
+	conn.SetTimeouts(0, defaultRemoteTimeout)
+	return &tcpFrameConn{conn: conn}
+}
+
+func (c *tcpFrameConn) Send(data []byte) error {
+	return c.conn.Write(data)
+}
+
+func (c *tcpFrameConn) Serve(handler func(data []byte)) error {
+	return c.conn.OnMessage(handler)
+}
+
+func (c *tcpFrameConn) Done() <-chan struct{} {
+	return c.conn.Done()
+}
+
+func (c *tcpFrameConn) Close() {
+	c.conn.Close()
+}
+
+func (c *tcpFrameConn) RemoteAddr() string {
+	return c.conn.RemoteAddr()
+}
+
+// wsFrameConn 基于WebSocket文本帧的连接
+type wsFrameConn struct {
+	conn *websocket_utils.WebSocket
+}
+
+func newWSFrameConn(conn *websocket_utils.WebSocket) *wsFrameConn {
+	return &wsFrameConn{conn: conn}
+}
+
+func (c *wsFrameConn) Send(data []byte) error {
+	return c.conn.SendMessage(websocket.TextMessage, data)
+}
+
+func (c *wsFrameConn) Serve(handler func(data []byte)) error {
+	return c.conn.OnMessage(func(messageType int, payload []byte) {
+		handler(payload)
+	})
+}
+
+func (c *wsFrameConn) Done() <-chan struct{} {
+	return c.conn.Done()
+}
+
+func (c *wsFrameConn) Close() {
+	c.conn.Close()
+}
+
+func (c *wsFrameConn) RemoteAddr() string {
+	return c.conn.RemoteAddr()
+}
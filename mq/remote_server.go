@@ -0,0 +1,244 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yui100901/MyGo/concurrency"
+	"github.com/Yui100901/MyGo/log_utils"
+	"github.com/Yui100901/MyGo/network/tcp_utils"
+	"github.com/Yui100901/MyGo/network/websocket_utils"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/29 11 05
+//
+
+// BrokerServer 通过TCP和WebSocket对外暴露消息代理的发布订阅能力
+// 每个远程客户端在代理中注册为一个同名的Subscriber，连接断开时自动注销
+type BrokerServer struct {
+	broker     *MessageBroker
+	sessions   *concurrency.SafeMap[string, *remoteSession] // 会话表: clientID -> session
+	ackTimeout time.Duration                                // 等待远程订阅者确认的超时时间
+
+	authenticator Authenticator // 客户端身份认证，为nil时不认证
+
+	logHandler slog.Handler // 日志处理器，连接和远程订阅者共用
+	logger     *slog.Logger
+}
+
+// NewBrokerServer 创建消息代理服务端，未指定opts时沿用消息代理的日志处理器
+func NewBrokerServer(broker *MessageBroker, opts ...log_utils.Option) *BrokerServer {
+	logHandler := log_utils.NewHandler(append([]log_utils.Option{log_utils.WithHandler(broker.logHandler)}, opts...)...)
+	return &BrokerServer{
+		broker:     broker,
+		sessions:   concurrency.NewSafeMap[string, *remoteSession](32),
+		ackTimeout: defaultAckTimeout,
+		logHandler: logHandler,
+		logger:     slog.New(logHandler).With("component", "mq-server"),
+	}
+}
+
+// SetAckTimeout 设置等待远程订阅者确认消息的超时时间，超时视为处理失败并触发重试
+func (s *BrokerServer) SetAckTimeout(timeout time.Duration) {
+	s.ackTimeout = timeout
+}
+
+// SetAuthenticator 设置客户端身份认证
+// 设置后客户端必须在建立会话时携带有效的令牌，且发布消息的SenderID固定为客户端ID，
+// 以便代理的授权检查使用经过认证的身份
+func (s *BrokerServer) SetAuthenticator(authenticator Authenticator) {
+	s.authenticator = authenticator
+}
+
+// ListenAndServeTCP 监听TCP地址
+func (s *BrokerServer) ListenAndServeTCP(addr string) error {
+	return tcp_utils.ListenAndServe(addr, s.ServeTCPConn, log_utils.WithHandler(s.logHandler))
+}
+
+// ServeTCP 在已有的监听器上接受TCP连接
+func (s *BrokerServer) ServeTCP(listener net.Listener) error {
+	return tcp_utils.Serve(listener, s.ServeTCPConn, log_utils.WithHandler(s.logHandler))
+}
+
+// ServeTCPConn 处理单个TCP连接，阻塞直到连接关闭
+func (s *BrokerServer) ServeTCPConn(conn *tcp_utils.TCPConn) {
+	s.serveConn(newTCPFrameConn(conn))
+}
+
+// ServeHTTP 将HTTP请求升级为WebSocket连接并处理，阻塞直到连接关闭
+func (s *BrokerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket_utils.NewWebSocketByUpgrade(nil, w, r, nil, log_utils.WithHandler(s.logHandler))
+	if err != nil {
+		s.logger.Error("Upgrade websocket failed", "error", err)
+		return
+	}
+	s.serveConn(newWSFrameConn(conn))
+}
+
+// SessionCount 返回当前在线的远程客户端数量
+func (s *BrokerServer) SessionCount() int {
+	return s.sessions.Length()
+}
+
+func (s *BrokerServer) serveConn(conn frameConn) {
+	session := &remoteSession{
+		server:      s,
+		conn:        conn,
+		pendingAcks: concurrency.NewSafeMap[uint64, chan error](32),
+	}
+	if err := conn.Serve(session.handleFrame); err != nil {
+		s.logger.Warn("Connection closed with error", "remote", conn.RemoteAddr(), "error", err)
+	}
+}
+
+// remoteSession 一个远程客户端的会话
+type remoteSession struct {
+	server      *BrokerServer
+	conn        frameConn
+	clientID    string
+	pendingAcks *concurrency.SafeMap[uint64, chan error] // 等待确认的投递: seq -> result
+	deliverSeq  uint64
+}
+
+func (sess *remoteSession) handleFrame(data []byte) {
+	frame, err := decodeFrame(data)
+	if err != nil {
+		sess.server.logger.Error("Decode frame failed", "remote", sess.conn.RemoteAddr(), "error", err)
+		return
+	}
+
+	if sess.clientID == "" && frame.Type != frameConnect {
+		sess.reply(frame.Seq, errors.New("session not connected"))
+		return
+	}
+
+	switch frame.Type {
+	case frameConnect:
+		sess.reply(frame.Seq, sess.connect(frame))
+	case framePublish:
+		sess.reply(frame.Seq, sess.publish(frame))
+	case frameSubscribe:
+		sess.reply(frame.Seq, sess.subscribe(frame))
+	case frameUnsubscribe:
+		sess.server.broker.Unsubscribe(sess.clientID, frame.Topics)
+		sess.reply(frame.Seq, nil)
+	case frameAck:
+		if ch, ok := sess.pendingAcks.Get(frame.Seq); ok {
+			var ackErr error
+			if frame.Error != "" {
+				ackErr = errors.New(frame.Error)
+			}
+			select {
+			case ch <- ackErr:
+			default:
+			}
+		}
+	default:
+		sess.reply(frame.Seq, fmt.Errorf("unknown frame type %s", frame.Type))
+	}
+}
+
+func (sess *remoteSession) connect(frame *remoteFrame) error {
+	if sess.clientID != "" {
+		return errors.New("session already connected")
+	}
+	if err := ValidateID(frame.ClientID); err != nil {
+		return err
+	}
+	if s := sess.server; s.authenticator != nil {
+		if err := s.authenticator.Authenticate(frame.ClientID, frame.Token); err != nil {
+			s.broker.recordDenied()
+			s.logger.Warn("Remote client authentication failed", "client", frame.ClientID, "remote", sess.conn.RemoteAddr(), "error", err)
+			return err
+		}
+	}
+
+	subscriber := NewSubscriber(frame.ClientID, log_utils.WithHandler(sess.server.logHandler))
+	if err := sess.server.broker.RegisterSubscriber(subscriber); err != nil {
+		return err
+	}
+	sess.clientID = frame.ClientID
+	sess.server.sessions.Set(sess.clientID, sess)
+	sess.server.logger.Info("Remote client connected", "client", sess.clientID, "remote", sess.conn.RemoteAddr())
+
+	// 连接断开时自动注销订阅者
+	go func() {
+		<-sess.conn.Done()
+		sess.server.broker.UnregisterSubscriber(sess.clientID)
+		sess.server.sessions.Delete(sess.clientID)
+		sess.server.logger.Info("Remote client disconnected", "client", sess.clientID)
+	}()
+	return nil
+}
+
+func (sess *remoteSession) publish(frame *remoteFrame) error {
+	if frame.Message == nil {
+		return errors.New("message can not be empty")
+	}
+	msg := frame.Message
+	if msg.SenderID == "" || sess.server.authenticator != nil {
+		msg.SenderID = sess.clientID
+	}
+	return sess.server.broker.Publish(msg)
+}
+
+func (sess *remoteSession) subscribe(frame *remoteFrame) error {
+	topicMap := make(map[Topic]MessageHandler, len(frame.Topics))
+	for _, topic := range frame.Topics {
+		topicMap[topic] = sess.forward(topic)
+	}
+	return sess.server.broker.SubscribeGroup(sess.clientID, frame.Group, topicMap)
+}
+
+// forward 返回将消息转发给远程客户端并等待其确认的处理函数
+func (sess *remoteSession) forward(pattern Topic) MessageHandler {
+	return func(ctx context.Context, msg *Message) error {
+		seq := atomic.AddUint64(&sess.deliverSeq, 1)
+		result := make(chan error, 1)
+		sess.pendingAcks.Set(seq, result)
+		defer sess.pendingAcks.Delete(seq)
+
+		if err := sess.send(&remoteFrame{Type: frameDeliver, Seq: seq, Topics: []Topic{pattern}, Message: msg}); err != nil {
+			return fmt.Errorf("deliver to remote client %s failed: %w", sess.clientID, err)
+		}
+
+		timer := time.NewTimer(sess.server.ackTimeout)
+		defer timer.Stop()
+		select {
+		case err := <-result:
+			return err
+		case <-timer.C:
+			return fmt.Errorf("remote client %s ack timeout", sess.clientID)
+		case <-sess.conn.Done():
+			return fmt.Errorf("remote client %s disconnected", sess.clientID)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (sess *remoteSession) reply(seq uint64, err error) {
+	frame := &remoteFrame{Type: frameResult, Seq: seq}
+	if err != nil {
+		frame.Error = err.Error()
+	}
+	if sendErr := sess.send(frame); sendErr != nil {
+		sess.server.logger.Error("Reply failed", "remote", sess.conn.RemoteAddr(), "error", sendErr)
+	}
+}
+
+func (sess *remoteSession) send(frame *remoteFrame) error {
+	data, err := encodeFrame(frame)
+	if err != nil {
+		return err
+	}
+	return sess.conn.Send(data)
+}
@@ -0,0 +1,139 @@
+package mq
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/29 16 10
+//
+
+func startRemoteBroker(t *testing.T) (*MessageBroker, *BrokerServer, string) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	t.Cleanup(func() { b.Stop() })
+
+	server := NewBrokerServer(b)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTCP(listener)
+	return b, server, listener.Addr().String()
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not satisfied before timeout")
+}
+
+func TestRemote_TCP(t *testing.T) {
+	b, server, addr := startRemoteBroker(t)
+
+	client, err := DialTCP(addr, "remote1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan *Message, 1)
+	err = client.Subscribe(map[Topic]MessageHandler{
+		"sensor/+": func(ctx context.Context, msg *Message) error {
+			received <- msg
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 本地发布，远程接收
+	b.Publish(NewMessage("sensor/1", []byte("21.5")))
+	select {
+	case msg := <-received:
+		if string(msg.Payload) != "21.5" {
+			t.Fatalf("unexpected payload %s", msg.Payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("remote subscriber did not receive message")
+	}
+
+	// 远程发布，本地接收
+	local := make(chan *Message, 1)
+	b.RegisterSubscriber(NewSubscriber("local"))
+	b.Subscribe("local", map[Topic]MessageHandler{
+		"command": func(ctx context.Context, msg *Message) error {
+			local <- msg
+			return nil
+		},
+	})
+	if err := client.Publish(NewMessage("command", []byte("reboot"))); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-local:
+		if msg.SenderID != "remote1" {
+			t.Fatalf("expected sender remote1, got %s", msg.SenderID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("local subscriber did not receive remote message")
+	}
+
+	// 重复ID的客户端应被拒绝
+	if _, err := DialTCP(addr, "remote1", time.Second); err == nil {
+		t.Fatal("duplicate client id should be rejected")
+	}
+
+	// 断开后自动注销
+	client.Close()
+	waitFor(t, 2*time.Second, func() bool {
+		_, exists := b.subscribers.Get("remote1")
+		return !exists && server.SessionCount() == 0
+	})
+}
+
+func TestRemote_WebSocket(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	httpServer := httptest.NewServer(NewBrokerServer(b))
+	defer httpServer.Close()
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	client, err := DialWebSocket(url, "ws1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	received := make(chan *Message, 1)
+	client.Subscribe(map[Topic]MessageHandler{
+		"news": func(ctx context.Context, msg *Message) error {
+			received <- msg
+			return nil
+		},
+	})
+	if err := client.Publish(NewMessage("news", []byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-received:
+		if string(msg.Payload) != "hello" {
+			t.Fatalf("unexpected payload %s", msg.Payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("websocket subscriber did not receive message")
+	}
+}
@@ -0,0 +1,76 @@
+package mq
+
+//
+// @Author yfy2001
+// @Date 2025/9/4 09 30
+//
+
+// 保留消息：每个主题保存最后一条Retained消息，新的订阅注册时立即投递匹配的保留消息。
+// 发布载荷为空的保留消息会清除该主题的保留消息，但仍会正常投递给当前订阅者。
+// 消费者组订阅不接收保留消息，避免组成员重复处理同一状态。
+
+// retain 发布时更新主题的保留消息，延迟消息到期投递时才更新，避免新订阅者提前收到
+func (b *MessageBroker) retain(msg *Message) {
+	if msg.Delay > 0 {
+		return
+	}
+	b.updateRetained(msg)
+}
+
+// updateRetained 更新主题的保留消息
+func (b *MessageBroker) updateRetained(msg *Message) {
+	if !msg.Retained {
+		return
+	}
+	if len(msg.Payload) == 0 {
+		b.retained.Delete(msg.Topic)
+		b.logger.Debug("Cleared retained message", "topic", msg.Topic)
+		return
+	}
+	retainedCopy := msg.Clone()
+	retainedCopy.tracker = nil
+	b.retained.Set(msg.Topic, retainedCopy)
+}
+
+// deliverRetained 将与订阅模式匹配的保留消息投递给订阅者，
+// 先收集再投递，订阅者收件箱阻塞时不会占用保留消息表的锁
+func (b *MessageBroker) deliverRetained(subscriber *Subscriber, patterns []Topic) {
+	type retainedMatch struct {
+		msg     *Message
+		pattern Topic
+	}
+	expired := make([]Topic, 0)
+	matches := make([]retainedMatch, 0)
+	b.retained.ForEach(func(topic Topic, msg *Message) bool {
+		if msg.IsExpired() {
+			expired = append(expired, topic)
+			return true
+		}
+		for _, pattern := range patterns {
+			if pattern.Matches(topic) {
+				matches = append(matches, retainedMatch{msg: msg.Clone(), pattern: pattern})
+			}
+		}
+		return true
+	})
+	for _, topic := range expired {
+		b.retained.Delete(topic)
+	}
+	for _, match := range matches {
+		subscriber.deliver(match.msg, []Topic{match.pattern})
+	}
+}
+
+// GetRetainedMessage 获取主题当前的保留消息
+func (b *MessageBroker) GetRetainedMessage(topic Topic) (*Message, bool) {
+	msg, ok := b.retained.Get(topic)
+	if !ok || msg.IsExpired() {
+		return nil, false
+	}
+	return msg.Clone(), true
+}
+
+// ClearRetainedMessage 清除主题的保留消息
+func (b *MessageBroker) ClearRetainedMessage(topic Topic) {
+	b.retained.Delete(topic)
+}
@@ -0,0 +1,164 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/4 11 00
+//
+
+func TestMQ_RetainedMessage(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	subscribe := func(id string, pattern Topic) chan *Message {
+		received := make(chan *Message, 4)
+		b.RegisterSubscriber(NewSubscriber(id))
+		b.Subscribe(id, map[Topic]MessageHandler{
+			pattern: func(ctx context.Context, msg *Message) error {
+				received <- msg
+				return nil
+			},
+		})
+		return received
+	}
+	expect := func(ch chan *Message, payload string) {
+		t.Helper()
+		select {
+		case msg := <-ch:
+			if string(msg.Payload) != payload {
+				t.Fatalf("expected payload %q, got %q", payload, msg.Payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected payload %q, got nothing", payload)
+		}
+	}
+
+	status := NewMessage("device/1/status", []byte("online"))
+	status.SetRetained(true)
+	b.Publish(status)
+	// 等待发布时的分发结束（此时没有订阅者），之后的订阅只会收到保留消息
+	waitFor(t, time.Second, func() bool {
+		_, err := b.GetMessage(status.ID)
+		return err != nil
+	})
+
+	// 新订阅立即收到保留消息，通配符订阅同样生效
+	expect(subscribe("exact", "device/1/status"), "online")
+	wildcard := subscribe("wildcard", "device/+/status")
+	expect(wildcard, "online")
+
+	// 空载荷清除保留消息，但当前订阅者仍会收到
+	cleared := NewMessage("device/1/status", nil)
+	cleared.SetRetained(true)
+	b.Publish(cleared)
+	expect(wildcard, "")
+	if _, ok := b.GetRetainedMessage("device/1/status"); ok {
+		t.Fatal("retained message should be cleared")
+	}
+
+	late := subscribe("late", "device/#")
+	select {
+	case msg := <-late:
+		t.Fatalf("unexpected retained message %s", msg.Payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMQ_RetainedSlowSubscriber(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	for _, topic := range []Topic{"device/1/status", "device/2/status", "device/3/status"} {
+		msg := NewMessage(topic, []byte("online"))
+		msg.SetRetained(true)
+		b.Publish(msg)
+	}
+
+	// 收件箱只有一个位置且处理函数阻塞，投递保留消息时订阅会被阻塞
+	release := make(chan struct{})
+	slow := NewSubscriberWithConfig("slow", &SubscriberConfig{InboxSize: 1, Workers: 1, OverflowPolicy: OverflowBlock})
+	b.RegisterSubscriber(slow)
+	go b.Subscribe("slow", map[Topic]MessageHandler{
+		"device/#": func(ctx context.Context, msg *Message) error {
+			<-release
+			return nil
+		},
+	})
+	defer close(release)
+	time.Sleep(50 * time.Millisecond)
+
+	// 更新所有保留消息，其中必然包含正在投递的主题
+	published := make(chan error, 1)
+	go func() {
+		for _, topic := range []Topic{"device/1/status", "device/2/status", "device/3/status"} {
+			msg := NewMessage(topic, []byte("offline"))
+			msg.SetRetained(true)
+			if err := b.Publish(msg); err != nil {
+				published <- err
+				return
+			}
+		}
+		published <- nil
+	}()
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked by slow retained delivery")
+	}
+}
+
+func TestMQ_RetainedDelayed(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	msg := NewMessage("device/1/status", []byte("online"))
+	msg.SetRetained(true)
+	msg.SetDelay(200 * time.Millisecond)
+	b.Publish(msg)
+
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := b.GetRetainedMessage("device/1/status"); ok {
+		t.Fatal("delayed message should not be retained before delivery")
+	}
+	waitFor(t, time.Second, func() bool {
+		_, ok := b.GetRetainedMessage("device/1/status")
+		return ok
+	})
+}
+
+func TestMQ_RetainedFailedPublish(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	status := NewMessage("device/1/status", []byte("online"))
+	status.SetRetained(true)
+	if err := b.Publish(status); err != nil {
+		t.Fatal(err)
+	}
+
+	// 入队失败的消息不能替换或清除已有的保留消息
+	b.closeQueues()
+	for _, payload := range []string{"offline", ""} {
+		failed := NewMessage("device/1/status", []byte(payload))
+		failed.SetRetained(true)
+		if err := b.Publish(failed); err == nil {
+			t.Fatal("expected publish to fail with closed queue")
+		}
+	}
+	retained, ok := b.GetRetainedMessage("device/1/status")
+	if !ok || string(retained.Payload) != "online" {
+		t.Fatalf("expected retained message unchanged, got %v", retained)
+	}
+}
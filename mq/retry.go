@@ -0,0 +1,72 @@
+package mq
+
+import (
+	"errors"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/27 09 30
+//
+
+// RetryPolicy 消息处理失败后的重试策略
+type RetryPolicy struct {
+	MaxAttempts    int           // 最大尝试次数（含首次投递）
+	InitialBackoff time.Duration // 首次重试前的等待时间
+	MaxBackoff     time.Duration // 最大等待时间
+	Multiplier     float64       // 指数退避倍数
+}
+
+// DefaultRetryPolicy 返回默认的重试策略
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+// Backoff 返回第attempt次尝试失败后的等待时间
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	for i := 1; i < attempt; i++ {
+		backoff *= multiplier
+		if p.MaxBackoff > 0 && backoff >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	return time.Duration(backoff)
+}
+
+// permanentError 不可重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent 将错误标记为不可重试，处理函数返回该错误时消息直接转入死信
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent 判断错误是否被标记为不可重试
+func IsPermanent(err error) bool {
+	var target *permanentError
+	return errors.As(err, &target)
+}
@@ -0,0 +1,84 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/27 11 10
+//
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, w := range want {
+		if got := p.Backoff(i + 1); got != w {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, w, got)
+		}
+	}
+}
+
+func TestMQ_RetryAndDeadLetter(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.RetryPolicy = &RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, Multiplier: 2}
+	b := NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+
+	var flakyCalls, failingCalls int32
+	deadLetters := make(chan *Message, 1)
+	succeeded := make(chan struct{}, 1)
+
+	c1 := NewSubscriber("c1")
+	b.RegisterSubscriber(c1)
+	b.Subscribe(c1.ID(), map[Topic]MessageHandler{
+		"flaky": func(ctx context.Context, msg *Message) error {
+			if atomic.AddInt32(&flakyCalls, 1) < 3 {
+				return errors.New("temporary failure")
+			}
+			succeeded <- struct{}{}
+			return nil
+		},
+		"failing": func(ctx context.Context, msg *Message) error {
+			atomic.AddInt32(&failingCalls, 1)
+			panic("boom")
+		},
+		TopicDeadLetterPrefix + "#": func(ctx context.Context, msg *Message) error {
+			deadLetters <- msg
+			return nil
+		},
+	})
+
+	b.Publish(NewMessage("flaky", []byte("retry me")))
+	original := NewMessage("failing", []byte("give up"))
+	b.Publish(original)
+
+	select {
+	case <-succeeded:
+	case <-time.After(time.Second):
+		t.Fatal("flaky handler was not retried")
+	}
+
+	select {
+	case msg := <-deadLetters:
+		if msg.Topic != "deadLetter/failing" {
+			t.Fatalf("unexpected dead letter topic %s", msg.Topic)
+		}
+		if msg.GetHeader(HeaderOriginalMessageID) != original.ID || msg.GetHeader(HeaderDeadLetterReason) == "" {
+			t.Fatalf("unexpected dead letter headers %v", msg.Headers)
+		}
+		if msg.GetHeader(HeaderAttempts) != "3" {
+			t.Fatalf("expected 3 attempts, got %s", msg.GetHeader(HeaderAttempts))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failing message was not routed to dead letter")
+	}
+	if calls := atomic.LoadInt32(&failingCalls); calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
@@ -0,0 +1,178 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yui100901/MyGo/concurrency"
+	"github.com/Yui100901/MyGo/log_utils"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/1 10 15
+//
+
+// 请求/响应消息头
+const (
+	HeaderReplyTo       = "x-reply-to"       // 响应应发往的主题
+	HeaderCorrelationID = "x-correlation-id" // 关联请求与响应
+	HeaderReplyError    = "x-reply-error"    // 响应方处理失败的错误信息
+)
+
+// RequestHandler 请求处理函数，返回值作为响应载荷发回请求方
+type RequestHandler func(ctx context.Context, msg *Message) ([]byte, error)
+
+// ReplyError 响应方返回的错误
+type ReplyError struct {
+	Message string
+}
+
+func (e *ReplyError) Error() string {
+	return "reply error: " + e.Message
+}
+
+// rpcInbox 代理内置的请求方收件箱，订阅 p2p/<requesterID> 接收响应
+type rpcInbox struct {
+	mu          sync.Mutex
+	created     bool // 收件箱订阅者是否已创建，创建失败时下一次请求会重试
+	requesterID string
+	topic       Topic
+	pending     *concurrency.SafeMap[string, chan *Message] // correlationID -> reply
+	seq         uint64
+}
+
+func newRPCInbox() *rpcInbox {
+	requesterID := "rpc_" + NewID()
+	return &rpcInbox{
+		requesterID: requesterID,
+		topic:       TopicP2PPrefix + Topic(requesterID),
+		pending:     concurrency.NewSafeMap[string, chan *Message](32),
+	}
+}
+
+// RequesterID 返回请求/响应收件箱使用的主体ID，
+// 收件箱以该ID订阅 p2p/<RequesterID>，Request发出的请求也以该ID作为SenderID，
+// 设置授权检查时需要允许该主体订阅自己的p2p主题并发布请求主题，
+// 响应方以Respond的订阅者ID作为SenderID发布到 p2p/<RequesterID>
+func (b *MessageBroker) RequesterID() string {
+	return b.inbox.requesterID
+}
+
+// Request 向topic发送请求并等待响应，直到收到响应或ctx结束
+func (b *MessageBroker) Request(ctx context.Context, topic Topic, payload []byte) (*Message, error) {
+	inbox, err := b.getInbox()
+	if err != nil {
+		return nil, err
+	}
+
+	correlationID := fmt.Sprintf("%s-%d", inbox.requesterID, atomic.AddUint64(&inbox.seq, 1))
+	reply := make(chan *Message, 1)
+	inbox.pending.Set(correlationID, reply)
+	defer inbox.pending.Delete(correlationID)
+
+	msg := NewMessage(topic, payload)
+	msg.SenderID = inbox.requesterID
+	msg.SetHeader(HeaderReplyTo, string(inbox.topic))
+	msg.SetHeader(HeaderCorrelationID, correlationID)
+	// 请求超时后消息即失去意义
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.SetTTL(time.Until(deadline))
+	}
+	if err := b.PublishContext(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-reply:
+		if errMsg := resp.GetHeader(HeaderReplyError); errMsg != "" {
+			return resp, &ReplyError{Message: errMsg}
+		}
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Respond 以订阅者身份注册请求处理函数，处理结果会发送到请求的响应主题
+func (b *MessageBroker) Respond(subscriberID string, handlers map[Topic]RequestHandler) error {
+	topicMap := make(map[Topic]MessageHandler, len(handlers))
+	for topic, handler := range handlers {
+		topicMap[topic] = b.responder(subscriberID, handler)
+	}
+	return b.Subscribe(subscriberID, topicMap)
+}
+
+// Reply 向请求消息的响应主题发送响应，优雅关闭期间同样接受，保证处理中的请求能收到响应
+func (b *MessageBroker) Reply(request *Message, senderID string, payload []byte, replyErr error) error {
+	return b.reply(context.Background(), request, senderID, payload, replyErr)
+}
+
+func (b *MessageBroker) reply(ctx context.Context, request *Message, senderID string, payload []byte, replyErr error) error {
+	replyTo := request.GetHeader(HeaderReplyTo)
+	if replyTo == "" {
+		return errors.New("request has no reply-to header")
+	}
+	resp := NewMessage(Topic(replyTo), payload)
+	resp.SenderID = senderID
+	resp.SetHeader(HeaderCorrelationID, request.GetHeader(HeaderCorrelationID))
+	if replyErr != nil {
+		resp.SetHeader(HeaderReplyError, replyErr.Error())
+	}
+	if err := b.authorize(senderID, ActionPublish, resp.Topic); err != nil {
+		return err
+	}
+	return b.publishTrusted(ctx, resp)
+}
+
+// responder 将请求处理函数包装为消息处理函数
+func (b *MessageBroker) responder(subscriberID string, handler RequestHandler) MessageHandler {
+	return func(ctx context.Context, msg *Message) error {
+		if msg.GetHeader(HeaderReplyTo) == "" {
+			// 非请求消息直接交给处理函数，不发送响应
+			_, err := handler(ctx, msg)
+			return err
+		}
+		payload, err := handler(ctx, msg)
+		// 请求已经处理，响应发送失败时重试会重复执行处理函数，只记录日志
+		if replyErr := b.reply(ctx, msg, subscriberID, payload, err); replyErr != nil {
+			b.logger.Error("Send reply failed", "subscriber", subscriberID, "request", msg.ID, "error", replyErr)
+		}
+		return nil
+	}
+}
+
+// getInbox 懒加载创建请求方收件箱，创建失败时不缓存错误，下一次请求会重新创建
+func (b *MessageBroker) getInbox() (*rpcInbox, error) {
+	inbox := b.inbox
+	inbox.mu.Lock()
+	defer inbox.mu.Unlock()
+	if inbox.created {
+		return inbox, nil
+	}
+
+	if err := b.RegisterSubscriber(NewSubscriber(inbox.requesterID, log_utils.WithHandler(b.logHandler))); err != nil {
+		return nil, err
+	}
+	err := b.Subscribe(inbox.requesterID, map[Topic]MessageHandler{
+		inbox.topic: func(ctx context.Context, msg *Message) error {
+			if reply, ok := inbox.pending.Get(msg.GetHeader(HeaderCorrelationID)); ok {
+				select {
+				case reply <- msg:
+				default:
+				}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		b.UnregisterSubscriber(inbox.requesterID)
+		return nil, err
+	}
+	inbox.created = true
+	return inbox, nil
+}
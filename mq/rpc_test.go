@@ -0,0 +1,156 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/1 11 30
+//
+
+func TestMQ_RequestReply(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	b.RegisterSubscriber(NewSubscriber("echo"))
+	err := b.Respond("echo", map[Topic]RequestHandler{
+		"service/echo": func(ctx context.Context, msg *Message) ([]byte, error) {
+			return append([]byte("echo: "), msg.Payload...), nil
+		},
+		"service/fail": func(ctx context.Context, msg *Message) ([]byte, error) {
+			return nil, errors.New("not supported")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := b.Request(ctx, "service/echo", []byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Payload) != "echo: ping" {
+		t.Fatalf("unexpected reply %s", resp.Payload)
+	}
+
+	_, err = b.Request(ctx, "service/fail", nil)
+	var replyErr *ReplyError
+	if !errors.As(err, &replyErr) || replyErr.Message != "not supported" {
+		t.Fatalf("expected reply error, got %v", err)
+	}
+
+	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer timeoutCancel()
+	if _, err := b.Request(timeoutCtx, "service/none", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestMQ_RequestInboxRetry(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	b.RegisterSubscriber(NewSubscriber("echo"))
+	b.Respond("echo", map[Topic]RequestHandler{
+		"service/echo": func(ctx context.Context, msg *Message) ([]byte, error) {
+			return msg.Payload, nil
+		},
+	})
+
+	// 首次创建收件箱时拒绝订阅，之后放行
+	var denied atomic.Bool
+	b.SetAuthorizer(AuthorizerFunc(func(principal string, action Action, topic Topic) error {
+		if principal == b.RequesterID() && action == ActionSubscribe && denied.CompareAndSwap(false, true) {
+			return ErrUnauthorized
+		}
+		return nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := b.Request(ctx, "service/echo", []byte("ping")); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected first request to fail, got %v", err)
+	}
+	resp, err := b.Request(ctx, "service/echo", []byte("ping"))
+	if err != nil {
+		t.Fatalf("expected inbox setup to be retried, got %v", err)
+	}
+	if string(resp.Payload) != "ping" {
+		t.Fatalf("unexpected reply %s", resp.Payload)
+	}
+}
+
+func TestMQ_RequestContext(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	// 请求的上下文应传递给发布拦截器
+	traces := make(chan any, 1)
+	b.Use(func(ctx context.Context, msg *Message, next PublishFunc) error {
+		if msg.Topic == "service/trace" {
+			traces <- ctx.Value(traceKey{})
+		}
+		return next(ctx, msg)
+	})
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), traceKey{}, "trace-1"), 100*time.Millisecond)
+	defer cancel()
+	if _, err := b.Request(ctx, "service/trace", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if trace := <-traces; trace != "trace-1" {
+		t.Fatalf("expected request context in interceptor, got %v", trace)
+	}
+}
+
+func TestMQ_RequestDuringDrain(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+
+	// 优雅关闭开始后处理完成的请求仍需收到响应，且不会被重试
+	started := make(chan struct{}, 1)
+	var handled int32
+	b.RegisterSubscriber(NewSubscriber("slow"))
+	b.Respond("slow", map[Topic]RequestHandler{
+		"service/slow": func(ctx context.Context, msg *Message) ([]byte, error) {
+			atomic.AddInt32(&handled, 1)
+			started <- struct{}{}
+			time.Sleep(100 * time.Millisecond)
+			return []byte("done"), nil
+		},
+	})
+
+	result := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		resp, err := b.Request(ctx, "service/slow", nil)
+		if err == nil && string(resp.Payload) != "done" {
+			err = errors.New("unexpected reply " + string(resp.Payload))
+		}
+		result <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := b.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("expected reply during drain, got %v", err)
+	}
+	if got := atomic.LoadInt32(&handled); got != 1 {
+		t.Fatalf("expected request handled once, got %d", got)
+	}
+}
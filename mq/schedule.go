@@ -0,0 +1,309 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/9 14 20
+//
+
+// 周期性发布计划的消息头
+const (
+	HeaderScheduleID       = "x-schedule-id"  // 触发该消息的计划ID
+	HeaderScheduleSequence = "x-schedule-seq" // 计划的第几次触发，从1开始
+)
+
+// Schedule 周期性发布计划，Interval和Cron二选一
+// 每次触发都会以计划中的主题、载荷和消息头发布一条新的消息
+type Schedule struct {
+	ID        string            `json:"id"`                  // 计划ID
+	SenderID  string            `json:"sender_id,omitempty"` // 发布主体，添加计划时按该主体检查发布权限，并作为每条消息的SenderID
+	Topic     Topic             `json:"topic"`               // 发布主题
+	Payload   []byte            `json:"payload,omitempty"`   // 消息载荷
+	Headers   map[string]string `json:"headers,omitempty"`   // 消息头
+	Key       string            `json:"key,omitempty"`       // 排序键
+	TTL       time.Duration     `json:"ttl,omitempty"`       // 消息存活时间，为0时使用默认值
+	Interval  time.Duration     `json:"interval,omitempty"`  // 固定间隔
+	Cron      string            `json:"cron,omitempty"`      // cron表达式
+	Sequence  uint64            `json:"sequence"`            // 已触发次数
+	NextRun   time.Time         `json:"next_run"`            // 下次触发时间
+	CreatedAt time.Time         `json:"created_at"`          // 创建时间
+}
+
+// scheduleEntry 运行中的计划
+type scheduleEntry struct {
+	mu        sync.Mutex
+	schedule  Schedule
+	cron      *CronExpr
+	timer     *WheelTimer
+	cancelled bool
+}
+
+// next 计算晚于from的下次触发时间；错过的触发不会补发，固定间隔计划保持原有相位
+func (e *scheduleEntry) next(from time.Time) time.Time {
+	if e.cron != nil {
+		return e.cron.Next(from)
+	}
+	next := e.schedule.NextRun
+	if next.IsZero() {
+		return from.Add(e.schedule.Interval)
+	}
+	if !next.After(from) {
+		missed := from.Sub(next)/e.schedule.Interval + 1
+		next = next.Add(missed * e.schedule.Interval)
+	}
+	return next
+}
+
+// ScheduleInterval 按固定间隔周期性发布消息，返回计划ID，发布主体为空，需要指定主体时使用AddSchedule
+func (b *MessageBroker) ScheduleInterval(topic Topic, payload []byte, interval time.Duration) (string, error) {
+	return b.AddSchedule(Schedule{Topic: topic, Payload: payload, Interval: interval})
+}
+
+// ScheduleCron 按cron表达式周期性发布消息，返回计划ID，发布主体为空，需要指定主体时使用AddSchedule
+func (b *MessageBroker) ScheduleCron(topic Topic, payload []byte, expr string) (string, error) {
+	return b.AddSchedule(Schedule{Topic: topic, Payload: payload, Cron: expr})
+}
+
+// AddSchedule 添加周期性发布计划，返回计划ID
+// 设置了授权检查时以计划的SenderID为主体检查发布权限，之后的每次触发不再检查
+func (b *MessageBroker) AddSchedule(schedule Schedule) (string, error) {
+	if err := schedule.Topic.Validate(); err != nil {
+		return "", err
+	}
+	if schedule.Topic.IsWildcard() {
+		return "", fmt.Errorf("can not schedule to wildcard topic %s", schedule.Topic)
+	}
+	if err := b.authorize(schedule.SenderID, ActionPublish, schedule.Topic); err != nil {
+		return "", err
+	}
+	if schedule.ID == "" {
+		schedule.ID = "sched_" + NewID()
+	}
+	if _, exists := b.schedules.Get(schedule.ID); exists {
+		return "", fmt.Errorf("schedule %s already exists", schedule.ID)
+	}
+	if schedule.CreatedAt.IsZero() {
+		schedule.CreatedAt = time.Now()
+	}
+
+	entry, err := newScheduleEntry(schedule)
+	if err != nil {
+		return "", err
+	}
+	nextRun := entry.schedule.NextRun
+	b.schedules.Set(schedule.ID, entry)
+	if b.IsRunning() {
+		b.armSchedule(entry)
+	}
+	b.saveSchedules()
+
+	b.logger.Info("Schedule added",
+		"schedule", schedule.ID, "topic", schedule.Topic, "next_run", nextRun.Format(time.RFC3339))
+	return schedule.ID, nil
+}
+
+func newScheduleEntry(schedule Schedule) (*scheduleEntry, error) {
+	entry := &scheduleEntry{schedule: schedule}
+	switch {
+	case schedule.Cron != "" && schedule.Interval > 0:
+		return nil, errors.New("schedule can not have both interval and cron")
+	case schedule.Cron != "":
+		expr, err := ParseCron(schedule.Cron)
+		if err != nil {
+			return nil, err
+		}
+		entry.cron = expr
+	case schedule.Interval <= 0:
+		return nil, errors.New("schedule requires a positive interval or a cron expression")
+	}
+
+	now := time.Now()
+	if entry.schedule.NextRun.IsZero() || entry.schedule.NextRun.Before(now) {
+		entry.schedule.NextRun = entry.next(now)
+	}
+	return entry, nil
+}
+
+// CancelSchedule 取消周期性发布计划
+func (b *MessageBroker) CancelSchedule(scheduleID string) bool {
+	entry, ok := b.schedules.Pop(scheduleID)
+	if !ok {
+		b.logger.Warn("No schedule found", "schedule", scheduleID)
+		return false
+	}
+	entry.mu.Lock()
+	entry.cancelled = true
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+	entry.mu.Unlock()
+	b.saveSchedules()
+
+	b.logger.Info("Cancelled schedule", "schedule", scheduleID)
+	return true
+}
+
+// ListSchedules 列出所有计划，按下次触发时间排序
+func (b *MessageBroker) ListSchedules() []Schedule {
+	schedules := make([]Schedule, 0, b.schedules.Length())
+	b.schedules.ForEach(func(id string, entry *scheduleEntry) bool {
+		entry.mu.Lock()
+		schedules = append(schedules, entry.schedule)
+		entry.mu.Unlock()
+		return true
+	})
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].NextRun.Before(schedules[j].NextRun)
+	})
+	return schedules
+}
+
+// armSchedule 设置计划的下次触发定时器
+func (b *MessageBroker) armSchedule(entry *scheduleEntry) {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.cancelled || !b.IsRunning() {
+		return
+	}
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+	entry.timer = b.timingWheel.AfterFunc(time.Until(entry.schedule.NextRun), func() {
+		b.fireSchedule(entry)
+	})
+}
+
+// fireSchedule 触发计划：发布一条新消息并安排下次触发
+func (b *MessageBroker) fireSchedule(entry *scheduleEntry) {
+	entry.mu.Lock()
+	if entry.cancelled || !b.IsRunning() {
+		entry.mu.Unlock()
+		return
+	}
+	entry.schedule.Sequence++
+	schedule := entry.schedule
+	entry.schedule.NextRun = entry.next(time.Now())
+	finished := entry.schedule.NextRun.IsZero()
+	entry.mu.Unlock()
+
+	msg := NewMessage(schedule.Topic, append([]byte(nil), schedule.Payload...))
+	msg.SenderID = schedule.SenderID
+	for k, v := range schedule.Headers {
+		msg.SetHeader(k, v)
+	}
+	msg.SetHeader(HeaderScheduleID, schedule.ID)
+	msg.SetHeader(HeaderScheduleSequence, strconv.FormatUint(schedule.Sequence, 10))
+	msg.Key = schedule.Key
+	if schedule.TTL > 0 {
+		msg.SetTTL(schedule.TTL)
+	}
+	if err := b.publishTrusted(context.Background(), msg); err != nil {
+		b.logger.Error("Publish scheduled message failed", "schedule", schedule.ID, "error", err)
+	}
+
+	if finished {
+		// cron表达式不再有触发时间
+		b.logger.Info("Schedule has no more runs, removed", "schedule", schedule.ID)
+		b.CancelSchedule(schedule.ID)
+		return
+	}
+	b.armSchedule(entry)
+	b.saveSchedules()
+}
+
+// startSchedules 启动时加载计划文件并设置所有计划的定时器
+func (b *MessageBroker) startSchedules() {
+	if err := b.loadSchedules(); err != nil {
+		b.logger.Error("Load schedules failed", "error", err)
+	}
+	b.schedules.ForEach(func(id string, entry *scheduleEntry) bool {
+		b.armSchedule(entry)
+		return true
+	})
+}
+
+// stopSchedules 停止所有计划的定时器并保存计划
+func (b *MessageBroker) stopSchedules() {
+	b.schedules.ForEach(func(id string, entry *scheduleEntry) bool {
+		entry.mu.Lock()
+		if entry.timer != nil {
+			entry.timer.Stop()
+			entry.timer = nil
+		}
+		entry.mu.Unlock()
+		return true
+	})
+	b.saveSchedules()
+}
+
+// loadSchedules 从计划文件恢复计划，错过的触发不会补发
+func (b *MessageBroker) loadSchedules() error {
+	if b.config.ScheduleFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(b.config.ScheduleFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var schedules []Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return fmt.Errorf("decode schedule file failed: %w", err)
+	}
+	for _, schedule := range schedules {
+		if _, exists := b.schedules.Get(schedule.ID); exists {
+			continue
+		}
+		entry, err := newScheduleEntry(schedule)
+		if err != nil {
+			b.logger.Warn("Skip invalid schedule", "schedule", schedule.ID, "error", err)
+			continue
+		}
+		b.schedules.Set(schedule.ID, entry)
+	}
+	b.logger.Info("Loaded schedules", "count", len(schedules), "file", b.config.ScheduleFile)
+	return nil
+}
+
+// saveSchedules 将所有计划写入计划文件，先写临时文件再重命名保证原子性
+func (b *MessageBroker) saveSchedules() {
+	if b.config.ScheduleFile == "" {
+		return
+	}
+	b.scheduleFileMu.Lock()
+	defer b.scheduleFileMu.Unlock()
+
+	data, err := json.MarshalIndent(b.ListSchedules(), "", "  ")
+	if err != nil {
+		b.logger.Error("Encode schedules failed", "error", err)
+		return
+	}
+	if dir := filepath.Dir(b.config.ScheduleFile); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			b.logger.Error("Create schedule dir failed", "error", err)
+			return
+		}
+	}
+	tmp := b.config.ScheduleFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		b.logger.Error("Write schedule file failed", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, b.config.ScheduleFile); err != nil {
+		b.logger.Error("Replace schedule file failed", "error", err)
+	}
+}
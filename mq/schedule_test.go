@@ -0,0 +1,170 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/9 17 00
+//
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2025, 9, 9, 10, 7, 30, 0, time.UTC) // 周二
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2025, 9, 9, 10, 15, 0, 0, time.UTC)},
+		{"0 9-17 * * 1-5", time.Date(2025, 9, 9, 11, 0, 0, 0, time.UTC)},
+		{"30 8 * * 0", time.Date(2025, 9, 14, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2025, 9, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 9, 10, 0, 0, 0, 0, time.UTC)},
+		// 日和周同时受限时满足其一即可：9月13日（周六）早于下一个周一
+		{"0 0 13 * 1", time.Date(2025, 9, 13, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		expr, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.expr, err)
+		}
+		if got := expr.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%q: expected %s, got %s", tt.expr, tt.want, got)
+		}
+	}
+
+	for _, bad := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := ParseCron(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestMQ_ScheduleInterval(t *testing.T) {
+	config := DefaultBrokerConfig()
+	config.ScheduleFile = filepath.Join(t.TempDir(), "schedules.json")
+
+	received := make(chan *Message, 16)
+	start := func() *MessageBroker {
+		b := NewMessageBroker(config)
+		b.Start()
+		b.RegisterSubscriber(NewSubscriber("ticker"))
+		b.Subscribe("ticker", map[Topic]MessageHandler{
+			"heartbeat": func(ctx context.Context, msg *Message) error {
+				received <- msg
+				return nil
+			},
+		})
+		return b
+	}
+	next := func() *Message {
+		t.Helper()
+		select {
+		case msg := <-received:
+			return msg
+		case <-time.After(time.Second):
+			t.Fatal("scheduled message not received")
+			return nil
+		}
+	}
+
+	b := start()
+	id, err := b.ScheduleInterval("heartbeat", []byte("ping"), 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ScheduleInterval("heartbeat/#", nil, time.Second); err == nil {
+		t.Fatal("expected error for wildcard topic")
+	}
+
+	for seq := 1; seq <= 2; seq++ {
+		msg := next()
+		if msg.GetHeader(HeaderScheduleID) != id || msg.GetHeader(HeaderScheduleSequence) != strconv.Itoa(seq) {
+			t.Fatalf("unexpected schedule headers %v", msg.Headers)
+		}
+	}
+	b.Stop()
+
+	// 重启后从计划文件恢复，序号继续递增
+	for len(received) > 0 {
+		<-received
+	}
+	b = start()
+	schedules := b.ListSchedules()
+	if len(schedules) != 1 || schedules[0].ID != id || schedules[0].Sequence < 2 {
+		t.Fatalf("unexpected schedules after restart %+v", schedules)
+	}
+	if seq, _ := strconv.Atoi(next().GetHeader(HeaderScheduleSequence)); seq <= 2 {
+		t.Fatalf("sequence should continue after restart, got %d", seq)
+	}
+
+	if !b.CancelSchedule(id) || b.CancelSchedule(id) {
+		t.Fatal("schedule should be cancelled exactly once")
+	}
+	time.Sleep(50 * time.Millisecond)
+	for len(received) > 0 {
+		<-received
+	}
+	select {
+	case <-received:
+		t.Fatal("cancelled schedule fired")
+	case <-time.After(60 * time.Millisecond):
+	}
+	b.Stop()
+
+	b = NewMessageBroker(config)
+	b.Start()
+	defer b.Stop()
+	if len(b.ListSchedules()) != 0 {
+		t.Fatal("cancelled schedule should not be restored")
+	}
+}
+
+func TestMQ_ScheduleAuthorization(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+	b.SetAuthorizer(NewRuleAuthorizer(Deny,
+		AccessRule{Effect: Allow, Principals: []string{"ticker"}, Actions: []Action{ActionPublish}, Topics: []Topic{"ticks/#"}},
+		AccessRule{Effect: Allow, Principals: []string{"c1"}, Actions: []Action{ActionSubscribe}, Topics: []Topic{"ticks/#"}},
+	))
+
+	senders := make(chan string, 10)
+	b.RegisterSubscriber(NewSubscriber("c1"))
+	if err := b.Subscribe("c1", map[Topic]MessageHandler{
+		"ticks/#": func(ctx context.Context, msg *Message) error {
+			senders <- msg.SenderID
+			return nil
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.AddSchedule(Schedule{SenderID: "intruder", Topic: "ticks/a", Interval: 20 * time.Millisecond}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected schedule to be denied, got %v", err)
+	}
+	if _, err := b.ScheduleInterval("ticks/a", nil, 20*time.Millisecond); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected anonymous schedule to be denied, got %v", err)
+	}
+	if schedules := b.ListSchedules(); len(schedules) != 0 {
+		t.Fatalf("expected no schedules added, got %d", len(schedules))
+	}
+
+	if _, err := b.AddSchedule(Schedule{SenderID: "ticker", Topic: "ticks/a", Interval: 20 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case sender := <-senders:
+		if sender != "ticker" {
+			t.Fatalf("unexpected sender %q", sender)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("scheduled message not received")
+	}
+}
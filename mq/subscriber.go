@@ -3,10 +3,12 @@ package mq
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/Yui100901/MyGo/concurrency"
-	"log"
-	"os"
-	"strings"
+	"github.com/Yui100901/MyGo/log_utils"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,27 +24,77 @@ type MessageHandler func(ctx context.Context, msg *Message) error
 type TopicSubscription struct {
 	Topic        Topic          // 主题名称
 	Handler      MessageHandler // 该主题的消息处理函数
+	Group        string         // 所属消费者组，为空表示普通广播订阅
 	SubscribedAt time.Time      // 订阅时间
 }
 
+// deadLetterFunc 死信投递函数
+type deadLetterFunc func(msg *Message, subscriberID string, reason error)
+
 // Subscriber 消息订阅者
 type Subscriber struct {
 	id            string                                          // 客户端ID
 	subscriptions *concurrency.SafeMap[Topic, *TopicSubscription] // 主题订阅映射: topic -> subscription
+	retryPolicy   *RetryPolicy                                    // 重试策略，为nil时使用代理的默认策略
+	config        *SubscriberConfig                               // 收件箱配置
+	inbox         chan *delivery                                  // 有界收件箱，无排序键的消息由任意工作协程处理
+	lanes         []chan *delivery                                // 每个工作协程专属的有序队列，按排序键哈希选择
+	inFlight      int32                                           // 已接收但未处理完成的消息数量（原子操作）
+	dropped       int64                                           // 因收件箱溢出被丢弃的消息数量（原子操作）
+
+	ctx        context.Context // 所属代理的上下文，代理停止后不再重试
+	deadLetter deadLetterFunc  // 重试耗尽后的死信投递
+	metrics    *brokerMetrics  // 所属代理的运行指标，未注册时为nil
+
+	interceptors   []HandleInterceptor // 处理拦截器链
+	interceptorsMu sync.RWMutex
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	done      chan struct{} // 关闭后工作协程退出
 
-	logger *log.Logger
+	logger *slog.Logger
 }
 
-// NewSubscriber 创建基于函数的客户端
-func NewSubscriber(id string) *Subscriber {
+// NewSubscriber 创建基于函数的客户端，opts配置日志输出
+func NewSubscriber(id string, opts ...log_utils.Option) *Subscriber {
+	return NewSubscriberWithConfig(id, nil, opts...)
+}
+
+// NewSubscriberWithConfig 使用指定的收件箱配置创建订阅者
+func NewSubscriberWithConfig(id string, config *SubscriberConfig, opts ...log_utils.Option) *Subscriber {
+	if config == nil {
+		config = DefaultSubscriberConfig()
+	}
+	if config.InboxSize <= 0 {
+		config.InboxSize = 1
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+
+	// 有序队列平分收件箱容量
+	laneSize := config.InboxSize / config.Workers
+	if laneSize <= 0 {
+		laneSize = 1
+	}
+	lanes := make([]chan *delivery, config.Workers)
+	for i := range lanes {
+		lanes[i] = make(chan *delivery, laneSize)
+	}
 
 	subscriber := &Subscriber{
 		id:            id,
 		subscriptions: concurrency.NewSafeMap[Topic, *TopicSubscription](32),
-		logger:        log.New(os.Stdout, "[MQ-Subscriber] ", log.LstdFlags|log.Lshortfile),
+		config:        config,
+		inbox:         make(chan *delivery, config.InboxSize),
+		lanes:         lanes,
+		ctx:           context.Background(),
+		done:          make(chan struct{}),
+		logger:        log_utils.NewLogger("mq-subscriber", opts...).With("subscriber", id),
 	}
 
-	log.Printf("Subscriber %s", subscriber.id)
+	subscriber.logger.Debug("Subscriber created")
 	return subscriber
 }
 
@@ -50,44 +102,168 @@ func (s *Subscriber) ID() string {
 	return s.id
 }
 
+// InFlight 返回已接收但未处理完成的消息数量
+func (s *Subscriber) InFlight() int {
+	return int(atomic.LoadInt32(&s.inFlight))
+}
+
+// InboxDepth 返回收件箱中等待处理的消息数量
+func (s *Subscriber) InboxDepth() int {
+	depth := len(s.inbox)
+	for _, lane := range s.lanes {
+		depth += len(lane)
+	}
+	return depth
+}
+
+// Dropped 返回因收件箱溢出被丢弃的消息数量
+func (s *Subscriber) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Use 注册处理拦截器，作用于该订阅者的所有处理函数
+func (s *Subscriber) Use(interceptors ...HandleInterceptor) {
+	s.interceptorsMu.Lock()
+	defer s.interceptorsMu.Unlock()
+	s.interceptors = append(s.interceptors, interceptors...)
+}
+
+// SetRetryPolicy 设置该订阅者的重试策略
+func (s *Subscriber) SetRetryPolicy(policy *RetryPolicy) {
+	s.retryPolicy = policy
+}
+
+// attach 注册到代理时绑定代理的上下文、默认重试策略、死信投递和运行指标
+func (s *Subscriber) attach(ctx context.Context, policy *RetryPolicy, deadLetter deadLetterFunc, metrics *brokerMetrics) {
+	s.ctx = ctx
+	if s.retryPolicy == nil {
+		s.retryPolicy = policy
+	}
+	s.deadLetter = deadLetter
+	s.metrics = metrics
+}
+
+// HandleMessage 处理消息，消息会分发给所有与其主题匹配的订阅（含通配符订阅）
 func (s *Subscriber) HandleMessage(message *Message) {
-	sub, exists := s.subscriptions.Get(message.Topic)
-	if !exists {
+	patterns := make([]Topic, 0)
+	s.subscriptions.ForEach(func(pattern Topic, sub *TopicSubscription) bool {
+		if pattern.Matches(message.Topic) {
+			patterns = append(patterns, pattern)
+		}
+		return true
+	})
+	s.deliver(message, patterns)
+}
+
+// deliver 将消息放入收件箱，每个命中的处理函数获得独立的消息副本
+func (s *Subscriber) deliver(message *Message, patterns []Topic) {
+	s.startWorkers()
+	for _, pattern := range patterns {
+		sub, exists := s.subscriptions.Get(pattern)
+		if !exists || sub.Handler == nil {
+			continue
+		}
+		msgCopy := message.Clone()
+		if msgCopy.tracker != nil {
+			msgCopy.tracker.add()
+		}
+		atomic.AddInt32(&s.inFlight, 1)
+		s.push(&delivery{message: msgCopy, handler: sub.Handler}, s.config.OverflowPolicy)
+	}
+}
+
+// process 处理一次投递，失败或panic时按重试策略延迟重新入队，重试耗尽或不可重试时转入死信
+func (s *Subscriber) process(d *delivery) {
+	policy := s.retryPolicy
+	if policy == nil {
+		policy = DefaultRetryPolicy()
+	}
+
+	message := d.message
+	message.Attempts++
+	start := time.Now()
+	err := s.invoke(d.handler, message)
+	s.metrics.observeHandler(s.id, time.Since(start), err)
+	if err == nil {
+		s.finish(d)
 		return
 	}
-	if sub.Handler != nil {
-		go s.processMessage(message, sub.Handler)
+	s.logger.Warn("Handler failed",
+		"message", message.ID, "topic", message.Topic, "error", err, "attempt", message.Attempts, "max_attempts", policy.MaxAttempts)
+
+	if message.Attempts >= policy.MaxAttempts || IsPermanent(err) {
+		if s.deadLetter != nil {
+			s.deadLetter(message, s.id, err)
+		}
+		s.finish(d)
+		return
 	}
+
+	backoff := policy.Backoff(message.Attempts)
+	if message.OrderingKey() != "" {
+		// 有序消息原地等待重试，同一键的后续消息不会越过它
+		timer := time.NewTimer(backoff)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			s.process(d)
+		case <-s.done:
+		case <-s.ctx.Done():
+		}
+		return
+	}
+
+	// 等待期间不占用工作协程；重试总是阻塞入队，避免被溢出策略丢弃
+	// 订阅者停止后消息保持未确认状态，等待重放
+	time.AfterFunc(backoff, func() {
+		s.push(d, OverflowBlock)
+	})
 }
 
-func (s *Subscriber) processMessage(message *Message, handler MessageHandler) {
+// invoke 经过处理拦截器链调用处理函数，并将panic转换为错误
+func (s *Subscriber) invoke(handler MessageHandler, message *Message) (err error) {
 	defer func() {
-		if err := recover(); err != nil {
-			s.logger.Printf("message id :%s topic:%s,handler got err:%s", message.ID, message.Topic, err)
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
 		}
 	}()
-	err := handler(context.Background(), message)
-	if err != nil {
-		s.logger.Printf("message id :%s topic:%s,handler got err:%s", message.ID, message.Topic, err)
-		return
+
+	s.interceptorsMu.RLock()
+	interceptors := s.interceptors
+	s.interceptorsMu.RUnlock()
+	if len(interceptors) > 0 {
+		handler = chainHandle(interceptors, handler)
 	}
+	return handler(s.ctx, message)
 }
 
 func (s *Subscriber) Subscribe(topicMap map[Topic]MessageHandler) error {
+	return s.SubscribeGroup("", topicMap)
+}
+
+// SubscribeGroup 以消费者组成员身份订阅，group为空时等同于普通订阅
+func (s *Subscriber) SubscribeGroup(group string, topicMap map[Topic]MessageHandler) error {
 	if len(topicMap) == 0 {
 		return nil
 	}
 
-	for topic, handler := range topicMap {
-		err := s.TopicValidate(topic)
-		if err != nil {
+	// 先校验全部主题，避免部分主题订阅成功
+	for topic := range topicMap {
+		if err := s.TopicValidate(topic); err != nil {
 			return err
 		}
+		// 订阅按主题记录，同一主题不能同时作为普通订阅和组订阅，也不能属于多个组
+		if existing, ok := s.subscriptions.Get(topic); ok && existing.Group != group {
+			return fmt.Errorf("topic %s already subscribed with group %q", topic, existing.Group)
+		}
+	}
 
+	for topic, handler := range topicMap {
 		// 创建订阅
 		subscription := &TopicSubscription{
 			Topic:        topic,
 			Handler:      handler,
+			Group:        group,
 			SubscribedAt: time.Now(),
 		}
 
@@ -101,14 +277,20 @@ func (s *Subscriber) Unsubscribe(topics []Topic) {
 	for _, topic := range topics {
 		s.subscriptions.Delete(topic)
 	}
-	s.logger.Printf("Unscribe from %d topics", len(topics))
+	s.logger.Info("Unsubscribed", "topics", len(topics))
 }
 
 func (s *Subscriber) TopicValidate(topic Topic) error {
-	topicParts := strings.Split(string(topic), "/")
+	if err := topic.Validate(); err != nil {
+		return err
+	}
+	topicParts := topic.Levels()
 	//订阅时topic规则
 	//点对点消息只能订阅自己的
 	if topic.IsP2P() {
+		if topic.IsWildcard() {
+			return errors.New("p2p topic can not contain wildcards")
+		}
 		if topicParts[1] != s.id {
 			return errors.New("p2p topic id does not match")
 		}
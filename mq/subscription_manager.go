@@ -1,6 +1,8 @@
 package mq
 
 import (
+	"maps"
+
 	"github.com/Yui100901/MyGo/concurrency"
 )
 
@@ -13,6 +15,7 @@ import (
 type SubscriptionManager struct {
 	topicSubscribers *concurrency.SafeMap[Topic, map[string]struct{}] // topic -> subscribers
 	subscriberTopics *concurrency.SafeMap[string, map[Topic]struct{}] // subscriber -> topics
+	trie             *topicTrie                                       // 订阅模式前缀树，用于通配符匹配
 }
 
 // NewSubscriptionManager 创建订阅管理器
@@ -20,53 +23,56 @@ func NewSubscriptionManager() *SubscriptionManager {
 	return &SubscriptionManager{
 		topicSubscribers: concurrency.NewSafeMap[Topic, map[string]struct{}](32),
 		subscriberTopics: concurrency.NewSafeMap[string, map[Topic]struct{}](32),
+		trie:             newTopicTrie(),
 	}
 }
 
 // AddSubscription 添加订阅
 func (r *SubscriptionManager) AddSubscription(subscriberID string, topic Topic) {
+	r.AddGroupSubscription(subscriberID, "", topic)
+}
+
+// AddGroupSubscription 以消费者组成员身份添加订阅，group为空时等同于普通订阅
+func (r *SubscriptionManager) AddGroupSubscription(subscriberID string, group string, topic Topic) {
+	// 集合按写时复制更新，读取方拿到的集合不会被并发修改
 	r.topicSubscribers.Update(topic, func(old map[string]struct{}) (map[string]struct{}, bool) {
-		if old == nil {
-			old = make(map[string]struct{})
-		}
-		old[subscriberID] = struct{}{}
-		return old, true
+		updated := make(map[string]struct{}, len(old)+1)
+		maps.Copy(updated, old)
+		updated[subscriberID] = struct{}{}
+		return updated, true
 	})
 
 	r.subscriberTopics.Update(subscriberID, func(old map[Topic]struct{}) (map[Topic]struct{}, bool) {
-		if old == nil {
-			old = make(map[Topic]struct{})
-		}
-		old[topic] = struct{}{}
-		return old, true
+		updated := make(map[Topic]struct{}, len(old)+1)
+		maps.Copy(updated, old)
+		updated[topic] = struct{}{}
+		return updated, true
 	})
 
+	r.trie.Add(topic, subscriberID, group)
 }
 
 // RemoveSubscription 移除订阅
 func (r *SubscriptionManager) RemoveSubscription(subscriberID string, topic Topic) {
 	r.topicSubscribers.Update(topic, func(old map[string]struct{}) (map[string]struct{}, bool) {
-		if old == nil {
-			return nil, false
-		}
-		delete(old, subscriberID)
-		if len(old) == 0 {
+		updated := maps.Clone(old)
+		delete(updated, subscriberID)
+		if len(updated) == 0 {
 			return nil, false
 		}
-		return old, true
+		return updated, true
 	})
 
 	r.subscriberTopics.Update(subscriberID, func(old map[Topic]struct{}) (map[Topic]struct{}, bool) {
-		if old == nil {
+		updated := maps.Clone(old)
+		delete(updated, topic)
+		if len(updated) == 0 {
 			return nil, false
 		}
-		delete(old, topic)
-		if len(old) == 0 {
-			return nil, false
-		}
-		return old, true
+		return updated, true
 	})
 
+	r.trie.Remove(topic, subscriberID)
 }
 
 // GetSubscribersCount 获取主题订阅者数量
@@ -79,20 +85,30 @@ func (r *SubscriptionManager) GetSubscribersCount(topic Topic) int {
 	return len(subscribers)
 }
 
-// GetTopicSubscribers 获取主题订阅者
+// GetTopicSubscribers 获取主题订阅者，包含通配符订阅命中的订阅者
 func (r *SubscriptionManager) GetTopicSubscribers(topic Topic) []string {
-	subscribers, exists := r.topicSubscribers.Get(topic)
-	if !exists {
+	matches := r.trie.Match(topic)
+	if len(matches) == 0 {
 		return nil
 	}
 
-	result := make([]string, 0, len(subscribers))
-	for subscriberID := range subscribers {
-		result = append(result, subscriberID)
+	seen := make(map[string]struct{}, len(matches))
+	result := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if _, ok := seen[match.SubscriberID]; ok {
+			continue
+		}
+		seen[match.SubscriberID] = struct{}{}
+		result = append(result, match.SubscriberID)
 	}
 	return result
 }
 
+// MatchSubscriptions 获取与主题匹配的所有订阅（订阅者+订阅模式）
+func (r *SubscriptionManager) MatchSubscriptions(topic Topic) []TopicMatch {
+	return r.trie.Match(topic)
+}
+
 // GetSubscriberTopicsCount 获取客户端订阅的主题的数量
 func (r *SubscriptionManager) GetSubscriberTopicsCount(subscriberID string) int {
 	topics, exists := r.subscriberTopics.Get(subscriberID)
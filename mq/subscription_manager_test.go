@@ -0,0 +1,146 @@
+package mq
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/25 11 02
+//
+
+func TestTopic_Matches(t *testing.T) {
+	cases := []struct {
+		pattern Topic
+		topic   Topic
+		want    bool
+	}{
+		{"device/1/status", "device/1/status", true},
+		{"device/+/status", "device/1/status", true},
+		{"device/+/status", "device/1/2/status", false},
+		{"device/#", "device/1/2/status", true},
+		{"device/#", "device", true},
+		{"#", "device/1", true},
+		{"+", "device/1", false},
+		{"#", "p2p/c1", false},
+		{"+/c1", "p2p/c1", false},
+	}
+	for _, c := range cases {
+		if got := c.pattern.Matches(c.topic); got != c.want {
+			t.Errorf("%s matches %s: expected %v, got %v", c.pattern, c.topic, c.want, got)
+		}
+	}
+}
+
+func TestTopic_Validate(t *testing.T) {
+	valid := []Topic{"a/b", "a/+/c", "a/#", "#", "+"}
+	invalid := []Topic{"", "a/#/c", "a/b#", "a/b+/c"}
+	for _, topic := range valid {
+		if err := topic.Validate(); err != nil {
+			t.Errorf("%s should be valid: %v", topic, err)
+		}
+	}
+	for _, topic := range invalid {
+		if err := topic.Validate(); err == nil {
+			t.Errorf("%s should be invalid", topic)
+		}
+	}
+}
+
+func TestSubscriptionManager_Wildcard(t *testing.T) {
+	m := NewSubscriptionManager()
+	m.AddSubscription("c1", "device/+/status")
+	m.AddSubscription("c2", "device/#")
+	m.AddSubscription("c3", "device/1/status")
+	m.AddSubscription("c4", "device/2/status")
+
+	got := m.GetTopicSubscribers("device/1/status")
+	sort.Strings(got)
+	want := []string{"c1", "c2", "c3"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+
+	m.RemoveSubscription("c2", "device/#")
+	if got := m.GetTopicSubscribers("device/9/alarm"); len(got) != 0 {
+		t.Fatalf("expected no subscribers, got %v", got)
+	}
+	m.RemoveSubscriber("c1")
+	if got := m.GetTopicSubscribers("device/3/status"); len(got) != 0 {
+		t.Fatalf("expected no subscribers, got %v", got)
+	}
+}
+
+func TestMQ_WildcardSubscribe(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	received := make(chan *Message, 4)
+	c1 := NewSubscriber("c1")
+	b.RegisterSubscriber(c1)
+	err := b.Subscribe(c1.ID(), map[Topic]MessageHandler{
+		"device/+/status": func(ctx context.Context, msg *Message) error {
+			received <- msg
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Publish(NewMessage("device/1/status", []byte("online")))
+	b.Publish(NewMessage("device/1/alarm", []byte("fire")))
+
+	select {
+	case msg := <-received:
+		if msg.Topic != "device/1/status" {
+			t.Fatalf("unexpected topic %s", msg.Topic)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wildcard subscription did not receive message")
+	}
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected message on %s", msg.Topic)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := b.Publish(NewMessage("device/+/status", nil)); err == nil {
+		t.Fatal("publishing to a wildcard topic should fail")
+	}
+}
+
+func TestMQ_SubscriberIDValidate(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	for _, id := range []string{"", "+", "#", "a/b"} {
+		if err := b.RegisterSubscriber(NewSubscriber(id)); err == nil {
+			t.Errorf("subscriber id %q should be rejected", id)
+		}
+	}
+
+	c1 := NewSubscriber("c1")
+	if err := b.RegisterSubscriber(c1); err != nil {
+		t.Fatal(err)
+	}
+	handler := func(ctx context.Context, msg *Message) error { return nil }
+	for _, topic := range []Topic{"p2p/+", "p2p/#", "p2p/c1/#", "p2p/other"} {
+		if err := b.Subscribe(c1.ID(), map[Topic]MessageHandler{topic: handler}); err == nil {
+			t.Errorf("p2p subscription %s should be rejected", topic)
+		}
+	}
+	if err := b.Subscribe(c1.ID(), map[Topic]MessageHandler{"p2p/c1": handler}); err != nil {
+		t.Fatal(err)
+	}
+}
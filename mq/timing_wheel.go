@@ -0,0 +1,226 @@
+package mq
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/10 10 30
+//
+
+// 分层时间轮：共wheelLevels层，每层wheelSize个槽位。
+// 第L层每个槽位覆盖 wheelSize^L 个tick，定时器按剩余tick数放入对应层，
+// 低层转完一圈时将上一层当前槽位的定时器重新分配（降级）到低层。
+// 添加和取消都只是链表操作，时间复杂度O(1)。
+const (
+	wheelBits   = 6
+	wheelSize   = 1 << wheelBits
+	wheelMask   = wheelSize - 1
+	wheelLevels = 5
+	wheelSpan   = uint64(1) << (wheelBits * wheelLevels) // 时间轮能直接表示的最大tick数
+)
+
+// WheelTimer 时间轮中的定时器
+type WheelTimer struct {
+	wheel   *TimingWheel
+	expires uint64 // 到期tick
+	level   int    // 所在层
+	fn      func()
+	bucket  *list.List // 所在槽位，已触发或已取消时为nil
+	elem    *list.Element
+}
+
+// Stop 取消定时器，定时器尚未触发时返回true，语义与time.Timer.Stop一致
+func (t *WheelTimer) Stop() bool {
+	tw := t.wheel
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if t.bucket == nil {
+		return false
+	}
+	t.bucket.Remove(t.elem)
+	t.bucket, t.elem = nil, nil
+	tw.levelCount[t.level]--
+	tw.count--
+	return true
+}
+
+// TimingWheel 分层时间轮定时器，精度为一个tick
+type TimingWheel struct {
+	mu      sync.Mutex
+	tick    time.Duration
+	start   time.Time
+	current uint64 // 下一个待处理的tick
+	buckets [wheelLevels][wheelSize]*list.List
+	count   int
+	// 每层的定时器数量，用于跳过空闲的tick
+	levelCount [wheelLevels]int
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+// NewTimingWheel 创建时间轮，tick为时间精度
+func NewTimingWheel(tick time.Duration) *TimingWheel {
+	if tick <= 0 {
+		tick = time.Millisecond
+	}
+	tw := &TimingWheel{
+		tick:  tick,
+		start: time.Now(),
+		done:  make(chan struct{}),
+	}
+	for level := range tw.buckets {
+		for slot := range tw.buckets[level] {
+			tw.buckets[level][slot] = list.New()
+		}
+	}
+	return tw
+}
+
+// Start 启动时间轮的驱动协程
+func (tw *TimingWheel) Start() {
+	tw.startOnce.Do(func() {
+		go tw.run()
+	})
+}
+
+// Stop 停止时间轮，未触发的定时器不会再触发
+func (tw *TimingWheel) Stop() {
+	tw.stopOnce.Do(func() {
+		close(tw.done)
+	})
+}
+
+// Len 返回等待触发的定时器数量
+func (tw *TimingWheel) Len() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.count
+}
+
+// AfterFunc 在d之后于新的协程中执行f
+func (tw *TimingWheel) AfterFunc(d time.Duration, f func()) *WheelTimer {
+	// 向上取整，保证不会早于d触发
+	elapsed := time.Since(tw.start) + d
+	expires := uint64(0)
+	if elapsed > 0 {
+		expires = uint64((elapsed + tw.tick - 1) / tw.tick)
+	}
+	return tw.addAt(expires, f)
+}
+
+func (tw *TimingWheel) addAt(expires uint64, f func()) *WheelTimer {
+	t := &WheelTimer{wheel: tw, expires: expires, fn: f}
+	tw.mu.Lock()
+	tw.add(t)
+	tw.count++
+	tw.mu.Unlock()
+	return t
+}
+
+// add 按剩余tick数将定时器放入对应层的槽位，调用方需持有锁
+func (tw *TimingWheel) add(t *WheelTimer) {
+	expires := t.expires
+	if expires < tw.current {
+		expires = tw.current
+	}
+	delta := expires - tw.current
+	if delta >= wheelSpan {
+		// 超出范围的定时器先放在最高层，降级时重新计算
+		expires = tw.current + wheelSpan - 1
+		delta = wheelSpan - 1
+	}
+
+	level := 0
+	for level < wheelLevels-1 && delta >= uint64(1)<<(wheelBits*(level+1)) {
+		level++
+	}
+	slot := (expires >> (wheelBits * level)) & wheelMask
+	t.level = level
+	t.bucket = tw.buckets[level][slot]
+	t.elem = t.bucket.PushBack(t)
+	tw.levelCount[level]++
+}
+
+func (tw *TimingWheel) run() {
+	ticker := time.NewTicker(tw.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			tw.advanceTo(uint64(now.Sub(tw.start) / tw.tick))
+		case <-tw.done:
+			return
+		}
+	}
+}
+
+// advanceTo 推进时间轮直到target（含），触发所有到期的定时器
+func (tw *TimingWheel) advanceTo(target uint64) {
+	var expired []*WheelTimer
+
+	tw.mu.Lock()
+	for tw.current <= target {
+		if tw.count == 0 {
+			// 没有定时器时无需逐个tick降级
+			tw.current = target + 1
+			break
+		}
+		index := tw.current & wheelMask
+		if index == 0 {
+			tw.cascade()
+		}
+		if tw.levelCount[0] == 0 {
+			// 最低层为空时直接跳到最低非空层的下一次降级，但不超过target，
+			// 以免之后添加的定时器被放到未来的tick上
+			level := 1
+			for level < wheelLevels-1 && tw.levelCount[level] == 0 {
+				level++
+			}
+			tw.current = min((tw.current|(uint64(1)<<(wheelBits*level)-1))+1, target+1)
+			continue
+		}
+		bucket := tw.buckets[0][index]
+		for e := bucket.Front(); e != nil; {
+			next := e.Next()
+			t := e.Value.(*WheelTimer)
+			bucket.Remove(e)
+			t.bucket, t.elem = nil, nil
+			tw.levelCount[0]--
+			tw.count--
+			expired = append(expired, t)
+			e = next
+		}
+		tw.current++
+	}
+	tw.mu.Unlock()
+
+	for _, t := range expired {
+		go t.fn()
+	}
+}
+
+// cascade 低层转完一圈时，将上层当前槽位的定时器降级到低层，调用方需持有锁
+func (tw *TimingWheel) cascade() {
+	for level := 1; level < wheelLevels; level++ {
+		index := (tw.current >> (wheelBits * level)) & wheelMask
+		bucket := tw.buckets[level][index]
+		for e := bucket.Front(); e != nil; {
+			next := e.Next()
+			t := e.Value.(*WheelTimer)
+			bucket.Remove(e)
+			tw.levelCount[level]--
+			tw.add(t)
+			e = next
+		}
+		// 只有上层也转完一圈才继续降级更高层
+		if index != 0 {
+			return
+		}
+	}
+}
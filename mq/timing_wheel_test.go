@@ -0,0 +1,165 @@
+package mq
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/10 15 00
+//
+
+func TestTimingWheel_CascadeAcrossLevels(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond)
+	var fired sync.Map
+	expiries := []uint64{0, 1, 63, 64, 65, 4095, 4096, 4097, 300000, 1 << 24, 1<<24 + 7, 1 << 30, 1<<30 + 5}
+	for _, expires := range expiries {
+		expires := expires
+		tw.addAt(expires, func() { fired.Store(expires, true) })
+	}
+
+	// 逐段推进，每个定时器必须恰好在到期tick触发，不能提前
+	for _, expires := range expiries {
+		if expires > 0 {
+			tw.advanceTo(expires - 1)
+			time.Sleep(time.Millisecond)
+			if _, ok := fired.Load(expires); ok {
+				t.Fatalf("timer %d fired early", expires)
+			}
+		}
+		tw.advanceTo(expires)
+		waitFor(t, time.Second, func() bool {
+			_, ok := fired.Load(expires)
+			return ok
+		})
+	}
+	if tw.Len() != 0 {
+		t.Fatalf("expected empty wheel, got %d", tw.Len())
+	}
+}
+
+func TestTimingWheel_Stop(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond)
+	var fired int32
+	timer := tw.addAt(100, func() { atomic.AddInt32(&fired, 1) })
+	other := tw.addAt(100, func() { atomic.AddInt32(&fired, 1) })
+
+	if !timer.Stop() || timer.Stop() {
+		t.Fatal("timer should be stopped exactly once")
+	}
+	tw.advanceTo(200)
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&fired) == 1 })
+	if other.Stop() {
+		t.Fatal("fired timer can not be stopped")
+	}
+}
+
+func TestTimingWheel_AfterFunc(t *testing.T) {
+	tw := NewTimingWheel(time.Millisecond)
+	tw.Start()
+	defer tw.Stop()
+
+	start := time.Now()
+	fired := make(chan time.Duration, 1)
+	tw.AfterFunc(30*time.Millisecond, func() { fired <- time.Since(start) })
+	select {
+	case elapsed := <-fired:
+		if elapsed < 30*time.Millisecond {
+			t.Fatalf("timer fired early after %s", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timer did not fire")
+	}
+}
+
+func TestMQ_CancelDelayedMessage(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	received := make(chan string, 2)
+	b.RegisterSubscriber(NewSubscriber("delayed"))
+	b.Subscribe("delayed", map[Topic]MessageHandler{
+		"later": func(ctx context.Context, msg *Message) error {
+			received <- msg.ID
+			return nil
+		},
+	})
+
+	kept := NewMessage("later", nil)
+	kept.SetDelay(50 * time.Millisecond)
+	cancelled := NewMessage("later", nil)
+	cancelled.SetDelay(50 * time.Millisecond)
+	b.Publish(kept)
+	b.Publish(cancelled)
+	waitFor(t, time.Second, func() bool { return b.GetStats().DeliveryTimers == 2 })
+
+	if !b.CancelDelayedMessage(cancelled.ID) || b.CancelDelayedMessage(cancelled.ID) {
+		t.Fatal("delayed message should be cancelled exactly once")
+	}
+	select {
+	case id := <-received:
+		if id != kept.ID {
+			t.Fatalf("cancelled message %s was delivered", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("delayed message was not delivered")
+	}
+	select {
+	case id := <-received:
+		t.Fatalf("unexpected delivery %s", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func BenchmarkTimingWheel_AfterFuncStop(b *testing.B) {
+	tw := NewTimingWheel(time.Millisecond)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tw.AfterFunc(time.Hour, func() {}).Stop()
+	}
+}
+
+func BenchmarkTimer_AfterFuncStop(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		time.AfterFunc(time.Hour, func() {}).Stop()
+	}
+}
+
+// 大量定时器同时存在时的添加和取消
+func BenchmarkTimingWheel_Schedule100k(b *testing.B) {
+	const n = 100000
+	tw := NewTimingWheel(time.Millisecond)
+	timers := make([]*WheelTimer, n)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range timers {
+			timers[j] = tw.AfterFunc(time.Duration(j%3600)*time.Second, func() {})
+		}
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}
+}
+
+func BenchmarkTimer_Schedule100k(b *testing.B) {
+	const n = 100000
+	timers := make([]*time.Timer, n)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range timers {
+			timers[j] = time.AfterFunc(time.Duration(j%3600)*time.Second, func() {})
+		}
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}
+}
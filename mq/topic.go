@@ -2,6 +2,7 @@ package mq
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -17,6 +18,13 @@ const (
 	TopicDeadLetterPrefix Topic = "deadLetter/"
 )
 
+// 通配符定义（与MQTT一致）
+const (
+	TopicSeparator          = "/"
+	TopicWildcardSingle     = "+" // 匹配单个层级
+	TopicWildcardMultiLevel = "#" // 匹配剩余所有层级，只能出现在最后
+)
+
 type Topic string
 
 func (t Topic) IsBroadcast() bool {
@@ -31,9 +39,108 @@ func (t Topic) IsDeadLetter() bool {
 	return strings.HasPrefix(string(t), string(TopicDeadLetterPrefix))
 }
 
+// IsWildcard 判断topic是否包含通配符
+func (t Topic) IsWildcard() bool {
+	return strings.ContainsAny(string(t), TopicWildcardSingle+TopicWildcardMultiLevel)
+}
+
+// Levels 按层级拆分topic
+func (t Topic) Levels() []string {
+	return strings.Split(string(t), TopicSeparator)
+}
+
 func (t Topic) Validate() error {
 	if t == "" {
 		return errors.New("topic can not be empty")
 	}
+	levels := t.Levels()
+	for i, level := range levels {
+		if strings.Contains(level, TopicWildcardMultiLevel) {
+			if level != TopicWildcardMultiLevel || i != len(levels)-1 {
+				return errors.New("multi-level wildcard must occupy the last level")
+			}
+		}
+		if strings.Contains(level, TopicWildcardSingle) && level != TopicWildcardSingle {
+			return errors.New("single-level wildcard must occupy an entire level")
+		}
+	}
+	return nil
+}
+
+// ValidateID 校验订阅者或客户端ID：不能为空，不能包含通配符和层级分隔符，
+// 避免ID拼接到 p2p/<id> 或授权规则中后成为通配模式
+func ValidateID(id string) error {
+	if id == "" {
+		return errors.New("id can not be empty")
+	}
+	if strings.ContainsAny(id, TopicSeparator+TopicWildcardSingle+TopicWildcardMultiLevel) {
+		return fmt.Errorf("id %q can not contain %q, %q or %q", id, TopicSeparator, TopicWildcardSingle, TopicWildcardMultiLevel)
+	}
 	return nil
 }
+
+// Matches 将t作为订阅模式，判断具体topic是否与之匹配
+// 首层通配符不匹配p2p主题，避免点对点消息被通配订阅窃听
+func (t Topic) Matches(topic Topic) bool {
+	if !t.IsWildcard() {
+		return t == topic
+	}
+	patternLevels := t.Levels()
+	topicLevels := topic.Levels()
+	for i, level := range patternLevels {
+		if i == 0 && topic.IsP2P() && (level == TopicWildcardSingle || level == TopicWildcardMultiLevel) {
+			return false
+		}
+		if level == TopicWildcardMultiLevel {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != TopicWildcardSingle && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(patternLevels) == len(topicLevels)
+}
+
+// Covers 判断模式t匹配的主题是否包含模式other匹配的所有主题
+func (t Topic) Covers(other Topic) bool {
+	patternLevels := t.Levels()
+	otherLevels := other.Levels()
+	for i, level := range patternLevels {
+		if level == TopicWildcardMultiLevel {
+			return true
+		}
+		if i >= len(otherLevels) || otherLevels[i] == TopicWildcardMultiLevel {
+			return false
+		}
+		if level != TopicWildcardSingle && level != otherLevels[i] {
+			return false
+		}
+	}
+	return len(patternLevels) == len(otherLevels)
+}
+
+// Overlaps 判断模式t与模式other是否存在同时匹配的主题
+func (t Topic) Overlaps(other Topic) bool {
+	levels := t.Levels()
+	otherLevels := other.Levels()
+	for i := 0; i < len(levels) && i < len(otherLevels); i++ {
+		a, b := levels[i], otherLevels[i]
+		if a == TopicWildcardMultiLevel || b == TopicWildcardMultiLevel {
+			return true
+		}
+		if a != TopicWildcardSingle && b != TopicWildcardSingle && a != b {
+			return false
+		}
+	}
+	if len(levels) == len(otherLevels) {
+		return true
+	}
+	// 长度不同时，只有较长一方的下一层是多层通配符才有交集（如 a/# 与 a）
+	if len(levels) > len(otherLevels) {
+		return levels[len(otherLevels)] == TopicWildcardMultiLevel
+	}
+	return otherLevels[len(levels)] == TopicWildcardMultiLevel
+}
@@ -0,0 +1,133 @@
+package mq
+
+import (
+	"strings"
+	"sync"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/25 10 12
+//
+
+// TopicMatch 一条命中的订阅
+type TopicMatch struct {
+	SubscriberID string // 订阅者ID
+	Pattern      Topic  // 命中的订阅模式
+	Group        string // 消费者组，为空表示普通广播订阅
+}
+
+// topicNode 前缀树节点，每个节点对应topic的一个层级
+type topicNode struct {
+	children    map[string]*topicNode
+	pattern     Topic             // 到达该节点的完整订阅模式
+	subscribers map[string]string // 以该节点为终点的订阅者: subscriberID -> group
+}
+
+func newTopicNode(pattern Topic) *topicNode {
+	return &topicNode{
+		children:    make(map[string]*topicNode),
+		pattern:     pattern,
+		subscribers: make(map[string]string),
+	}
+}
+
+// topicTrie 支持+和#通配符的订阅前缀树
+type topicTrie struct {
+	mu   sync.RWMutex
+	root *topicNode
+}
+
+func newTopicTrie() *topicTrie {
+	return &topicTrie{root: newTopicNode("")}
+}
+
+// Add 添加订阅模式，group为空表示普通订阅
+func (t *topicTrie) Add(pattern Topic, subscriberID string, group string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	levels := pattern.Levels()
+	node := t.root
+	for i, level := range levels {
+		child, ok := node.children[level]
+		if !ok {
+			child = newTopicNode(Topic(strings.Join(levels[:i+1], TopicSeparator)))
+			node.children[level] = child
+		}
+		node = child
+	}
+	node.subscribers[subscriberID] = group
+}
+
+// Remove 移除订阅模式，并清理空节点
+func (t *topicTrie) Remove(pattern Topic, subscriberID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	levels := pattern.Levels()
+	path := make([]*topicNode, 0, len(levels)+1)
+	path = append(path, t.root)
+	node := t.root
+	for _, level := range levels {
+		child, ok := node.children[level]
+		if !ok {
+			return
+		}
+		path = append(path, child)
+		node = child
+	}
+	delete(node.subscribers, subscriberID)
+
+	// 自底向上清理空节点
+	for i := len(levels); i > 0; i-- {
+		n := path[i]
+		if len(n.subscribers) > 0 || len(n.children) > 0 {
+			break
+		}
+		delete(path[i-1].children, levels[i-1])
+	}
+}
+
+// Match 查找与具体topic匹配的所有订阅
+func (t *topicTrie) Match(topic Topic) []TopicMatch {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	result := make([]TopicMatch, 0)
+	t.match(t.root, topic.Levels(), 0, topic.IsP2P(), &result)
+	return result
+}
+
+func (t *topicTrie) match(node *topicNode, levels []string, idx int, p2p bool, result *[]TopicMatch) {
+	// 首层通配符不匹配p2p主题
+	wildcardAllowed := idx > 0 || !p2p
+
+	if idx == len(levels) {
+		collectMatches(node, result)
+		// a/# 同样匹配 a
+		if child, ok := node.children[TopicWildcardMultiLevel]; ok && wildcardAllowed {
+			collectMatches(child, result)
+		}
+		return
+	}
+
+	if child, ok := node.children[levels[idx]]; ok {
+		t.match(child, levels, idx+1, p2p, result)
+	}
+	if !wildcardAllowed {
+		return
+	}
+	if child, ok := node.children[TopicWildcardSingle]; ok {
+		t.match(child, levels, idx+1, p2p, result)
+	}
+	if child, ok := node.children[TopicWildcardMultiLevel]; ok {
+		collectMatches(child, result)
+	}
+}
+
+func collectMatches(node *topicNode, result *[]TopicMatch) {
+	for subscriberID, group := range node.subscribers {
+		*result = append(*result, TopicMatch{SubscriberID: subscriberID, Pattern: node.pattern, Group: group})
+	}
+}
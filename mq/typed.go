@@ -0,0 +1,111 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Yui100901/MyGo/struct_utils"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/11 10 00
+//
+
+// HeaderContentType 载荷编码格式
+const HeaderContentType = "content-type"
+
+// 载荷编码格式对应的content-type
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeYAML = "application/yaml"
+	ContentTypeXML  = "application/xml"
+	ContentTypeGob  = "application/x-gob"
+)
+
+// TypedHandler 类型化的消息处理函数，value为解码后的载荷
+type TypedHandler[T any] func(ctx context.Context, msg *Message, value *T) error
+
+// ContentTypeOf 返回数据格式对应的content-type
+func ContentTypeOf(format struct_utils.DataFormat) (string, error) {
+	switch format {
+	case struct_utils.JSON:
+		return ContentTypeJSON, nil
+	case struct_utils.YAML:
+		return ContentTypeYAML, nil
+	case struct_utils.XML:
+		return ContentTypeXML, nil
+	case struct_utils.Gob:
+		return ContentTypeGob, nil
+	default:
+		return "", fmt.Errorf("unsupported data format: %v", format)
+	}
+}
+
+// FormatOfContentType 返回content-type对应的数据格式，为空时视为JSON
+func FormatOfContentType(contentType string) (struct_utils.DataFormat, error) {
+	switch contentType {
+	case "", ContentTypeJSON:
+		return struct_utils.JSON, nil
+	case ContentTypeYAML:
+		return struct_utils.YAML, nil
+	case ContentTypeXML:
+		return struct_utils.XML, nil
+	case ContentTypeGob:
+		return struct_utils.Gob, nil
+	default:
+		return 0, fmt.Errorf("unsupported content type: %s", contentType)
+	}
+}
+
+// NewTypedMessage 按指定格式编码value并创建消息，编码格式写入content-type消息头
+func NewTypedMessage[T any](topic Topic, value T, format struct_utils.DataFormat) (*Message, error) {
+	contentType, err := ContentTypeOf(format)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := struct_utils.MarshalData(value, format)
+	if err != nil {
+		return nil, err
+	}
+	msg := NewMessage(topic, payload)
+	msg.SetHeader(HeaderContentType, contentType)
+	return msg, nil
+}
+
+// PublishTyped 按指定格式编码value并发布
+func PublishTyped[T any](b *MessageBroker, topic Topic, value T, format struct_utils.DataFormat) error {
+	msg, err := NewTypedMessage(topic, value, format)
+	if err != nil {
+		return err
+	}
+	return b.Publish(msg)
+}
+
+// DecodeMessage 按content-type消息头解码消息载荷
+func DecodeMessage[T any](msg *Message) (*T, error) {
+	format, err := FormatOfContentType(msg.GetHeader(HeaderContentType))
+	if err != nil {
+		return nil, err
+	}
+	return struct_utils.UnmarshalData[T](msg.Payload, format)
+}
+
+// TypedMessageHandler 将类型化处理函数包装为MessageHandler，
+// 解码失败的消息不会重试，直接转入死信
+func TypedMessageHandler[T any](handler TypedHandler[T]) MessageHandler {
+	return func(ctx context.Context, msg *Message) error {
+		value, err := DecodeMessage[T](msg)
+		if err != nil {
+			return Permanent(fmt.Errorf("decode message %s failed: %w", msg.ID, err))
+		}
+		return handler(ctx, msg, value)
+	}
+}
+
+// SubscribeTyped 以类型化处理函数订阅主题
+func SubscribeTyped[T any](b *MessageBroker, subscriberID string, topic Topic, handler TypedHandler[T]) error {
+	return b.Subscribe(subscriberID, map[Topic]MessageHandler{
+		topic: TypedMessageHandler(handler),
+	})
+}
@@ -0,0 +1,71 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Yui100901/MyGo/struct_utils"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/9/11 14 30
+//
+
+type sensorReading struct {
+	Device string
+	Value  float64
+}
+
+func TestMQ_TypedPublishSubscribe(t *testing.T) {
+	b := NewMessageBroker(nil)
+	b.Start()
+	defer b.Stop()
+
+	received := make(chan *sensorReading, 4)
+	deadLetters := make(chan *Message, 1)
+	b.RegisterSubscriber(NewSubscriber("typed"))
+	err := SubscribeTyped(b, "typed", "sensor/+", func(ctx context.Context, msg *Message, value *sensorReading) error {
+		received <- value
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Subscribe("typed", map[Topic]MessageHandler{
+		TopicDeadLetterPrefix + "#": func(ctx context.Context, msg *Message) error {
+			deadLetters <- msg
+			return nil
+		},
+	})
+
+	formats := []struct_utils.DataFormat{struct_utils.JSON, struct_utils.YAML, struct_utils.XML, struct_utils.Gob}
+	for _, format := range formats {
+		want := sensorReading{Device: "dev-1", Value: 21.5}
+		if err := PublishTyped(b, "sensor/temperature", want, format); err != nil {
+			t.Fatalf("publish format %v: %v", format, err)
+		}
+		select {
+		case got := <-received:
+			if *got != want {
+				t.Fatalf("format %v: expected %+v, got %+v", format, want, *got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("format %v: message not received", format)
+		}
+	}
+
+	// 解码失败不重试，直接转入死信
+	bad := NewMessage("sensor/temperature", []byte("{not json"))
+	bad.SetHeader(HeaderContentType, ContentTypeJSON)
+	b.Publish(bad)
+	select {
+	case msg := <-deadLetters:
+		if msg.GetHeader(HeaderOriginalMessageID) != bad.ID || msg.GetHeader(HeaderAttempts) != "1" {
+			t.Fatalf("unexpected dead letter headers %v", msg.Headers)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("undecodable message was not routed to dead letter")
+	}
+}
@@ -0,0 +1,371 @@
+package mq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/26 14 20
+//
+
+const (
+	walSegmentSuffix      = ".wal"
+	defaultWALSegmentSize = 16 * 1024 * 1024
+	defaultWALMaxSegments = 8
+	maxWALRecordSize      = 64 * 1024 * 1024
+)
+
+// WALConfig 预写日志配置
+type WALConfig struct {
+	Dir         string // 日志目录
+	SegmentSize int64  // 单个段文件的最大字节数，超过后滚动到新段
+	MaxSegments int    // 段文件数量超过该值时触发压缩
+	SyncOnWrite bool   // 每次写入后是否立即落盘
+}
+
+// DefaultWALConfig 返回默认的预写日志配置
+func DefaultWALConfig(dir string) *WALConfig {
+	return &WALConfig{
+		Dir:         dir,
+		SegmentSize: defaultWALSegmentSize,
+		MaxSegments: defaultWALMaxSegments,
+		SyncOnWrite: true,
+	}
+}
+
+// walOp 日志记录类型
+type walOp uint8
+
+const (
+	walOpPublish walOp = iota + 1 // 消息已接收
+	walOpDone                     // 消息已投递完成或被丢弃
+)
+
+// walRecord 日志记录
+type walRecord struct {
+	Op      walOp    `json:"op"`
+	ID      string   `json:"id"`
+	Message *Message `json:"message,omitempty"`
+}
+
+// WAL 基于文件的追加写日志，记录尚未投递完成的消息
+// 每条记录格式: 4字节长度 + 4字节CRC32 + JSON内容
+type WAL struct {
+	config *WALConfig
+
+	mu          sync.Mutex
+	active      *os.File
+	writer      *bufio.Writer
+	activeIndex int
+	activeSize  int64
+	segments    []int               // 所有段文件序号（含当前段），升序
+	live        map[string]*Message // 尚未完成的消息
+	closed      bool
+}
+
+// OpenWAL 打开（或创建）预写日志，并加载已有段中未完成的消息
+func OpenWAL(config *WALConfig) (*WAL, error) {
+	if config == nil || config.Dir == "" {
+		return nil, errors.New("wal dir can not be empty")
+	}
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = defaultWALSegmentSize
+	}
+	if config.MaxSegments <= 0 {
+		config.MaxSegments = defaultWALMaxSegments
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("create wal dir failed: %w", err)
+	}
+
+	w := &WAL{
+		config: config,
+		live:   make(map[string]*Message),
+	}
+
+	segments, err := w.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range segments {
+		if err := w.loadSegment(index); err != nil {
+			return nil, err
+		}
+	}
+	w.segments = segments
+
+	// 总是写入新段，避免在可能损坏的尾部继续追加
+	next := 1
+	if len(segments) > 0 {
+		next = segments[len(segments)-1] + 1
+	}
+	if err := w.openSegment(next); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Append 写入一条消息记录
+func (w *WAL) Append(msg *Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errors.New("wal is closed")
+	}
+	if err := w.writeRecord(&walRecord{Op: walOpPublish, ID: msg.ID, Message: msg}); err != nil {
+		return err
+	}
+	w.live[msg.ID] = msg
+	return w.maybeRotate()
+}
+
+// MarkDone 标记消息已完成，未记录过的消息会被忽略
+func (w *WAL) MarkDone(msgID string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errors.New("wal is closed")
+	}
+	if _, ok := w.live[msgID]; !ok {
+		return nil
+	}
+	if err := w.writeRecord(&walRecord{Op: walOpDone, ID: msgID}); err != nil {
+		return err
+	}
+	delete(w.live, msgID)
+	return w.maybeRotate()
+}
+
+// Pending 返回尚未完成的消息，按创建时间排序
+func (w *WAL) Pending() []*Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	result := make([]*Message, 0, len(w.live))
+	for _, msg := range w.live {
+		result = append(result, msg)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// SegmentCount 返回当前段文件数量
+func (w *WAL) SegmentCount() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.segments)
+}
+
+// Compact 将未完成且未过期的消息重写到新段，并删除旧段
+func (w *WAL) Compact() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errors.New("wal is closed")
+	}
+	return w.compact()
+}
+
+// Close 关闭日志
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.closeActive()
+}
+
+func (w *WAL) compact() error {
+	oldSegments := w.segments
+	next := w.activeIndex + 1
+
+	if err := w.closeActive(); err != nil {
+		return err
+	}
+	w.segments = nil
+	if err := w.openSegment(next); err != nil {
+		return err
+	}
+
+	for id, msg := range w.live {
+		if msg.IsExpired() {
+			delete(w.live, id)
+			continue
+		}
+		if err := w.writeRecord(&walRecord{Op: walOpPublish, ID: id, Message: msg}); err != nil {
+			return err
+		}
+	}
+	if err := w.flush(true); err != nil {
+		return err
+	}
+
+	for _, index := range oldSegments {
+		if err := os.Remove(w.segmentPath(index)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove wal segment failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *WAL) maybeRotate() error {
+	if w.activeSize < w.config.SegmentSize {
+		return nil
+	}
+	if len(w.segments) >= w.config.MaxSegments {
+		return w.compact()
+	}
+	if err := w.closeActive(); err != nil {
+		return err
+	}
+	return w.openSegment(w.activeIndex + 1)
+}
+
+func (w *WAL) writeRecord(record *walRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode wal record failed: %w", err)
+	}
+
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(data))
+	if _, err := w.writer.Write(header); err != nil {
+		return fmt.Errorf("write wal record failed: %w", err)
+	}
+	if _, err := w.writer.Write(data); err != nil {
+		return fmt.Errorf("write wal record failed: %w", err)
+	}
+	w.activeSize += int64(len(header) + len(data))
+	return w.flush(w.config.SyncOnWrite)
+}
+
+func (w *WAL) flush(sync bool) error {
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("flush wal failed: %w", err)
+	}
+	if sync {
+		if err := w.active.Sync(); err != nil {
+			return fmt.Errorf("sync wal failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *WAL) openSegment(index int) error {
+	file, err := os.OpenFile(w.segmentPath(index), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open wal segment failed: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("stat wal segment failed: %w", err)
+	}
+	w.active = file
+	w.writer = bufio.NewWriter(file)
+	w.activeIndex = index
+	w.activeSize = info.Size()
+	w.segments = append(w.segments, index)
+	return nil
+}
+
+func (w *WAL) closeActive() error {
+	if w.active == nil {
+		return nil
+	}
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	err := w.active.Close()
+	w.active = nil
+	w.writer = nil
+	return err
+}
+
+// loadSegment 读取段文件，遇到不完整或校验失败的记录时停止读取该段
+func (w *WAL) loadSegment(index int) error {
+	file, err := os.Open(w.segmentPath(index))
+	if err != nil {
+		return fmt.Errorf("open wal segment failed: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		if length > maxWALRecordSize {
+			return nil
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil
+		}
+		if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+			return nil
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil
+		}
+		switch record.Op {
+		case walOpPublish:
+			if record.Message != nil {
+				w.live[record.ID] = record.Message
+			}
+		case walOpDone:
+			delete(w.live, record.ID)
+		}
+	}
+}
+
+func (w *WAL) listSegments() ([]int, error) {
+	entries, err := os.ReadDir(w.config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read wal dir failed: %w", err)
+	}
+	segments := make([]int, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, walSegmentSuffix) {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSuffix(name, walSegmentSuffix))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, index)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func (w *WAL) segmentPath(index int) string {
+	return filepath.Join(w.config.Dir, fmt.Sprintf("%016d%s", index, walSegmentSuffix))
+}
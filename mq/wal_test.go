@@ -0,0 +1,94 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+//
+// @Author yfy2001
+// @Date 2025/8/26 16 05
+//
+
+func TestWAL_RotateAndCompact(t *testing.T) {
+	dir := t.TempDir()
+	config := &WALConfig{Dir: dir, SegmentSize: 1024, MaxSegments: 3}
+	w, err := OpenWAL(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		msg := NewMessage("test", []byte(fmt.Sprintf("message %d", i)))
+		msg.ID = fmt.Sprintf("msg_%d", i)
+		if err := w.Append(msg); err != nil {
+			t.Fatal(err)
+		}
+		if i%10 != 0 {
+			if err := w.MarkDone(msg.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if count := w.SegmentCount(); count > config.MaxSegments {
+		t.Fatalf("expected at most %d segments, got %d", config.MaxSegments, count)
+	}
+	w.Close()
+
+	w, err = OpenWAL(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	pending := w.Pending()
+	if len(pending) != 10 {
+		t.Fatalf("expected 10 pending messages, got %d", len(pending))
+	}
+	if string(pending[0].Payload) != "message 0" {
+		t.Fatalf("unexpected first pending message %s", pending[0].Payload)
+	}
+}
+
+func TestMQ_WALReplay(t *testing.T) {
+	dir := t.TempDir()
+	config := DefaultBrokerConfig()
+	config.WAL = DefaultWALConfig(dir)
+
+	b1 := NewMessageBroker(config)
+	if err := b1.Start(); err != nil {
+		t.Fatal(err)
+	}
+	msg := NewMessage("delayed", []byte("hello"))
+	msg.SetDelay(300 * time.Millisecond)
+	if err := b1.Publish(msg); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	b1.Stop()
+
+	b2 := NewMessageBroker(config)
+	received := make(chan *Message, 1)
+	c1 := NewSubscriber("c1")
+	b2.RegisterSubscriber(c1)
+	b2.Subscribe(c1.ID(), map[Topic]MessageHandler{
+		"delayed": func(ctx context.Context, msg *Message) error {
+			received <- msg
+			return nil
+		},
+	})
+	if err := b2.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer b2.Stop()
+
+	select {
+	case got := <-received:
+		if got.ID != msg.ID {
+			t.Fatalf("expected message %s, got %s", msg.ID, got.ID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("delayed message was not replayed")
+	}
+}
@@ -6,11 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
+	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/Yui100901/MyGo/concurrency"
+	"github.com/Yui100901/MyGo/log_utils"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
@@ -37,8 +38,8 @@ type MQTTClient struct {
 	ctx       context.Context
 	cancel    context.CancelFunc
 
-	logger      *log.Logger // 日志记录器
-	reconnectMu sync.Mutex  // 重连操作锁
+	logger      *slog.Logger // 日志记录器
+	reconnectMu sync.Mutex   // 重连操作锁
 }
 
 //type MQTTPublishRequest struct {
@@ -57,13 +58,14 @@ type MQTTClient struct {
 //	}
 //}
 
-func NewMQTTClient(config MQTTConfiguration) (*MQTTClient, error) {
+// NewMQTTClient 创建MQTT客户端并连接，logOpts配置日志输出
+func NewMQTTClient(config MQTTConfiguration, logOpts ...log_utils.Option) (*MQTTClient, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	c := &MQTTClient{
 		subscriptions: concurrency.NewSafeMap[string, *Subscription](32),
 		ctx:           ctx,
 		cancel:        cancel,
-		logger:        log.New(os.Stdout, "[MQTT]["+config.ID+"] ", log.LstdFlags),
+		logger:        log_utils.NewLogger("mqtt", logOpts...).With("client", config.ID),
 	}
 
 	opts := mqtt.NewClientOptions()
@@ -118,9 +120,9 @@ func (c *MQTTClient) monitorConnection() {
 			return
 		case <-ticker.C:
 			if !c.client.IsConnected() {
-				c.logger.Println("Attempting to reconnect...")
+				c.logger.Info("Attempting to reconnect")
 				if err := c.connect(); err != nil {
-					c.logger.Printf("Reconnect failed: %v. Retrying in %v", err, reconnectDelay)
+					c.logger.Error("Reconnect failed", "error", err, "retry_in", reconnectDelay)
 					time.Sleep(reconnectDelay)
 				}
 			}
@@ -155,9 +157,9 @@ func (c *MQTTClient) ResubscribeAll() {
 			handler(client, msg)
 		}
 	}); token.Wait() && token.Error() != nil {
-		c.logger.Printf("Resubscribe failed: %v", token.Error())
+		c.logger.Error("Resubscribe failed", "error", token.Error())
 	} else {
-		c.logger.Printf("Resubscribed to %d topics", len(topics))
+		c.logger.Info("Resubscribed", "topics", len(topics))
 	}
 }
 
@@ -172,12 +174,12 @@ func (c *MQTTClient) Subscribe(topic string, qos byte, callback mqtt.MessageHand
 
 	if c.IsConnected() {
 		if token := c.client.Subscribe(topic, qos, callback); token.Wait() && token.Error() != nil {
-			c.logger.Printf("Error subscribing to topic %s: %v", topic, token.Error())
+			c.logger.Error("Subscribe failed", "topic", topic, "error", token.Error())
 		} else {
-			c.logger.Printf("Subscribed to topic: %s (QoS: %d)", topic, qos)
+			c.logger.Info("Subscribed", "topic", topic, "qos", qos)
 		}
 	} else {
-		c.logger.Printf("Offline: Topic %s added to subscription list", topic)
+		c.logger.Info("Offline, topic added to subscription list", "topic", topic)
 	}
 }
 
@@ -206,12 +208,12 @@ func (c *MQTTClient) SubscribeMultiple(subscriptions ...Subscription) {
 				handler(client, msg)
 			}
 		}); token.Wait() && token.Error() != nil {
-			c.logger.Printf("Batch subscribe failed: %v", token.Error())
+			c.logger.Error("Batch subscribe failed", "error", token.Error())
 		} else {
-			c.logger.Printf("Subscribed to %d topics", len(subscriptions))
+			c.logger.Info("Subscribed", "topics", len(subscriptions))
 		}
 	} else {
-		c.logger.Printf("Offline: Added %d topics to subscription list", len(subscriptions))
+		c.logger.Info("Offline, topics added to subscription list", "topics", len(subscriptions))
 	}
 }
 
@@ -228,12 +230,12 @@ func (c *MQTTClient) Unsubscribe(topics ...string) {
 
 	if c.IsConnected() {
 		if token := c.client.Unsubscribe(topics...); token.Wait() && token.Error() != nil {
-			c.logger.Printf("Batch unsubscribe failed: %v", token.Error())
+			c.logger.Error("Batch unsubscribe failed", "error", token.Error())
 		} else {
-			c.logger.Printf("Unsubscribed from %d topics", len(topics))
+			c.logger.Info("Unsubscribed", "topics", len(topics))
 		}
 	} else {
-		c.logger.Printf("Offline: Removed %d topics from subscription list", len(topics))
+		c.logger.Info("Offline, topics removed from subscription list", "topics", len(topics))
 	}
 }
 
@@ -268,13 +270,13 @@ func (c *MQTTClient) Publish(topic string, qos byte, retained bool, payload inte
 		return err
 	}
 
-	c.logger.Printf("Published to topic %s (QoS: %d)", topic, qos)
+	c.logger.Debug("Published", "topic", topic, "qos", qos)
 	return nil
 }
 
 // Disconnect 断开连接
 func (c *MQTTClient) Disconnect() {
-	c.logger.Println("Disconnected from broker")
+	c.logger.Info("Disconnected from broker")
 	c.safeClose()
 }
 
@@ -288,14 +290,19 @@ func (c *MQTTClient) safeClose() {
 func (c *MQTTClient) OnConnectHandler(client mqtt.Client) {
 	// 重新订阅所有已注册的主题
 	c.ResubscribeAll()
-	c.logger.Println("Connected and subscriptions restored")
+	c.logger.Info("Connected and subscriptions restored")
 }
 
 func (c *MQTTClient) ConnectionLostHandler(client mqtt.Client, err error) {
-	c.logger.Printf("Connection Lost! Error: %v", err)
+	c.logger.Warn("Connection lost", "error", err)
 }
 
-// SetLogger 设置自定义日志器
+// SetLogger 设置自定义日志器，日志以文本格式写入logger的输出
 func (c *MQTTClient) SetLogger(logger *log.Logger) {
+	c.SetSlogLogger(log_utils.NewLogger("mqtt", log_utils.WithStdLogger(logger)))
+}
+
+// SetSlogLogger 设置自定义slog日志器
+func (c *MQTTClient) SetSlogLogger(logger *slog.Logger) {
 	c.logger = logger
 }
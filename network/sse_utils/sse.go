@@ -3,12 +3,13 @@ package sse_utils
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
-	"os"
 	"sync"
 	"time"
+
+	"github.com/Yui100901/MyGo/log_utils"
 )
 
 //
@@ -26,14 +27,14 @@ type SSEConnection struct {
 	ctx       context.Context
 	cancel    context.CancelFunc
 
-	writeMu sync.Mutex  // 写锁，保证消息写入的并发安全
-	logger  *log.Logger // 日志
+	writeMu sync.Mutex   // 写锁，保证消息写入的并发安全
+	logger  *slog.Logger // 日志
 
 	heartbeatTicker *time.Ticker // 心跳定时器
 }
 
-// NewConnection 创建新的SSE连接
-func NewConnection(w http.ResponseWriter) (*SSEConnection, error) {
+// NewConnection 创建新的SSE连接，opts配置日志输出
+func NewConnection(w http.ResponseWriter, opts ...log_utils.Option) (*SSEConnection, error) {
 	// 设置SSE响应头
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -58,10 +59,15 @@ func NewConnection(w http.ResponseWriter) (*SSEConnection, error) {
 		closeOnce: sync.Once{},
 		ctx:       ctx,
 		cancel:    cancel,
-		logger:    log.New(os.Stdout, "[SSE] ", log.LstdFlags),
+		logger:    log_utils.NewLogger("sse", opts...),
 	}, nil
 }
 
+// SetLogger 设置自定义日志记录器
+func (c *SSEConnection) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
 // Write 实现 io.Writer 接口
 func (c *SSEConnection) Write(p []byte) (n int, err error) {
 	return c.w.Write(p)
@@ -81,11 +87,11 @@ func (c *SSEConnection) SendMessage(msg *SSEMessage) error {
 
 	data := msg.Encode()
 	if _, err := c.w.Write(data); err != nil {
-		c.logger.Printf("发送消息失败: %v", err)
+		c.logger.Error("发送消息失败", "error", err)
 		return err
 	}
 	c.flusher.Flush()
-	c.logger.Printf("消息发送成功 (长度: %d字节)", len(data))
+	c.logger.Debug("消息发送成功", "length", len(data))
 	return nil
 }
 
@@ -101,16 +107,16 @@ func (c *SSEConnection) StartHeartbeat(interval time.Duration) {
 		for {
 			select {
 			case <-c.ctx.Done():
-				c.logger.Println("心跳协程退出")
+				c.logger.Debug("心跳协程退出")
 				return
 			case <-c.heartbeatTicker.C:
 				if _, err := c.w.Write([]byte(":\n\n")); err != nil {
-					c.logger.Printf("心跳发送失败: %v", err)
+					c.logger.Error("心跳发送失败", "error", err)
 					c.Close()
 					return
 				}
 				c.flusher.Flush()
-				c.logger.Printf("心跳已发送")
+				c.logger.Debug("心跳已发送")
 			}
 		}
 	}()
@@ -140,6 +146,6 @@ func (c *SSEConnection) Close() {
 			_ = cn.Close()
 		}
 
-		c.logger.Println("连接已关闭")
+		c.logger.Info("连接已关闭")
 	})
 }
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
-	"os"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/Yui100901/MyGo/log_utils"
 )
 
 //
@@ -32,7 +34,7 @@ type TCPConn struct {
 	done             chan struct{}
 	readMu           sync.Mutex
 	writeMu          sync.Mutex
-	logger           *log.Logger
+	logger           *slog.Logger
 	readTimeout      time.Duration
 	writeTimeout     time.Duration
 	heartbeatTicker  *time.Ticker
@@ -42,42 +44,46 @@ type TCPConn struct {
 	writer           *bufio.Writer
 }
 
-// NewTCPConn 创建新的TCP连接
-func NewTCPConn(conn net.Conn) *TCPConn {
+// NewTCPConn 创建新的TCP连接，opts配置日志输出
+func NewTCPConn(conn net.Conn, opts ...log_utils.Option) *TCPConn {
 	tcp := &TCPConn{
 		conn:         conn,
 		done:         make(chan struct{}),
-		logger:       log.New(os.Stdout, "[TCP] ", log.LstdFlags),
+		logger:       log_utils.NewLogger("tcp", opts...).With("remote", conn.RemoteAddr().String()),
 		readTimeout:  defaultReadTimeout,
 		writeTimeout: defaultWriteTimeout,
 		reader:       bufio.NewReader(conn),
 		writer:       bufio.NewWriter(conn),
 	}
 
-	tcp.logger.Printf("创建新的TCP连接 (Local: %s, Remote: %s)",
-		tcp.LocalAddr(), tcp.RemoteAddr())
+	tcp.logger.Info("创建新的TCP连接", "local", tcp.LocalAddr())
 	return tcp
 }
 
 // Dial 连接到TCP服务器
-func Dial(addr string, timeout time.Duration) (*TCPConn, error) {
+func Dial(addr string, timeout time.Duration, opts ...log_utils.Option) (*TCPConn, error) {
 	dialer := net.Dialer{Timeout: timeout}
 	conn, err := dialer.Dial("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("连接失败: %w", err)
 	}
-	return NewTCPConn(conn), nil
+	return NewTCPConn(conn, opts...), nil
 }
 
 // ListenAndServe 监听TCP连接
-func ListenAndServe(addr string, handler func(*TCPConn)) error {
+func ListenAndServe(addr string, handler func(*TCPConn), opts ...log_utils.Option) error {
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("监听失败: %w", err)
 	}
+	return Serve(listener, handler, opts...)
+}
+
+// Serve 在已有的监听器上接受TCP连接
+func Serve(listener net.Listener, handler func(*TCPConn), opts ...log_utils.Option) error {
 	defer listener.Close()
 
-	log.Printf("TCP服务器监听于 %s", addr)
+	log_utils.NewLogger("tcp", opts...).Info("TCP服务器监听", "addr", listener.Addr().String())
 
 	for {
 		conn, err := listener.Accept()
@@ -90,14 +96,19 @@ func ListenAndServe(addr string, handler func(*TCPConn)) error {
 			return fmt.Errorf("接受连接失败: %w", err)
 		}
 
-		tcpConn := NewTCPConn(conn)
+		tcpConn := NewTCPConn(conn, opts...)
 		go handler(tcpConn)
 	}
 }
 
-// SetLogger 设置自定义日志记录器
+// SetLogger 设置自定义日志记录器，日志以文本格式写入logger的输出
 func (t *TCPConn) SetLogger(logger *log.Logger) {
-	t.logger = logger
+	t.SetSlogLogger(log_utils.NewLogger("tcp", log_utils.WithStdLogger(logger)))
+}
+
+// SetSlogLogger 设置自定义slog日志记录器，对端地址作为日志属性
+func (t *TCPConn) SetSlogLogger(logger *slog.Logger) {
+	t.logger = logger.With("remote", t.RemoteAddr())
 }
 
 // SetTimeouts 设置读写超时
@@ -112,7 +123,7 @@ func (t *TCPConn) StartHeartbeat(interval time.Duration, heartbeatMsg []byte) {
 	defer t.heartbeatMutex.Unlock()
 
 	if t.IsClosed() {
-		t.logger.Println("尝试启动心跳但连接已关闭")
+		t.logger.Warn("尝试启动心跳但连接已关闭")
 		return
 	}
 
@@ -123,13 +134,13 @@ func (t *TCPConn) StartHeartbeat(interval time.Duration, heartbeatMsg []byte) {
 
 	if interval <= 0 {
 		atomic.StoreUint32(&t.heartbeatEnabled, 0)
-		t.logger.Println("心跳已禁用")
+		t.logger.Info("心跳已禁用")
 		return
 	}
 
 	t.heartbeatTicker = time.NewTicker(interval)
 	atomic.StoreUint32(&t.heartbeatEnabled, 1)
-	t.logger.Printf("启动心跳，间隔: %v (Remote: %s)", interval, t.RemoteAddr())
+	t.logger.Info("启动心跳", "interval", interval)
 
 	go t.heartbeatLoop(heartbeatMsg)
 }
@@ -142,15 +153,15 @@ func (t *TCPConn) StopHeartbeat() {
 	if t.heartbeatTicker != nil {
 		t.heartbeatTicker.Stop()
 		t.heartbeatTicker = nil
-		t.logger.Printf("心跳已停止 (Remote: %s)", t.RemoteAddr())
+		t.logger.Info("心跳已停止")
 	}
 	atomic.StoreUint32(&t.heartbeatEnabled, 0)
 }
 
 // heartbeatLoop 心跳循环
 func (t *TCPConn) heartbeatLoop(heartbeatMsg []byte) {
-	t.logger.Printf("心跳协程启动 (Remote: %s)", t.RemoteAddr())
-	defer t.logger.Printf("心跳协程退出 (Remote: %s)", t.RemoteAddr())
+	t.logger.Debug("心跳协程启动")
+	defer t.logger.Debug("心跳协程退出")
 
 	for {
 		select {
@@ -162,11 +173,11 @@ func (t *TCPConn) heartbeatLoop(heartbeatMsg []byte) {
 			}
 
 			if err := t.Write(heartbeatMsg); err != nil {
-				t.logger.Printf("发送心跳失败: %v (Remote: %s)", err, t.RemoteAddr())
+				t.logger.Error("发送心跳失败", "error", err)
 				t.safeClose()
 				return
 			}
-			t.logger.Printf("心跳已发送 (Remote: %s)", t.RemoteAddr())
+			t.logger.Debug("心跳已发送")
 		}
 	}
 }
@@ -188,9 +199,9 @@ func (t *TCPConn) Read() ([]byte, error) {
 		lenBuf := make([]byte, 4)
 		if _, err := io.ReadFull(t.reader, lenBuf); err != nil {
 			if err == io.EOF {
-				t.logger.Printf("对端关闭连接 (Remote: %s)", t.RemoteAddr())
+				t.logger.Info("对端关闭连接")
 			} else {
-				t.logger.Printf("读取长度前缀失败: %v (Remote: %s)", err, t.RemoteAddr())
+				t.logger.Error("读取长度前缀失败", "error", err)
 			}
 			return nil, err
 		}
@@ -204,11 +215,11 @@ func (t *TCPConn) Read() ([]byte, error) {
 		// 读取消息体
 		data := make([]byte, length)
 		if _, err := io.ReadFull(t.reader, data); err != nil {
-			t.logger.Printf("读取消息体失败: %v (Remote: %s)", err, t.RemoteAddr())
+			t.logger.Error("读取消息体失败", "error", err)
 			return nil, err
 		}
 
-		t.logger.Printf("收到消息 (长度: %d字节, Remote: %s)", length, t.RemoteAddr())
+		t.logger.Debug("收到消息", "length", length)
 		return data, nil
 	}
 }
@@ -237,23 +248,23 @@ func (t *TCPConn) Write(data []byte) error {
 
 		// 写入长度前缀
 		if _, err := t.writer.Write(lenBuf); err != nil {
-			t.logger.Printf("写入长度前缀失败: %v (Remote: %s)", err, t.RemoteAddr())
+			t.logger.Error("写入长度前缀失败", "error", err)
 			return err
 		}
 
 		// 写入消息体
 		if _, err := t.writer.Write(data); err != nil {
-			t.logger.Printf("写入消息体失败: %v (Remote: %s)", err, t.RemoteAddr())
+			t.logger.Error("写入消息体失败", "error", err)
 			return err
 		}
 
 		// 刷新缓冲区
 		if err := t.writer.Flush(); err != nil {
-			t.logger.Printf("刷新缓冲区失败: %v (Remote: %s)", err, t.RemoteAddr())
+			t.logger.Error("刷新缓冲区失败", "error", err)
 			return err
 		}
 
-		t.logger.Printf("消息发送成功 (长度: %d字节, Remote: %s)", length, t.RemoteAddr())
+		t.logger.Debug("消息发送成功", "length", length)
 		return nil
 	}
 }
@@ -266,21 +277,21 @@ func (t *TCPConn) OnMessage(handleFunc func([]byte)) error {
 
 	defer t.safeClose() // 确保退出时清理资源
 
-	t.logger.Printf("开始接收消息 (Remote: %s)", t.RemoteAddr())
+	t.logger.Info("开始接收消息")
 
 	for {
 		select {
 		case <-t.done:
-			t.logger.Printf("连接已关闭，停止接收消息 (Remote: %s)", t.RemoteAddr())
+			t.logger.Info("连接已关闭，停止接收消息")
 			return nil
 		default:
 			data, err := t.Read()
 			if err != nil {
 				if errors.Is(err, io.EOF) {
-					t.logger.Printf("连接正常关闭 (Remote: %s)", t.RemoteAddr())
+					t.logger.Info("连接正常关闭")
 					return nil
 				}
-				t.logger.Printf("读取消息错误: %v (Remote: %s)", err, t.RemoteAddr())
+				t.logger.Error("读取消息错误", "error", err)
 				return fmt.Errorf("读取错误: %w", err)
 			}
 
@@ -311,7 +322,7 @@ func (t *TCPConn) AsyncWrite(data []byte, callback func(error)) {
 
 // Close 安全关闭连接
 func (t *TCPConn) Close() {
-	t.logger.Printf("关闭连接 (Remote: %s)", t.RemoteAddr())
+	t.logger.Info("关闭连接")
 	t.safeClose()
 }
 
@@ -335,7 +346,7 @@ func (t *TCPConn) safeClose() {
 		// 尝试发送关闭通知
 		_, _ = t.conn.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF}) // 特殊关闭标记
 
-		t.logger.Printf("连接已完全关闭 (Remote: %s)", t.RemoteAddr())
+		t.logger.Info("连接已完全关闭")
 	})
 }
 
@@ -5,11 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
+	"github.com/Yui100901/MyGo/log_utils"
 	"github.com/gorilla/websocket"
 )
 
@@ -40,8 +41,8 @@ type WebSocket struct {
 	ctx       context.Context
 	cancel    context.CancelFunc
 
-	writeMu sync.Mutex  //写锁
-	logger  *log.Logger // 日志记录器
+	writeMu sync.Mutex   //写锁
+	logger  *slog.Logger // 日志记录器
 
 	// 心跳相关字段
 	heartbeatInterval time.Duration
@@ -50,7 +51,7 @@ type WebSocket struct {
 }
 
 // NewWebSocketByDial 主动建立连接
-func NewWebSocketByDial(dialer *websocket.Dialer, url string, requestHeader http.Header) (*WebSocket, error) {
+func NewWebSocketByDial(dialer *websocket.Dialer, url string, requestHeader http.Header, opts ...log_utils.Option) (*WebSocket, error) {
 	if dialer == nil {
 		dialer = DefaultDialer
 	}
@@ -58,11 +59,11 @@ func NewWebSocketByDial(dialer *websocket.Dialer, url string, requestHeader http
 	if err != nil {
 		return nil, fmt.Errorf("ws dial failed: %w", err)
 	}
-	return NewWebSocket(conn), nil
+	return NewWebSocket(conn, opts...), nil
 }
 
 // NewWebSocketByUpgrade 升级HTTP连接
-func NewWebSocketByUpgrade(upGrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*WebSocket, error) {
+func NewWebSocketByUpgrade(upGrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request, responseHeader http.Header, opts ...log_utils.Option) (*WebSocket, error) {
 	if upGrader == nil {
 		upGrader = WSServer
 	}
@@ -70,23 +71,29 @@ func NewWebSocketByUpgrade(upGrader *websocket.Upgrader, w http.ResponseWriter,
 	if err != nil {
 		return nil, fmt.Errorf("ws upgrade failed: %w", err)
 	}
-	return NewWebSocket(conn), nil
+	return NewWebSocket(conn, opts...), nil
 }
 
-func NewWebSocket(conn *websocket.Conn) *WebSocket {
+// NewWebSocket 封装已建立的连接，opts配置日志输出
+func NewWebSocket(conn *websocket.Conn, opts ...log_utils.Option) *WebSocket {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &WebSocket{
 		conn:        conn,
 		ctx:         ctx,
 		cancel:      cancel,
 		readTimeout: 0, // 默认无超时
-		logger:      log.New(os.Stdout, "[WS] ", log.LstdFlags),
+		logger:      log_utils.NewLogger("websocket", opts...).With("remote", conn.RemoteAddr().String()),
 	}
 }
 
-// SetLogger 设置自定义日志记录器
+// SetLogger 设置自定义日志记录器，日志以文本格式写入logger的输出
 func (ws *WebSocket) SetLogger(logger *log.Logger) {
-	ws.logger = logger
+	ws.SetSlogLogger(log_utils.NewLogger("websocket", log_utils.WithStdLogger(logger)))
+}
+
+// SetSlogLogger 设置自定义slog日志记录器，对端地址作为日志属性
+func (ws *WebSocket) SetSlogLogger(logger *slog.Logger) {
+	ws.logger = logger.With("remote", ws.RemoteAddr())
 }
 
 // SetReadTimeout 设置读取超时
@@ -106,16 +113,16 @@ func (ws *WebSocket) StartHeartbeat(interval time.Duration) {
 
 	ws.heartbeatInterval = interval
 	if interval <= 0 {
-		ws.logger.Println("心跳已禁用")
+		ws.logger.Info("心跳已禁用")
 		return
 	}
 
 	ws.heartbeatTicker = time.NewTicker(interval)
-	ws.logger.Printf("启动心跳，间隔: %v (Remote: %s)", interval, ws.RemoteAddr())
+	ws.logger.Info("启动心跳", "interval", interval)
 
 	// 设置Pong处理器
 	ws.conn.SetPongHandler(func(appData string) error {
-		ws.logger.Printf("收到Pong (Remote: %s)", ws.RemoteAddr())
+		ws.logger.Debug("收到Pong")
 		return nil
 	})
 
@@ -130,7 +137,7 @@ func (ws *WebSocket) StopHeartbeat() {
 	if ws.heartbeatTicker != nil {
 		ws.heartbeatTicker.Stop()
 		ws.heartbeatTicker = nil
-		ws.logger.Printf("心跳已停止 (Remote: %s)", ws.RemoteAddr())
+		ws.logger.Info("心跳已停止")
 	}
 }
 
@@ -141,12 +148,12 @@ func (ws *WebSocket) heartbeatLoop() {
 	for {
 		select {
 		case <-ws.ctx.Done():
-			ws.logger.Printf("心跳协程退出 (Remote: %s)", ws.RemoteAddr())
+			ws.logger.Debug("心跳协程退出")
 			return
 		case t := <-ws.heartbeatTicker.C:
 			// 检查上次响应时间
 			if time.Since(lastResponse) > ws.heartbeatInterval*2 {
-				ws.logger.Printf("心跳超时，未收到响应 (Remote: %s)", ws.RemoteAddr())
+				ws.logger.Warn("心跳超时，未收到响应")
 				ws.safeClose()
 				return
 			}
@@ -157,12 +164,12 @@ func (ws *WebSocket) heartbeatLoop() {
 			ws.writeMu.Unlock()
 
 			if err != nil {
-				ws.logger.Printf("发送心跳失败: %v (Remote: %s)", err, ws.RemoteAddr())
+				ws.logger.Error("发送心跳失败", "error", err)
 				ws.safeClose()
 				return
 			}
 
-			ws.logger.Printf("发送心跳Ping (Remote: %s)", ws.RemoteAddr())
+			ws.logger.Debug("发送心跳Ping")
 			lastResponse = t
 		}
 	}
@@ -176,12 +183,12 @@ func (ws *WebSocket) OnMessage(handleFunc func(messageType int, payload []byte))
 
 	defer ws.safeClose() // 确保退出时清理资源
 
-	ws.logger.Printf("开始接收消息 (Remote: %s)", ws.RemoteAddr())
+	ws.logger.Info("开始接收消息")
 
 	for {
 		select {
 		case <-ws.ctx.Done():
-			ws.logger.Printf("连接已关闭，停止接收消息 (Remote: %s)", ws.RemoteAddr())
+			ws.logger.Info("连接已关闭，停止接收消息")
 			return nil
 		default:
 			if ws.readTimeout > 0 {
@@ -191,15 +198,14 @@ func (ws *WebSocket) OnMessage(handleFunc func(messageType int, payload []byte))
 			msgType, message, err := ws.conn.ReadMessage()
 			if err != nil {
 				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-					ws.logger.Printf("连接正常关闭 (Remote: %s)", ws.RemoteAddr())
+					ws.logger.Info("连接正常关闭")
 					return nil
 				}
-				ws.logger.Printf("读取消息错误: %v (Remote: %s)", err, ws.RemoteAddr())
+				ws.logger.Error("读取消息错误", "error", err)
 				return fmt.Errorf("read error: %w", err)
 			}
 
-			ws.logger.Printf("收到消息 (类型: %d, 长度: %d字节, Remote: %s)",
-				msgType, len(message), ws.RemoteAddr())
+			ws.logger.Debug("收到消息", "type", msgType, "length", len(message))
 
 			handleFunc(msgType, message)
 		}
@@ -213,25 +219,24 @@ func (ws *WebSocket) SendMessage(messageType int, payload []byte) error {
 
 	select {
 	case <-ws.ctx.Done():
-		ws.logger.Printf("尝试发送消息但连接已关闭 (Remote: %s)", ws.RemoteAddr())
+		ws.logger.Warn("尝试发送消息但连接已关闭")
 		return websocket.ErrCloseSent
 	default:
 		_ = ws.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
 		err := ws.conn.WriteMessage(messageType, payload)
 		if err != nil {
-			ws.logger.Printf("发送消息失败: %v (Remote: %s)", err, ws.RemoteAddr())
+			ws.logger.Error("发送消息失败", "error", err)
 			return fmt.Errorf("write error: %w", err)
 		}
 
-		ws.logger.Printf("消息发送成功 (类型: %d, 长度: %d字节, Remote: %s)",
-			messageType, len(payload), ws.RemoteAddr())
+		ws.logger.Debug("消息发送成功", "type", messageType, "length", len(payload))
 		return nil
 	}
 }
 
 // Close 安全关闭连接
 func (ws *WebSocket) Close() {
-	ws.logger.Printf("关闭连接 (Remote: %s)", ws.RemoteAddr())
+	ws.logger.Info("关闭连接")
 	ws.safeClose()
 }
 
@@ -249,17 +254,17 @@ func (ws *WebSocket) safeClose() {
 			time.Now().Add(closeTimeout),
 		)
 		if err != nil {
-			ws.logger.Printf("发送关闭帧失败: %v (Remote: %s)", err, ws.RemoteAddr())
+			ws.logger.Error("发送关闭帧失败", "error", err)
 		} else {
-			ws.logger.Printf("关闭帧已发送 (Remote: %s)", ws.RemoteAddr())
+			ws.logger.Debug("关闭帧已发送")
 		}
 
 		// 安全关闭底层连接
 		err = ws.conn.Close()
 		if err != nil {
-			ws.logger.Printf("关闭底层连接失败: %v (Remote: %s)", err, ws.RemoteAddr())
+			ws.logger.Error("关闭底层连接失败", "error", err)
 		} else {
-			ws.logger.Printf("连接已完全关闭 (Remote: %s)", ws.RemoteAddr())
+			ws.logger.Info("连接已完全关闭")
 		}
 	})
 }
@@ -274,6 +279,11 @@ func (ws *WebSocket) LocalAddr() string {
 	return ws.conn.LocalAddr().String()
 }
 
+// Done 获取关闭信号通道
+func (ws *WebSocket) Done() <-chan struct{} {
+	return ws.ctx.Done()
+}
+
 // IsClosed 检查连接是否已关闭
 func (ws *WebSocket) IsClosed() bool {
 	select {